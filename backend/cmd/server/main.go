@@ -9,6 +9,7 @@ import (
 	"etl-tool/internal/api"
 	"etl-tool/internal/config"
 	infra_redis "etl-tool/internal/infrastructure/redis"
+	_ "etl-tool/internal/plugins" // 自定义清洗策略
 	"etl-tool/internal/repository"
 	"etl-tool/internal/service"
 )
@@ -36,25 +37,12 @@ func main() {
 
 	// 3. Initialize Service
 	cleanerService := service.NewCleanerService()
+	cleanerService.RecoverBulkOperations()
 
 	// 3.1 Start Backgroup Worker (Embedded Mode for Dev)
 	go func() {
 		log.Println("[Worker] Embedded Worker started")
-		ctx := context.Background()
-		for {
-			task, err := cleanerService.Queue.DequeueTask(2 * time.Second)
-			if err != nil {
-				if err.Error() != "redis: nil" {
-					log.Printf("[Worker] Queue error: %v", err)
-				}
-				time.Sleep(1 * time.Second)
-				continue
-			}
-			if task != nil {
-				log.Printf("[Worker] Processing batch %d", task.BatchID)
-				cleanerService.ProcessBatch(ctx, task.BatchID, task.FilePath)
-			}
-		}
+		cleanerService.RunWorker(context.Background(), 2*time.Second)
 	}()
 
 	// 4. Setup Router
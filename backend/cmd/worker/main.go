@@ -10,6 +10,7 @@ import (
 
 	"etl-tool/internal/config"
 	infra_redis "etl-tool/internal/infrastructure/redis"
+	_ "etl-tool/internal/plugins" // 自定义清洗策略
 	"etl-tool/internal/repository"
 	"etl-tool/internal/service"
 )
@@ -51,31 +52,5 @@ func main() {
 		cancel()
 	}()
 
-	log.Println("[Worker] Waiting for tasks...")
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("[Worker] Stopped.")
-			return
-		default:
-			// Blocking pop with timeout (allows checking context periodically)
-			task, err := svc.Queue.DequeueTask(5 * time.Second)
-			if err != nil {
-				// Redis nil means timeout (no task)
-				if err.Error() == "redis: nil" {
-					continue
-				}
-				// Retry on connection error
-				log.Printf("[Worker] Redis error: %v. Retrying in 5s...", err)
-				time.Sleep(5 * time.Second)
-				continue
-			}
-
-			if task != nil {
-				log.Printf("[Worker] Received task: ID=%d File=%s", task.BatchID, task.FilePath)
-				svc.ProcessBatch(ctx, task.BatchID, task.FilePath)
-				log.Printf("[Worker] Task %d completed/processed", task.BatchID)
-			}
-		}
-	}
+	svc.RunWorker(ctx, 5*time.Second)
 }
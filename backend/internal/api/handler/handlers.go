@@ -3,6 +3,7 @@ package handler
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -19,6 +20,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type CsvHandler struct {
@@ -29,6 +31,20 @@ func NewCsvHandler(s *service.CleanerService) *CsvHandler {
 	return &CsvHandler{Service: s}
 }
 
+// Health 健康检查，报告数据库状态与持久化模式（speed/safe）。降级时返回 503，便于负载均衡与探针识别
+func (h *CsvHandler) Health(c *gin.Context) {
+	info := h.Service.Health()
+	if info.Status != "ok" {
+		c.JSON(http.StatusServiceUnavailable, utils.Response{
+			Code:    http.StatusServiceUnavailable,
+			Message: info.Status,
+			Data:    info,
+		})
+		return
+	}
+	utils.SuccessResponse(c, info)
+}
+
 // CheckHash 检查文件 Hash 是否已上传过（物理秒传预检）
 func (h *CsvHandler) CheckHash(c *gin.Context) {
 	var body struct {
@@ -71,6 +87,11 @@ func (h *CsvHandler) SuggestRules(c *gin.Context) {
 	utils.SuccessResponse(c, suggestions)
 }
 
+// GetStrategies 列出可用的清洗策略及其参数说明
+func (h *CsvHandler) GetStrategies(c *gin.Context) {
+	utils.SuccessResponse(c, service.ListStrategies())
+}
+
 // Upload handles the CSV upload with streaming and de-duplication
 func (h *CsvHandler) Upload(c *gin.Context) {
 	mr, err := c.Request.MultipartReader()
@@ -89,8 +110,22 @@ func (h *CsvHandler) Upload(c *gin.Context) {
 	var originalName string
 	var fileHash string
 	var cleaningRules string
+	var columnMapping string
+	var dedupConfig string
+	var ruleSetID uint
+	var ruleSetVersion int
 	var reused bool
 
+	// 引用规则集时使用其指定版本（默认最新），否则使用直接提交的 rules
+	resolveRules := func() (service.RuleSource, bool) {
+		src, err := h.Service.ResolveRuleSource(cleaningRules, ruleSetID, ruleSetVersion, c.GetString("username"))
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid rule set: "+err.Error())
+			return src, false
+		}
+		return src, true
+	}
+
 	// 遍历 multipart 部分
 	for {
 		part, err := mr.NextPart()
@@ -112,15 +147,57 @@ func (h *CsvHandler) Upload(c *gin.Context) {
 			continue
 		}
 
-		// 处理 Rules 字段
+		// 处理 Rules 字段：规则无效时拒绝上传，不会以与提交内容不同的规则启动批次
 		if part.FormName() == "rules" {
 			buf := new(strings.Builder)
 			io.Copy(buf, part)
 			cleaningRules = buf.String()
+			if err := service.ValidateRules(cleaningRules); err != nil {
+				badRequest(c, err)
+				return
+			}
 			log.Printf("[Upload] Received custom cleaning rules from client")
 			continue
 		}
 
+		// 处理规则集引用（rule_set_id / rule_set_version），需先于 file 到达
+		if part.FormName() == "rule_set_id" || part.FormName() == "rule_set_version" {
+			buf := new(strings.Builder)
+			io.Copy(buf, part)
+			if part.FormName() == "rule_set_id" {
+				fmt.Sscanf(buf.String(), "%d", &ruleSetID)
+			} else {
+				fmt.Sscanf(buf.String(), "%d", &ruleSetVersion)
+			}
+			continue
+		}
+
+		// 处理 Mapping 字段（源表头 -> 逻辑字段 / ignore），需先于 file 到达
+		if part.FormName() == "mapping" {
+			buf := new(strings.Builder)
+			io.Copy(buf, part)
+			columnMapping = buf.String()
+			if _, err := utils.ParseColumnMapping(columnMapping); err != nil {
+				utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			log.Printf("[Upload] Received column mapping from client")
+			continue
+		}
+
+		// 处理 Dedup 字段（去重配置，导入完成后执行），需先于 file 到达
+		if part.FormName() == "dedup" {
+			buf := new(strings.Builder)
+			io.Copy(buf, part)
+			dedupConfig = buf.String()
+			if _, err := service.ParseDedupConfig(dedupConfig); err != nil {
+				utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			log.Printf("[Upload] Received dedup config from client")
+			continue
+		}
+
 		// 处理 filename 字段 (针对快传模式，前端会单独传一个文件名)
 		if part.FormName() == "filename" {
 			buf := new(strings.Builder)
@@ -168,7 +245,11 @@ func (h *CsvHandler) Upload(c *gin.Context) {
 
 				// Create NEW Batch Record instead of re-using old one
 				username := c.GetString("username")
-				batch, err := h.Service.CreateBatchFromHash(originalName, username, fileHash, cleaningRules)
+				rules, ok := resolveRules()
+				if !ok {
+					return
+				}
+				batch, err := h.Service.CreateBatchFromHash(originalName, username, fileHash, rules, columnMapping, dedupConfig)
 				if err != nil {
 					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create new batch from existing file: " + err.Error()})
 					return
@@ -204,7 +285,11 @@ func (h *CsvHandler) Upload(c *gin.Context) {
 		// 如果没有文件流但是有 Hash 和 OriginalName，说明是快传模式
 		if fileHash != "" && originalName != "" {
 			username := c.GetString("username")
-			batch, err := h.Service.CreateBatchFromHash(originalName, username, fileHash, cleaningRules)
+			rules, ok := resolveRules()
+			if !ok {
+				return
+			}
+			batch, err := h.Service.CreateBatchFromHash(originalName, username, fileHash, rules, columnMapping, dedupConfig)
 			if err == nil {
 				h.Service.ProcessFileAsync(batch.ID, batch.FilePath)
 				utils.SuccessResponse(c, gin.H{
@@ -223,7 +308,12 @@ func (h *CsvHandler) Upload(c *gin.Context) {
 
 	// Create Batch Record
 	username := c.GetString("username")
-	batch, err := h.Service.CreateBatch(originalName, username, fileHash, savedPath, cleaningRules)
+	rules, ok := resolveRules()
+	if !ok {
+		os.Remove(savedPath)
+		return
+	}
+	batch, err := h.Service.CreateBatch(originalName, username, fileHash, savedPath, rules, columnMapping, dedupConfig)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create batch"})
 		return
@@ -240,6 +330,102 @@ func (h *CsvHandler) Upload(c *gin.Context) {
 	})
 }
 
+// PreviewUpload 用提交的规则与列映射预览文件前 N 行（或随机抽样）的清洗结果，不创建批次与记录。
+// 表单字段与上传接口一致（rules / rule_set_id / rule_set_version / mapping / hash / file），另支持 limit 与 sample=random；
+// 未携带文件时按 hash 使用服务器上已有的文件
+func (h *CsvHandler) PreviewUpload(c *gin.Context) {
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Failed to initialize stream: "+err.Error())
+		return
+	}
+
+	var req service.PreviewRequest
+	var fileHash, previewPath string
+	var ruleSetID uint
+	var ruleSetVersion int
+	defer func() {
+		if previewPath != "" {
+			os.Remove(previewPath)
+		}
+	}()
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Stream break: "+err.Error())
+			return
+		}
+
+		if part.FormName() == "file" {
+			// 临时文件保留原扩展名，以便迭代器识别 xlsx
+			previewPath = filepath.Join(os.TempDir(), fmt.Sprintf("preview_%s%s", uuid.New().String(), filepath.Ext(part.FileName())))
+			dst, err := os.Create(previewPath)
+			if err != nil {
+				utils.ErrorResponse(c, http.StatusInternalServerError, "Disk error: "+err.Error())
+				return
+			}
+			_, err = io.Copy(dst, part)
+			dst.Close()
+			if err != nil {
+				utils.ErrorResponse(c, http.StatusInternalServerError, "Upload interrupted: "+err.Error())
+				return
+			}
+			continue
+		}
+
+		buf := new(strings.Builder)
+		io.Copy(buf, part)
+		switch part.FormName() {
+		case "hash":
+			fileHash = buf.String()
+		case "rules":
+			req.Rules = buf.String()
+		case "mapping":
+			req.Mapping = buf.String()
+		case "rule_set_id":
+			fmt.Sscanf(buf.String(), "%d", &ruleSetID)
+		case "rule_set_version":
+			fmt.Sscanf(buf.String(), "%d", &ruleSetVersion)
+		case "limit":
+			fmt.Sscanf(buf.String(), "%d", &req.Limit)
+		case "sample":
+			req.Sample = buf.String() == "random"
+		}
+	}
+
+	path := previewPath
+	if path == "" {
+		if fileHash == "" {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Either a file or the hash of an uploaded file is required")
+			return
+		}
+		batch, err := h.Service.FindBatchByHash(fileHash)
+		if err != nil || batch == nil {
+			utils.ErrorResponse(c, http.StatusNotFound, "File not found for hash")
+			return
+		}
+		path = batch.FilePath
+	}
+
+	src, err := h.Service.ResolveRuleSource(req.Rules, ruleSetID, ruleSetVersion, c.GetString("username"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid rule set: "+err.Error())
+		return
+	}
+	req.Rules = src.Rules
+
+	result, err := h.Service.PreviewFile(path, req)
+	if err != nil {
+		badRequest(c, err)
+		return
+	}
+	utils.SuccessResponse(c, result)
+}
+
 // GetBatchStatus returns the processing status
 func (h *CsvHandler) GetBatchStatus(c *gin.Context) {
 	id := c.Param("id")
@@ -251,11 +437,36 @@ func (h *CsvHandler) GetBatchStatus(c *gin.Context) {
 	utils.SuccessResponse(c, batch)
 }
 
+// GetBatchAnalytics 返回批次的错误与数据质量统计，refresh=true 时重新聚合
+func (h *CsvHandler) GetBatchAnalytics(c *gin.Context) {
+	analytics, err := h.Service.GetBatchAnalytics(c.Param("id"), c.Query("refresh") == "true")
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrAnalyticsNotReady):
+			utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, "Batch not found")
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	utils.SuccessResponse(c, analytics)
+}
+
 // GetBatchRecords returns paginated records
 func (h *CsvHandler) GetBatchRecords(c *gin.Context) {
 	id := c.Param("id")
-	filter := c.Query("filter") // all, clean, error
-	search := c.Query("search")
+	filter := service.RecordFilter{
+		Status: c.Query("filter"), // all, clean, error
+		Search: c.Query("search"),
+		Column: c.Query("column"), // 可选：仅在指定源列中搜索
+		ErrorFilter: service.ErrorFilter{
+			Code:   c.Query("error_code"),   // 可选：按错误代码过滤
+			Column: c.Query("error_column"), // 可选：按出错的列过滤
+		},
+		Duplicates: c.Query("duplicates"), // 可选：only / exclude
+	}
 
 	// Bind query params might fail if strictly typed, manual parse is safer for quick impl
 	// but let's assume default simple binding works or just stay simple
@@ -278,7 +489,7 @@ func (h *CsvHandler) GetBatchRecords(c *gin.Context) {
 		q.PageSize = 100
 	}
 
-	records, total, err := h.Service.GetRecords(id, filter, search, q.Page, q.PageSize)
+	records, total, err := h.Service.GetRecords(id, filter, q.Page, q.PageSize)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
@@ -295,7 +506,8 @@ func (h *CsvHandler) GetBatchRecords(c *gin.Context) {
 // ExportBatch downloads the processed CSV/Excel
 func (h *CsvHandler) ExportBatch(c *gin.Context) {
 	id := c.Param("id")
-	filter := c.Query("type") // compatible with frontend query naming if needed, or use 'filter'
+	filter := c.Query("type")              // compatible with frontend query naming if needed, or use 'filter'
+	includeRaw := c.Query("raw") == "true" // 可选：追加源文件原始列，便于对照
 
 	downloadName, err := h.Service.GetBatchFilename(id)
 	if err != nil {
@@ -319,13 +531,13 @@ func (h *CsvHandler) ExportBatch(c *gin.Context) {
 	if isExcel {
 		// Excel Streaming
 		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
-		if err := h.Service.ExportBatchWithExcelStream(id, filter, c.Writer); err != nil {
+		if err := h.Service.ExportBatchWithExcelStream(id, filter, includeRaw, c.Writer); err != nil {
 			fmt.Printf("Export excel stream failed: %v\n", err)
 		}
 	} else {
 		// CSV Streaming (Default)
 		c.Header("Content-Type", "text/csv; charset=utf-8")
-		if err := h.Service.ExportBatchStream(id, filter, c.Writer); err != nil {
+		if err := h.Service.ExportBatchStream(id, filter, includeRaw, c.Writer); err != nil {
 			fmt.Printf("Export csv stream failed: %v\n", err)
 		}
 	}
@@ -384,7 +596,7 @@ func (h *CsvHandler) StreamBatchProgress(c *gin.Context) {
 		// Termination Logic
 		if batch.Status == model.BatchStatusCompleted {
 			// Send final completed event with preview
-			records, _, _ := h.Service.GetRecords(id, "all", "", 1, 5)
+			records, _, _ := h.Service.GetRecords(id, service.RecordFilter{Status: "all"}, 1, 5)
 			c.SSEvent("message", gin.H{
 				"type":    "completed",
 				"total":   batch.TotalRows,
@@ -442,7 +654,7 @@ func (h *CsvHandler) UpdateRecord(c *gin.Context) {
 
 	record, err := h.Service.UpdateRecord(id, req.Updates, req.Reason)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		recordError(c, err)
 		return
 	}
 	utils.SuccessResponse(c, record)
@@ -462,7 +674,7 @@ func (h *CsvHandler) ValidateRecord(c *gin.Context) {
 
 	result, err := h.Service.ValidateRecordUpdate(id, req.Updates)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		recordError(c, err)
 		return
 	}
 	utils.SuccessResponse(c, result)
@@ -481,6 +693,20 @@ func (h *CsvHandler) RollbackRecord(c *gin.Context) {
 	utils.SuccessResponse(c, record)
 }
 
+// GetRecord 返回记录详情（含源表头与原始行）
+func (h *CsvHandler) GetRecord(c *gin.Context) {
+	record, err := h.Service.GetRecord(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, "Record not found")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	utils.SuccessResponse(c, record)
+}
+
 // GetRecordHistory returns history for a record
 func (h *CsvHandler) GetRecordHistory(c *gin.Context) {
 	id := c.Param("id")
@@ -583,3 +809,166 @@ func (h *CsvHandler) DeleteBatch(c *gin.Context) {
 	}
 	utils.SuccessResponse(c, gin.H{"message": "Batch deleted successfully"})
 }
+
+// CreateBulkOperation 对批次中符合过滤条件的记录发起批量修正（后台执行）
+func (h *CsvHandler) CreateBulkOperation(c *gin.Context) {
+	var id uint
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	var req service.BulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	op, err := h.Service.CreateBulkOperation(id, req, c.GetString("username"))
+	if err != nil {
+		h.bulkError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, op)
+}
+
+// RecleanBatch 以修订后的规则集重新清洗批次（后台执行），进度与状态变化统计通过 /operations/:id 查询
+func (h *CsvHandler) RecleanBatch(c *gin.Context) {
+	var id uint
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	var req service.RecleanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	op, err := h.Service.RecleanBatch(id, req, c.GetString("username"))
+	if err != nil {
+		h.bulkError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, op)
+}
+
+// DedupBatch 按去重配置（默认使用上传时的配置）重新识别批次中的重复记录（后台执行）
+func (h *CsvHandler) DedupBatch(c *gin.Context) {
+	var id uint
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	var req service.DedupRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	op, err := h.Service.DedupBatch(id, req, c.GetString("username"))
+	if err != nil {
+		h.bulkError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, op)
+}
+
+// GetDuplicates 按重复组分页返回批次的重复记录
+func (h *CsvHandler) GetDuplicates(c *gin.Context) {
+	var id uint
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	type Query struct {
+		Page     int `form:"page,default=1"`
+		PageSize int `form:"pageSize,default=10"`
+	}
+	var q Query
+	if err := c.ShouldBindQuery(&q); err != nil {
+		q.Page = 1
+		q.PageSize = 10
+	}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize < 1 || q.PageSize > 100 {
+		q.PageSize = 10
+	}
+
+	groups, total, err := h.Service.GetDuplicates(id, q.Page, q.PageSize)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	utils.SuccessResponse(c, gin.H{
+		"data":     groups,
+		"total":    total,
+		"page":     q.Page,
+		"pageSize": q.PageSize,
+	})
+}
+
+// GetBulkOperations 列出批次的批量操作
+func (h *CsvHandler) GetBulkOperations(c *gin.Context) {
+	var id uint
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	ops, err := h.Service.GetBulkOperations(id)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	utils.SuccessResponse(c, ops)
+}
+
+// GetBulkOperation 查询批量操作进度
+func (h *CsvHandler) GetBulkOperation(c *gin.Context) {
+	var id uint
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	op, err := h.Service.GetBulkOperation(id)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "Operation not found")
+		return
+	}
+	utils.SuccessResponse(c, op)
+}
+
+// UndoBulkOperation 整体撤销一个批量操作（后台执行）
+func (h *CsvHandler) UndoBulkOperation(c *gin.Context) {
+	var id uint
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	op, err := h.Service.UndoBulkOperation(id, c.GetString("username"))
+	if err != nil {
+		h.bulkError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, op)
+}
+
+func (h *CsvHandler) bulkError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrOperationInProgress), errors.Is(err, service.ErrBatchNotSettled):
+		utils.ErrorResponse(c, http.StatusConflict, err.Error())
+	default:
+		badRequest(c, err)
+	}
+}
+
+// recordError 批次规则无效时返回 400（附带逐项详情），其余错误返回 500
+func recordError(c *gin.Context, err error) {
+	var rce service.RuleConfigErrors
+	if errors.As(err, &rce) {
+		badRequest(c, err)
+		return
+	}
+	utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+}
+
+// badRequest 返回 400；规则校验错误附带逐项详情（路径、参数与描述）
+func badRequest(c *gin.Context, err error) {
+	var rce service.RuleConfigErrors
+	if errors.As(err, &rce) {
+		utils.ErrorResponseWithDetails(c, http.StatusBadRequest, err.Error(), rce)
+		return
+	}
+	utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+}
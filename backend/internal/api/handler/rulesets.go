@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"etl-tool/internal/model"
+	"etl-tool/internal/service"
+	"etl-tool/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetRuleSets 列出当前用户可见的规则集（自己的与共享的）
+func (h *CsvHandler) GetRuleSets(c *gin.Context) {
+	sets, err := h.Service.GetRuleSets(c.GetString("username"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if sets == nil {
+		sets = []model.RuleSet{}
+	}
+	utils.SuccessResponse(c, sets)
+}
+
+// CreateRuleSet 创建规则集，规则通过 RuleEngine 校验后保存为版本 1
+func (h *CsvHandler) CreateRuleSet(c *gin.Context) {
+	var req service.RuleSetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	detail, err := h.Service.CreateRuleSet(req, c.GetString("username"))
+	if err != nil {
+		h.ruleSetError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, detail)
+}
+
+// GetRuleSet 返回规则集及指定版本（?version=N，默认最新）
+func (h *CsvHandler) GetRuleSet(c *gin.Context) {
+	var id uint
+	var version int
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+	fmt.Sscanf(c.Query("version"), "%d", &version)
+
+	detail, err := h.Service.GetRuleSet(id, version, c.GetString("username"))
+	if err != nil {
+		h.ruleSetError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, detail)
+}
+
+// GetRuleSetVersions 列出规则集的全部版本
+func (h *CsvHandler) GetRuleSetVersions(c *gin.Context) {
+	var id uint
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	versions, err := h.Service.GetRuleSetVersions(id, c.GetString("username"))
+	if err != nil {
+		h.ruleSetError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, versions)
+}
+
+// UpdateRuleSet 更新规则集，规则变化时生成新版本（仅所有者）
+func (h *CsvHandler) UpdateRuleSet(c *gin.Context) {
+	var id uint
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	var req service.RuleSetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	detail, err := h.Service.UpdateRuleSet(id, req, c.GetString("username"))
+	if err != nil {
+		h.ruleSetError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, detail)
+}
+
+// DeleteRuleSet 删除规则集（仅所有者）
+func (h *CsvHandler) DeleteRuleSet(c *gin.Context) {
+	var id uint
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	if err := h.Service.DeleteRuleSet(id, c.GetString("username")); err != nil {
+		h.ruleSetError(c, err)
+		return
+	}
+	utils.SuccessResponse(c, gin.H{"message": "Rule set deleted"})
+}
+
+// GetRuleSetBatches 列出使用该规则集导入的批次，?outdated=true 时只返回使用旧版本的批次
+func (h *CsvHandler) GetRuleSetBatches(c *gin.Context) {
+	var id uint
+	fmt.Sscanf(c.Param("id"), "%d", &id)
+
+	batches, err := h.Service.GetRuleSetBatches(id, c.GetString("username"), c.Query("outdated") == "true")
+	if err != nil {
+		h.ruleSetError(c, err)
+		return
+	}
+	if batches == nil {
+		batches = []model.ImportBatch{}
+	}
+	utils.SuccessResponse(c, batches)
+}
+
+func (h *CsvHandler) ruleSetError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrRuleSetForbidden):
+		utils.ErrorResponse(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, service.ErrRuleSetNameTaken):
+		utils.ErrorResponse(c, http.StatusConflict, err.Error())
+	default:
+		badRequest(c, err)
+	}
+}
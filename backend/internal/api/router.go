@@ -62,6 +62,7 @@ func SetupRouter(svc *service.CleanerService) *gin.Engine {
 		// Public Routes
 		api.POST("/login", authHandler.Login)
 		api.POST("/register", authHandler.Register)
+		api.GET("/health", h.Health)
 
 		// Protected Routes
 		protected := api.Group("/")
@@ -96,10 +97,13 @@ func SetupRouter(svc *service.CleanerService) *gin.Engine {
 			protected.GET("/auth/download-token", authHandler.GetDownloadToken)
 			protected.POST("/upload/check", h.CheckHash)
 			protected.POST("/upload/suggest-rules", h.SuggestRules)
+			protected.GET("/rules/strategies", h.GetStrategies)
+			protected.POST("/upload/preview", h.PreviewUpload)
 			protected.POST("/upload", h.Upload)
 			protected.GET("/batches", h.GetBatches)
 			protected.GET("/batches/:id", h.GetBatchStatus)
 			protected.GET("/batches/:id/records", h.GetBatchRecords)
+			protected.GET("/batches/:id/analytics", h.GetBatchAnalytics)
 			protected.GET("/batches/:id/export", h.ExportBatch)
 			protected.PATCH("/batches/:id", h.UpdateBatch)
 			protected.GET("/batches/:id/progress", h.StreamBatchProgress)
@@ -107,7 +111,23 @@ func SetupRouter(svc *service.CleanerService) *gin.Engine {
 			protected.POST("/batches/:id/resume", h.ResumeBatch)
 			protected.POST("/batches/:id/cancel", h.CancelBatch)
 			protected.DELETE("/batches/:id", h.DeleteBatch)
-
+			protected.POST("/batches/:id/reclean", h.RecleanBatch)
+			protected.POST("/batches/:id/dedup", h.DedupBatch)
+			protected.GET("/batches/:id/duplicates", h.GetDuplicates)
+			protected.POST("/batches/:id/operations", h.CreateBulkOperation)
+			protected.GET("/batches/:id/operations", h.GetBulkOperations)
+			protected.GET("/operations/:id", h.GetBulkOperation)
+			protected.POST("/operations/:id/undo", h.UndoBulkOperation)
+
+			protected.GET("/rulesets", h.GetRuleSets)
+			protected.POST("/rulesets", h.CreateRuleSet)
+			protected.GET("/rulesets/:id", h.GetRuleSet)
+			protected.PUT("/rulesets/:id", h.UpdateRuleSet)
+			protected.DELETE("/rulesets/:id", h.DeleteRuleSet)
+			protected.GET("/rulesets/:id/versions", h.GetRuleSetVersions)
+			protected.GET("/rulesets/:id/batches", h.GetRuleSetBatches)
+
+			protected.GET("/records/:id", h.GetRecord)
 			protected.PUT("/records/:id", h.UpdateRecord)
 			protected.POST("/records/:id/validate", h.ValidateRecord)
 			protected.GET("/records/:id/history", h.GetRecordHistory)
@@ -21,6 +21,8 @@ type Config struct {
 		TimeZone               string `yaml:"timezone"`
 		BatchInsertConcurrency int    `yaml:"batch_insert_concurrency"`
 		MaintenanceWorkMem     string `yaml:"maintenance_work_mem"`
+		Saver                  string `yaml:"saver"`      // 记录写入方式：gorm（多行 INSERT）或 copy（COPY FROM STDIN）
+		Durability             string `yaml:"durability"` // 持久化模式：safe（LOGGED + 同步提交）或 speed（UNLOGGED + 异步提交，崩溃丢数据）
 	} `yaml:"database"`
 	Server struct {
 		Port      int    `yaml:"port"`
@@ -29,11 +31,26 @@ type Config struct {
 		UploadDir string `yaml:"upload_dir"`
 	} `yaml:"server"`
 	CleaningRules interface{} `yaml:"cleaning_rules"`
-	Redis         struct {
+	Address       struct {
+		DivisionsFile string `yaml:"divisions_file"` // 行政区划代码表（代码<TAB>名称），为空时使用内置表
+	} `yaml:"address"`
+	Redis struct {
 		Addr     string `yaml:"addr"`
 		Password string `yaml:"password"`
 		DB       int    `yaml:"db"`
 	} `yaml:"redis"`
+	Queue struct {
+		VisibilityTimeout int `yaml:"visibility_timeout"` // Worker 心跳有效期（秒），超时后其任务会被回收
+		ReclaimInterval   int `yaml:"reclaim_interval"`   // 回收扫描间隔（秒）
+		MaxRetries        int `yaml:"max_retries"`        // 最大重新投递次数，超过后进入死信队列
+	} `yaml:"queue"`
+	Reaper struct {
+		Interval           int    `yaml:"interval"`             // 扫描间隔（秒）
+		StaleAfter         int    `yaml:"stale_after"`          // Processing 状态下进度停止更新多久视为卡死（秒）
+		IndexingStaleAfter int    `yaml:"indexing_stale_after"` // Indexing 状态的超时（秒），索引重建本身较慢
+		Policy             string `yaml:"policy"`               // requeue: 从断点重新入队; fail: 直接标记为失败
+		MaxRecoveries      int    `yaml:"max_recoveries"`       // 单个批次最多自动恢复次数，超过后标记为失败
+	} `yaml:"reaper"`
 }
 
 func (c *Config) GetDatabaseDSN() string {
@@ -64,6 +81,16 @@ func LoadConfig() *Config {
 	c.Database.TimeZone = "Asia/Shanghai"
 	c.Database.BatchInsertConcurrency = 2
 	c.Database.MaintenanceWorkMem = "32MB"
+	c.Database.Saver = "gorm"
+	c.Database.Durability = "safe"
+	c.Queue.VisibilityTimeout = 30
+	c.Queue.ReclaimInterval = 15
+	c.Queue.MaxRetries = 3
+	c.Reaper.Interval = 30
+	c.Reaper.StaleAfter = 300
+	c.Reaper.IndexingStaleAfter = 1800
+	c.Reaper.Policy = "requeue"
+	c.Reaper.MaxRecoveries = 3
 
 	// 2. 确定当前环境
 	env := os.Getenv("APP_ENV")
@@ -119,6 +146,9 @@ func LoadConfig() *Config {
 	if maintMem := os.Getenv("DB_MAINT_MEM"); maintMem != "" {
 		c.Database.MaintenanceWorkMem = maintMem
 	}
+	if durability := os.Getenv("DB_DURABILITY"); durability != "" {
+		c.Database.Durability = durability
+	}
 
 	log.Printf("[Config] Server config initialized. Env: %s, Mode: %s, Port: %d", env, c.Server.Mode, c.Server.Port)
 	AppConfig = c
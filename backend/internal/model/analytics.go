@@ -0,0 +1,62 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+// BatchAnalytics 批次的错误与数据质量统计，缓存在 ImportBatch.Analytics 中
+type BatchAnalytics struct {
+	Rows       int             `json:"rows"`
+	Source     string          `json:"source"` // import: 导入时增量统计；scan: 导入后聚合扫描
+	ComputedAt time.Time       `json:"computed_at"`
+	Errors     []ErrorCount    `json:"errors"`    // 按列与规则分组的错误数
+	Columns    []ColumnProfile `json:"columns"`   // 每列的空值率、去重估计与错误值排行
+	Provinces  []ValueCount    `json:"provinces"` // 解析出的省份分布
+	Cities     []CityCount     `json:"cities"`    // 解析出的城市分布
+}
+
+// ErrorCount 某列某规则（错误代码）的出错行数
+type ErrorCount struct {
+	Column string `json:"column"`
+	Rule   string `json:"rule"`
+	Code   string `json:"code"`
+	Count  int    `json:"count"`
+}
+
+// ColumnProfile 单列的数据概况
+type ColumnProfile struct {
+	Column           string       `json:"column"`
+	Empty            int          `json:"empty"`
+	EmptyRate        float64      `json:"empty_rate"`
+	DistinctEstimate uint64       `json:"distinct_estimate"` // HyperLogLog 估计值，误差约 1.6%
+	TopErrorValues   []ValueCount `json:"top_error_values"`  // 出错最多的值（近似计数）
+}
+
+// ValueCount 值及其出现次数
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// CityCount 城市及其所属省份的出现次数
+type CityCount struct {
+	Province string `json:"province"`
+	City     string `json:"city"`
+	Count    int    `json:"count"`
+}
+
+// Value 实现 driver.Valuer
+func (a BatchAnalytics) Value() (driver.Value, error) {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan 实现 sql.Scanner
+func (a *BatchAnalytics) Scan(value interface{}) error {
+	return scanJSON(value, a)
+}
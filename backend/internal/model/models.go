@@ -20,43 +20,61 @@ const (
 
 // ImportBatch tracks the lifecycle of a CSV upload
 type ImportBatch struct {
-	ID               uint           `gorm:"primaryKey" json:"id"`
-	OriginalFilename string         `gorm:"size:255" json:"original_filename"`
-	FileHash         string         `gorm:"size:64;index" json:"file_hash"` // SHA256 hash
-	FilePath         string         `gorm:"size:500" json:"file_path"`
-	Status           BatchStatus    `gorm:"size:50;index;default:'Pending'" json:"status"`
-	TotalRows        int            `json:"total_rows"`
-	ProcessedRows    int            `json:"processed_rows"` // New field for progress tracking
-	SuccessCount     int            `json:"success_count"`
-	FailureCount     int            `json:"failure_count"`
-	CreatedBy        string         `gorm:"size:100;index" json:"created_by"` // Username of uploader
-	CreatedAt        time.Time      `json:"created_at"`
-	UpdatedAt        time.Time      `json:"updated_at"`
-	CompletedAt      *time.Time     `json:"completed_at"` // Pointer to allow null
-	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
-	Error            string         `gorm:"type:text" json:"error"` // 存储失败原因
-	Rules            string         `gorm:"type:text" json:"rules"` // JSON 清洗规则
+	ID               uint            `gorm:"primaryKey" json:"id"`
+	OriginalFilename string          `gorm:"size:255" json:"original_filename"`
+	FileHash         string          `gorm:"size:64;index" json:"file_hash"` // SHA256 hash
+	FilePath         string          `gorm:"size:500" json:"file_path"`
+	Status           BatchStatus     `gorm:"size:50;index;default:'Pending'" json:"status"`
+	TotalRows        int             `json:"total_rows"`
+	ProcessedRows    int             `json:"processed_rows"` // New field for progress tracking
+	SuccessCount     int             `json:"success_count"`
+	FailureCount     int             `json:"failure_count"`
+	CreatedBy        string          `gorm:"size:100;index" json:"created_by"` // Username of uploader
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+	CompletedAt      *time.Time      `json:"completed_at"` // Pointer to allow null
+	DeletedAt        gorm.DeletedAt  `gorm:"index" json:"-"`
+	Error            string          `gorm:"type:text" json:"error"`          // 存储失败原因（或 Reaper 最近一次重新入队的原因）
+	Rules            string          `gorm:"type:text" json:"rules"`          // JSON 清洗规则
+	RuleSetID        *uint           `gorm:"index" json:"rule_set_id"`        // 引用的规则集，直接提交规则时为空
+	RuleSetVersion   *int            `json:"rule_set_version"`                // 导入时使用的规则集版本
+	Mapping          string          `gorm:"type:text" json:"mapping"`        // JSON 列映射（源表头 -> 逻辑字段 / ignore）
+	Dedup            string          `gorm:"type:text" json:"dedup"`          // JSON 去重配置，为空时导入后不去重
+	Columns          BatchColumns    `gorm:"type:jsonb" json:"columns"`       // 列目录（源文件的全部列）
+	SourceHeader     StringList      `gorm:"type:jsonb" json:"source_header"` // 源文件原始表头（含被忽略的列），与 Record.RawData 一一对应
+	RecoveryCount    int             `gorm:"default:0" json:"recovery_count"` // 被 Reaper 自动恢复的次数
+	Analytics        *BatchAnalytics `gorm:"type:jsonb" json:"-"`             // 分析结果缓存，通过 /analytics 接口获取
 }
 
 // Record represents a single row from the CSV
 type Record struct {
 	ID       uint   `gorm:"primaryKey" json:"id"`
-	BatchID  uint   `json:"batch_id"`
-	RowIndex int    `json:"row_index"` // Original row number in CSV
+	BatchID  uint   `gorm:"uniqueIndex:uniq_records_batch_row,priority:1" json:"batch_id"`
+	RowIndex int    `gorm:"uniqueIndex:uniq_records_batch_row,priority:2" json:"row_index"` // Original row number in CSV
 	Name     string `gorm:"size:255" json:"name"`
 	Phone    string `gorm:"size:50" json:"phone"`
 	Date     string `gorm:"size:50" json:"date"`
 
-	Address string `gorm:"size:255" json:"address"`
+	Address string `gorm:"type:text" json:"address"` // 原始地址，不截断
 
 	// Location Fields
 	Province string `gorm:"size:100" json:"province"`
 	City     string `gorm:"size:100" json:"city"`
 	District string `gorm:"size:100" json:"district"`
 
-	Status       string `gorm:"size:50" json:"status"` // "Clean" or "Error"
-	ErrorMessage string `gorm:"type:text" json:"error_message"`
-	RawData      string `gorm:"type:text" json:"raw_data"`
+	// Fields 保存源文件每一列清洗后的值，key 为 ImportBatch.Columns 中的列名
+	Fields JSONMap `gorm:"type:jsonb" json:"fields"`
+
+	Status       string      `gorm:"size:50" json:"status"`          // "Clean" or "Error"
+	ErrorMessage string      `gorm:"type:text" json:"error_message"` // 错误摘要（兼容旧记录与前端展示）
+	Errors       FieldErrors `gorm:"type:jsonb" json:"errors"`       // 结构化错误，旧记录为空
+	RawData      string      `gorm:"type:text" json:"-"`             // 原始行（JSON 数组，较长时 gzip 压缩），与批次 SourceHeader 对应
+	Raw          []RawCell   `gorm:"-" json:"raw,omitempty"`         // 解码后的原始行，仅在详情接口中填充
+
+	// 去重结果：同组记录共享 DupGroup（组内最早记录的 ID），被判定为重复的记录 DupOf 指向保留的记录
+	DupGroup *uint  `json:"dup_group,omitempty"`
+	DupOf    *uint  `json:"dup_of,omitempty"`
+	DupMatch string `gorm:"size:100" json:"dup_match,omitempty"` // 命中的去重键
 }
 
 // RecordVersion tracks changes to a record
@@ -67,6 +85,71 @@ type RecordVersion struct {
 	After     string    `gorm:"type:text" json:"after"`  // JSON string of new state
 	ChangedAt time.Time `json:"changed_at"`
 	Reason    string    `gorm:"size:255" json:"reason"` // Manual correction reason
+	// OperationID 由批量操作产生的版本共享同一个操作 ID，用于整体撤销；手动修改为空
+	OperationID *uint `gorm:"index" json:"operation_id,omitempty"`
+	// Raw 记录的原始行，历史接口返回时填充，便于对照源数据与各版本
+	Raw []RawCell `gorm:"-" json:"raw,omitempty"`
+}
+
+type OperationStatus string
+
+const (
+	OperationStatusPending   OperationStatus = "Pending"
+	OperationStatusRunning   OperationStatus = "Running"
+	OperationStatusCompleted OperationStatus = "Completed"
+	OperationStatusFailed    OperationStatus = "Failed"
+	OperationStatusUndone    OperationStatus = "Undone"
+)
+
+// BulkOperation 对一个批次中符合过滤条件的记录执行的批量修正（后台任务）
+type BulkOperation struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	BatchID     uint            `gorm:"index;not null" json:"batch_id"`
+	Type        string          `gorm:"size:50" json:"type"`     // find_replace / regex_replace / set_value / revalidate / reclean / dedup / undo
+	Column      string          `gorm:"size:255" json:"column"`  // 目标列（revalidate/undo 为空）
+	Params      string          `gorm:"type:text" json:"params"` // JSON 操作参数
+	Filter      string          `gorm:"type:text" json:"filter"` // JSON 记录过滤条件
+	Reason      string          `gorm:"size:255" json:"reason"`  // 写入版本记录的修改原因
+	UndoOf      *uint           `gorm:"index" json:"undo_of"`    // undo 操作撤销的原操作
+	Status      OperationStatus `gorm:"size:50;index" json:"status"`
+	Total       int             `json:"total"`            // 开始时匹配的记录数
+	Processed   int             `json:"processed"`        // 已处理的记录数
+	Changed     int             `json:"changed"`          // 实际发生变化的记录数
+	Skipped     int             `json:"skipped"`          // undo 时因之后又被修改而跳过的记录数
+	ToClean     int             `json:"to_clean"`         // 状态由 Error 变为 Clean 的记录数
+	ToError     int             `json:"to_error"`         // 状态由 Clean 变为 Error 的记录数
+	Preserved   int             `json:"preserved"`        // reclean 时保留手动修改、仅按新规则重新校验的记录数
+	Duplicates  int             `json:"duplicates"`       // dedup 时被判定为重复的记录数
+	DupGroups   int             `json:"duplicate_groups"` // dedup 时涉及本批次的重复组数
+	Error       string          `gorm:"type:text" json:"error"`
+	CreatedBy   string          `gorm:"size:100" json:"created_by"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	CompletedAt *time.Time      `json:"completed_at"`
+}
+
+// RuleSet 命名的清洗规则集，每次修改规则生成一个新版本
+type RuleSet struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	Name          string         `gorm:"size:255;not null" json:"name"`
+	Description   string         `gorm:"type:text" json:"description"`
+	Owner         string         `gorm:"size:100;index" json:"owner"`
+	Shared        bool           `gorm:"default:false" json:"shared"` // 共享后其他用户可查看与引用，只有所有者可修改
+	LatestVersion int            `json:"latest_version"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// RuleSetVersion 规则集的一个不可变版本
+type RuleSetVersion struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	RuleSetID uint      `gorm:"index;not null" json:"rule_set_id"`
+	Version   int       `gorm:"not null" json:"version"`
+	Rules     string    `gorm:"type:text" json:"rules"` // JSON 清洗规则，格式与 ImportBatch.Rules 相同
+	Comment   string    `gorm:"size:255" json:"comment"`
+	CreatedBy string    `gorm:"size:100" json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // User represents a system user (for auth)
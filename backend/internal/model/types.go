@@ -0,0 +1,130 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// JSONMap 以 JSONB 形式存储的 列名 -> 值 映射，用于保存任意结构的行数据
+type JSONMap map[string]string
+
+// Value 实现 driver.Valuer，写入时序列化为 JSON
+func (m JSONMap) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan 实现 sql.Scanner，读取时从 JSON 反序列化
+func (m *JSONMap) Scan(value interface{}) error {
+	return scanJSON(value, m)
+}
+
+// BatchColumn 描述批次中的一列（源文件表头及其类型）
+type BatchColumn struct {
+	Name  string `json:"name"`            // 源表头（去重后的唯一列名，同时作为 Record.Fields 的 key）
+	Index int    `json:"index"`           // 在源文件中的列序号，-1 为由规则计算的派生列
+	Field string `json:"field,omitempty"` // 映射到的逻辑字段：name/phone/date/address，未映射则为空
+	Type  string `json:"type"`            // 列类型：text/phone/date/address/number/email/idcard
+}
+
+// BatchColumns 批次级别的列目录
+type BatchColumns []BatchColumn
+
+// Value 实现 driver.Valuer
+func (c BatchColumns) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan 实现 sql.Scanner
+func (c *BatchColumns) Scan(value interface{}) error {
+	return scanJSON(value, c)
+}
+
+// StringList 以 JSONB 数组保存的字符串列表
+type StringList []string
+
+// Value 实现 driver.Valuer
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan 实现 sql.Scanner
+func (l *StringList) Scan(value interface{}) error {
+	return scanJSON(value, l)
+}
+
+// RawCell 原始行中的一个单元格及其源表头
+type RawCell struct {
+	Header string `json:"header"`
+	Value  string `json:"value"`
+}
+
+// FieldError 一条结构化校验错误
+type FieldError struct {
+	Column  string `json:"column"`          // 出错的列（源表头）；行级规则为其配置所在的列
+	Rule    string `json:"rule"`            // 策略类型：required/regex/length/date/row/db 等
+	Code    string `json:"code"`            // 稳定的错误代码，用于过滤与本地化；行级规则为规则名
+	Message string `json:"message"`         // 错误描述
+	Value   string `json:"value,omitempty"` // 触发错误的值
+}
+
+// FieldErrors 记录的全部校验错误，以 JSONB 数组保存
+type FieldErrors []FieldError
+
+// Value 实现 driver.Valuer
+func (e FieldErrors) Value() (driver.Value, error) {
+	if e == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan 实现 sql.Scanner
+func (e *FieldErrors) Scan(value interface{}) error {
+	return scanJSON(value, e)
+}
+
+// scanJSON 兼容驱动返回 []byte 或 string 的情况
+func scanJSON(value interface{}, dst interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		if len(v) == 0 {
+			return nil
+		}
+		return json.Unmarshal(v, dst)
+	case string:
+		if v == "" {
+			return nil
+		}
+		return json.Unmarshal([]byte(v), dst)
+	default:
+		return fmt.Errorf("unsupported JSON column type: %T", value)
+	}
+}
@@ -0,0 +1,7 @@
+// Package plugins 汇总自定义清洗策略。cmd/server 与 cmd/worker 都匿名导入本包，
+// 保证上传时校验规则与 worker 执行规则使用同一组策略。
+//
+// 添加自定义策略：在独立的包中通过 init 调用 service.RegisterStrategy，然后在此处匿名导入该包：
+//
+//	import _ "etl-tool/internal/plugins/employee"
+package plugins
@@ -2,7 +2,6 @@ package repository
 
 import (
 	"database/sql"
-	"etl-tool/internal/config"
 	"etl-tool/internal/model"
 	"fmt"
 	"log"
@@ -11,6 +10,8 @@ import (
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	gormPostgres "gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -18,53 +19,26 @@ import (
 
 var DB *gorm.DB
 
-// DropSearchIndexes 暂时移除索引以加速大文件写入
-func DropSearchIndexes() {
-	log.Println("[Perf] Dropping all indexes for massive insertion...")
-	DB.Exec("DROP INDEX IF EXISTS idx_records_fast_phone")
-	DB.Exec("DROP INDEX IF EXISTS idx_records_fast_name")
-	DB.Exec("DROP INDEX IF EXISTS idx_records_batch_row")
-	// 额外清理可能残留的旧名称索引
-	DB.Exec("DROP INDEX IF EXISTS idx_records_fast_batch_row")
-}
-
-// RebuildSearchIndexes 重建所有索引（在入库完成后执行，效率远高于边写边维护）
-func RebuildSearchIndexes() {
-	log.Println("[Perf] Rebuilding all strategic indexes...")
-
-	// 关键：创建索引前先降低 maintenance_work_mem，避免 OOM
-	// 根据配置文件动态设置，开发机可以高一些，2C2G 生产环境可设为 32MB
-	mem := config.AppConfig.Database.MaintenanceWorkMem
-	if mem == "" {
-		mem = "32MB"
-	}
-	DB.Exec(fmt.Sprintf("SET maintenance_work_mem = '%s'", mem))
-
-	sqls := []struct{ name, sql string }{
-		{"Search Phone", "CREATE INDEX IF NOT EXISTS idx_records_fast_phone ON records (batch_id, phone varchar_pattern_ops, row_index)"},
-		{"Search Name", "CREATE INDEX IF NOT EXISTS idx_records_fast_name ON records (batch_id, name varchar_pattern_ops, row_index)"},
-		{"Batch Pagination", "CREATE INDEX IF NOT EXISTS idx_records_batch_row ON records (batch_id, row_index)"},
-	}
-	for _, item := range sqls {
-		start := time.Now()
-		if err := DB.Exec(item.sql).Error; err != nil {
-			log.Printf("[Perf] %s index failed: %v (non-fatal, search may be slower)", item.name, err)
-		} else {
-			log.Printf("[Perf] %s indexed in %v", item.name, time.Since(start))
-		}
-	}
-}
-
 func InitDB(dsn string) error {
 	var err error
 
 	// 1. Connect using GORM, with SILENT logger for performance and clean console
-	DB, err = gorm.Open(gormPostgres.Open(dsn), &gorm.Config{
+	// 会话参数通过连接启动参数下发，连接池中的每个连接都生效（SET 只影响执行它的单个连接）
+	mode := DurabilityMode()
+	pgCfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return fmt.Errorf("invalid database dsn: %w", err)
+	}
+	for k, v := range connRuntimeParams(mode) {
+		pgCfg.RuntimeParams[k] = v
+	}
+	DB, err = gorm.Open(gormPostgres.New(gormPostgres.Config{Conn: stdlib.OpenDB(*pgCfg)}), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
+	log.Printf("[Init] Durability mode: %s", mode)
 
 	// 2. Run Database Migrations (golang-migrate)
 	log.Println("Step 1/2: Checking base migrations...")
@@ -76,7 +50,7 @@ func InitDB(dsn string) error {
 	log.Println("Step 2/3: Checking Schema (Base Tables)...")
 	start := time.Now()
 	// 先迁移小表，确保基础功能立即可用
-	if err := DB.AutoMigrate(&model.User{}, &model.ImportBatch{}, &model.RecordVersion{}); err != nil {
+	if err := DB.AutoMigrate(&model.User{}, &model.ImportBatch{}, &model.RecordVersion{}, &model.BulkOperation{}, &model.RuleSet{}, &model.RuleSetVersion{}); err != nil {
 		return fmt.Errorf("base automigrate failed: %w", err)
 	}
 
@@ -96,32 +70,9 @@ func InitDB(dsn string) error {
 	sqlDB.SetMaxIdleConns(50)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
-	// 检查并设置 UNLOGGED
-	var persistence string
-	DB.Raw("SELECT relpersistence FROM pg_class WHERE relname = 'records'").Scan(&persistence)
-	if persistence == "p" {
-		log.Println("[Perf] Speed Mode: Converting records to UNLOGGED (one-time setup)...")
-		if err := DB.Exec("ALTER TABLE records SET UNLOGGED").Error; err != nil {
-			log.Printf("Warning: UNLOGGED conversion skipped: %v", err)
-		}
-	}
-
-	tuningSQLs := []struct {
-		name string
-		sql  string
-	}{
-		{"Disable Sync Commit", "SET synchronous_commit TO OFF"},
-		{"Expand Work Mem", "SET work_mem = '64MB'"},
-		{"Expand Maint Work Mem", fmt.Sprintf("SET maintenance_work_mem = '%s'", config.AppConfig.Database.MaintenanceWorkMem)},
-	}
-
-	for _, item := range tuningSQLs {
-		sSub := time.Now()
-		if err := DB.Exec(item.sql).Error; err != nil {
-			log.Printf("Note (%s): %v", item.name, err)
-		} else {
-			log.Printf("[Init] %s optimized in %v.", item.name, time.Since(sSub))
-		}
+	// 按持久化模式转换已有分区（LOGGED/UNLOGGED），新分区在 EnsureBatchPartition 中按模式创建
+	if err := ApplyDurability(); err != nil {
+		return fmt.Errorf("durability conversion failed: %w", err)
 	}
 
 	// 5. 创建符合导论作业要求的逻辑视图
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"etl-tool/internal/config"
+)
+
+// 持久化模式
+const (
+	// DurabilitySpeed 分区为 UNLOGGED、异步提交：写入最快，但 PostgreSQL 崩溃后会清空所有 UNLOGGED 分区
+	DurabilitySpeed = "speed"
+	// DurabilitySafe 分区为 LOGGED、同步提交：崩溃后已提交的数据不会丢失
+	DurabilitySafe = "safe"
+)
+
+// DurabilityMode 返回配置的持久化模式，未配置或无法识别时使用 safe
+func DurabilityMode() string {
+	if config.AppConfig != nil && config.AppConfig.Database.Durability == DurabilitySpeed {
+		return DurabilitySpeed
+	}
+	return DurabilitySafe
+}
+
+// connRuntimeParams 每个连接建立时设置的会话参数（SET 只对执行它的那一个连接生效，连接池中必须逐个设置）
+func connRuntimeParams(mode string) map[string]string {
+	params := map[string]string{
+		"work_mem":           "64MB",
+		"synchronous_commit": "on",
+	}
+	if config.AppConfig != nil && config.AppConfig.Database.MaintenanceWorkMem != "" {
+		params["maintenance_work_mem"] = config.AppConfig.Database.MaintenanceWorkMem
+	}
+	if mode == DurabilitySpeed {
+		params["synchronous_commit"] = "off"
+	}
+	return params
+}
+
+// partitionPersistence 当前模式下分区应有的 relpersistence（p: LOGGED, u: UNLOGGED）
+func partitionPersistence(mode string) string {
+	if mode == DurabilitySpeed {
+		return "u"
+	}
+	return "p"
+}
+
+type partitionInfo struct {
+	Name        string
+	Persistence string
+}
+
+func listPartitions() ([]partitionInfo, error) {
+	var parts []partitionInfo
+	err := DB.Raw(`SELECT c.relname AS name, c.relpersistence AS persistence
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = 'records'
+		ORDER BY c.relname`).Scan(&parts).Error
+	return parts, err
+}
+
+// setPartitionPersistence 将分区转换为指定模式的持久化方式。SET LOGGED 会重写整张表并写入 WAL，大分区需要一些时间
+func setPartitionPersistence(name string, mode string) error {
+	stmt := "SET LOGGED"
+	if mode == DurabilitySpeed {
+		stmt = "SET UNLOGGED"
+	}
+	start := time.Now()
+	if err := DB.Exec(fmt.Sprintf("ALTER TABLE %s %s", name, stmt)).Error; err != nil {
+		return fmt.Errorf("failed to %s %s: %w", stmt, name, err)
+	}
+	log.Printf("[Durability] %s %s in %v", name, stmt, time.Since(start))
+	return nil
+}
+
+// ApplyDurability 将已有分区转换为当前模式要求的 LOGGED/UNLOGGED（切换模式后的迁移路径，启动时执行）
+func ApplyDurability() error {
+	mode := DurabilityMode()
+	want := partitionPersistence(mode)
+
+	parts, err := listPartitions()
+	if err != nil {
+		return err
+	}
+	converted := 0
+	for _, p := range parts {
+		if p.Persistence == want {
+			continue
+		}
+		if err := setPartitionPersistence(p.Name, mode); err != nil {
+			return err
+		}
+		converted++
+	}
+	if converted > 0 {
+		log.Printf("[Durability] Converted %d partition(s) to %s mode", converted, mode)
+	}
+	return nil
+}
+
+// DurabilityInfo 当前持久化状态，用于健康检查
+type DurabilityInfo struct {
+	Mode               string `json:"mode"`
+	SynchronousCommit  string `json:"synchronous_commit"`
+	LoggedPartitions   int    `json:"logged_partitions"`
+	UnloggedPartitions int    `json:"unlogged_partitions"`
+	PendingConversions int    `json:"pending_conversions"` // 与当前模式不一致、尚未转换的分区数
+}
+
+// GetDurabilityInfo 查询数据库中实际生效的持久化设置
+func GetDurabilityInfo() (DurabilityInfo, error) {
+	info := DurabilityInfo{Mode: DurabilityMode()}
+	if err := DB.Raw("SHOW synchronous_commit").Scan(&info.SynchronousCommit).Error; err != nil {
+		return info, err
+	}
+
+	parts, err := listPartitions()
+	if err != nil {
+		return info, err
+	}
+	want := partitionPersistence(info.Mode)
+	for _, p := range parts {
+		if p.Persistence == "u" {
+			info.UnloggedPartitions++
+		} else {
+			info.LoggedPartitions++
+		}
+		if p.Persistence != want {
+			info.PendingConversions++
+		}
+	}
+	return info, nil
+}
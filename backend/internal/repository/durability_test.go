@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"testing"
+
+	"etl-tool/internal/config"
+)
+
+func TestDurabilitySettings(t *testing.T) {
+	defer func(old *config.Config) { config.AppConfig = old }(config.AppConfig)
+
+	tests := []struct {
+		name        string
+		configured  string
+		wantMode    string
+		wantSync    string
+		wantPersist string
+	}{
+		{"speed", "speed", DurabilitySpeed, "off", "u"},
+		{"safe", "safe", DurabilitySafe, "on", "p"},
+		{"empty defaults to safe", "", DurabilitySafe, "on", "p"},
+		{"unknown defaults to safe", "fast", DurabilitySafe, "on", "p"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AppConfig = &config.Config{}
+			config.AppConfig.Database.Durability = tt.configured
+			config.AppConfig.Database.MaintenanceWorkMem = "32MB"
+
+			mode := DurabilityMode()
+			if mode != tt.wantMode {
+				t.Fatalf("DurabilityMode() = %q, want %q", mode, tt.wantMode)
+			}
+			params := connRuntimeParams(mode)
+			if params["synchronous_commit"] != tt.wantSync {
+				t.Errorf("synchronous_commit = %q, want %q", params["synchronous_commit"], tt.wantSync)
+			}
+			if params["maintenance_work_mem"] != "32MB" {
+				t.Errorf("maintenance_work_mem = %q, want 32MB", params["maintenance_work_mem"])
+			}
+			if got := partitionPersistence(mode); got != tt.wantPersist {
+				t.Errorf("partitionPersistence() = %q, want %q", got, tt.wantPersist)
+			}
+		})
+	}
+}
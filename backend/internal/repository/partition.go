@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"etl-tool/internal/config"
+
+	"gorm.io/gorm"
+)
+
+// records 按 batch_id 做 LIST 分区，每个批次一个分区 records_b<batch_id>。
+// 搜索索引建在分区上而不是父表上，因此大批量导入只需删除/重建自己分区的索引，不影响其他批次。
+
+// PartitionName 返回批次对应的分区表名
+func PartitionName(batchID uint) string {
+	return fmt.Sprintf("records_b%d", batchID)
+}
+
+// EnsureBatchPartition 创建批次的分区（已存在时忽略）
+func EnsureBatchPartition(batchID uint) error {
+	name := PartitionName(batchID)
+	sql := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF records FOR VALUES IN (%d)", name, batchID)
+	if err := DB.Exec(sql).Error; err != nil {
+		return fmt.Errorf("failed to create partition %s: %w", name, err)
+	}
+
+	// 分区持久化方式跟随当前模式：新分区为空，此时转换几乎没有开销
+	mode := DurabilityMode()
+	var persistence string
+	DB.Raw("SELECT relpersistence FROM pg_class WHERE relname = ?", name).Scan(&persistence)
+	if persistence != "" && persistence != partitionPersistence(mode) {
+		if err := setPartitionPersistence(name, mode); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	return nil
+}
+
+// DropBatchPartition 删除批次的分区及其全部记录（db 可以是事务）
+func DropBatchPartition(db *gorm.DB, batchID uint) error {
+	return db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", PartitionName(batchID))).Error
+}
+
+// batchIndexes 每个分区上的搜索索引（batch_id 在分区内恒定，不再作为索引前缀）
+func batchIndexes(batchID uint) []struct{ name, sql string } {
+	p := PartitionName(batchID)
+	return []struct{ name, sql string }{
+		{p + "_phone", fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_phone ON %s (phone varchar_pattern_ops, row_index)", p, p)},
+		{p + "_name", fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_name ON %s (name varchar_pattern_ops, row_index)", p, p)},
+		{p + "_errors", fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_errors ON %s USING GIN (errors jsonb_path_ops)", p, p)},
+		{p + "_dup", fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_dup ON %s (dup_group, row_index) WHERE dup_group IS NOT NULL", p, p)},
+	}
+}
+
+// DropBatchIndexes 暂时移除批次分区的搜索索引以加速大文件写入。
+// 唯一索引 (batch_id, row_index) 继承自父表，是幂等写入的依据，始终保留
+func DropBatchIndexes(batchID uint) {
+	log.Printf("[Perf] Dropping search indexes of %s for massive insertion...", PartitionName(batchID))
+	for _, idx := range batchIndexes(batchID) {
+		DB.Exec(fmt.Sprintf("DROP INDEX IF EXISTS %s", idx.name))
+	}
+}
+
+// BuildBatchIndexes 重建批次分区的搜索索引（在入库完成后执行，效率远高于边写边维护）
+func BuildBatchIndexes(batchID uint) {
+	log.Printf("[Perf] Rebuilding search indexes of %s...", PartitionName(batchID))
+
+	// 关键：创建索引前先降低 maintenance_work_mem，避免 OOM
+	// 根据配置文件动态设置，开发机可以高一些，2C2G 生产环境可设为 32MB
+	mem := config.AppConfig.Database.MaintenanceWorkMem
+	if mem == "" {
+		mem = "32MB"
+	}
+	DB.Exec(fmt.Sprintf("SET maintenance_work_mem = '%s'", mem))
+
+	for _, idx := range batchIndexes(batchID) {
+		start := time.Now()
+		if err := DB.Exec(idx.sql).Error; err != nil {
+			log.Printf("[Perf] Index %s failed: %v (non-fatal, search may be slower)", idx.name, err)
+		} else {
+			log.Printf("[Perf] Index %s built in %v", idx.name, time.Since(start))
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"container/heap"
+	"errors"
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+	"time"
+
+	"etl-tool/internal/model"
+)
+
+// 批次分析：导入时由每个 Saver 对已提交的记录增量统计，结束后合并；
+// 恢复过的批次或旧批次没有完整的增量结果，在首次查询时对分区做一次聚合扫描，结果都缓存在 ImportBatch.Analytics。
+
+const (
+	analyticsTopN       = 10   // 每列返回的错误值条数
+	analyticsValueSlots = 100  // 每列错误值排行跟踪的候选数
+	analyticsCitySlots  = 1000 // 城市分布跟踪的候选数（脏地址可能解析出大量不同的城市）
+	analyticsTopCities  = 50
+	analyticsSourceRun  = "import"
+	analyticsSourceScan = "scan"
+	hllPrecision        = 12 // 4096 个寄存器，标准误差约 1.04/sqrt(4096) ≈ 1.6%
+	hllRegisters        = 1 << hllPrecision
+)
+
+// ErrAnalyticsNotReady 批次仍在处理中，分析结果尚不可用
+var ErrAnalyticsNotReady = errors.New("analytics are available once the batch has finished processing")
+
+// analyticsSeed 进程内共享，保证不同 Saver 的 HyperLogLog 可以合并
+var analyticsSeed = maphash.MakeSeed()
+
+// hyperLogLog 基数估计
+type hyperLogLog struct {
+	reg [hllRegisters]uint8
+}
+
+func (h *hyperLogLog) add(v string) {
+	x := maphash.String(analyticsSeed, v)
+	idx := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.reg[idx] {
+		h.reg[idx] = rank
+	}
+}
+
+func (h *hyperLogLog) merge(o *hyperLogLog) {
+	for i, r := range o.reg {
+		if r > h.reg[i] {
+			h.reg[i] = r
+		}
+	}
+}
+
+func (h *hyperLogLog) estimate() uint64 {
+	m := float64(hllRegisters)
+	sum, zeros := 0.0, 0
+	for _, r := range h.reg {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	est := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// 小基数时使用线性计数修正
+	if est <= 2.5*m && zeros > 0 {
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(est + 0.5)
+}
+
+// topK Space-Saving 近似排行：候选数已满时替换计数最小的值，热门值的计数误差不超过被替换值的计数。
+// 候选按计数组成最小堆，替换与计数增加都是 O(log slots)
+type topK struct {
+	slots int
+	index map[string]*topKItem
+	heap  topKHeap
+}
+
+type topKItem struct {
+	value string
+	count int
+	pos   int // 在堆中的下标
+}
+
+// topKHeap 按计数排列的最小堆，实现 heap.Interface
+type topKHeap []*topKItem
+
+func (h topKHeap) Len() int           { return len(h) }
+func (h topKHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h topKHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos, h[j].pos = i, j
+}
+func (h *topKHeap) Push(x any) {
+	item := x.(*topKItem)
+	item.pos = len(*h)
+	*h = append(*h, item)
+}
+func (h *topKHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+func newTopK(slots int) *topK {
+	return &topK{slots: slots, index: make(map[string]*topKItem)}
+}
+
+func (t *topK) add(v string, n int) {
+	if item, ok := t.index[v]; ok {
+		item.count += n
+		heap.Fix(&t.heap, item.pos)
+		return
+	}
+	if len(t.heap) < t.slots {
+		item := &topKItem{value: v, count: n}
+		heap.Push(&t.heap, item)
+		t.index[v] = item
+		return
+	}
+	// 复用计数最小的候选：继承其计数后加上本次计数
+	item := t.heap[0]
+	delete(t.index, item.value)
+	item.value = v
+	item.count += n
+	t.index[v] = item
+	heap.Fix(&t.heap, 0)
+}
+
+func (t *topK) merge(o *topK) {
+	for _, item := range o.heap {
+		t.add(item.value, item.count)
+	}
+}
+
+func (t *topK) top(n int) []model.ValueCount {
+	out := make([]model.ValueCount, 0, len(t.heap))
+	for _, item := range t.heap {
+		out = append(out, model.ValueCount{Value: item.value, Count: item.count})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Value < out[j].Value
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+type columnStats struct {
+	empty    int
+	distinct hyperLogLog
+	values   *topK // 出错的值
+}
+
+type errorKey struct {
+	column, rule, code string
+}
+
+// analyticsCollector 单个协程内使用的统计器，不加锁；多个统计器通过 merge 汇总
+type analyticsCollector struct {
+	schema    *batchSchema
+	position  map[string]int // 列名 -> cols 下标
+	rows      int
+	cols      []*columnStats
+	errors    map[errorKey]int
+	provinces *topK
+	cities    *topK // key: 省份 + "\x00" + 城市
+}
+
+func newAnalyticsCollector(schema *batchSchema) *analyticsCollector {
+	c := &analyticsCollector{
+		schema:    schema,
+		position:  make(map[string]int, len(schema.Columns)),
+		cols:      make([]*columnStats, len(schema.Columns)),
+		errors:    make(map[errorKey]int),
+		provinces: newTopK(analyticsCitySlots),
+		cities:    newTopK(analyticsCitySlots),
+	}
+	for i, col := range schema.Columns {
+		c.position[col.Name] = i
+		c.cols[i] = &columnStats{values: newTopK(analyticsValueSlots)}
+	}
+	return c
+}
+
+func (c *analyticsCollector) add(rec *model.Record) {
+	c.rows++
+	for i, col := range c.schema.Columns {
+		v := c.schema.valueOf(rec, col)
+		if strings.TrimSpace(v) == "" {
+			c.cols[i].empty++
+			continue
+		}
+		c.cols[i].distinct.add(v)
+	}
+	for _, e := range rec.Errors {
+		c.errors[errorKey{e.Column, e.Rule, e.Code}]++
+		if i, ok := c.position[e.Column]; ok && e.Value != "" {
+			c.cols[i].values.add(e.Value, 1)
+		}
+	}
+	if rec.Province != "" {
+		c.provinces.add(rec.Province, 1)
+	}
+	if rec.City != "" {
+		c.cities.add(rec.Province+"\x00"+rec.City, 1)
+	}
+}
+
+func (c *analyticsCollector) merge(o *analyticsCollector) {
+	c.rows += o.rows
+	for i, cs := range o.cols {
+		c.cols[i].empty += cs.empty
+		c.cols[i].distinct.merge(&cs.distinct)
+		c.cols[i].values.merge(cs.values)
+	}
+	for k, n := range o.errors {
+		c.errors[k] += n
+	}
+	c.provinces.merge(o.provinces)
+	c.cities.merge(o.cities)
+}
+
+func (c *analyticsCollector) result(source string) *model.BatchAnalytics {
+	a := &model.BatchAnalytics{
+		Rows:       c.rows,
+		Source:     source,
+		ComputedAt: time.Now(),
+		Errors:     make([]model.ErrorCount, 0, len(c.errors)),
+		Columns:    make([]model.ColumnProfile, len(c.cols)),
+		Provinces:  c.provinces.top(analyticsCitySlots),
+		Cities:     make([]model.CityCount, 0, analyticsTopCities),
+	}
+	for k, n := range c.errors {
+		a.Errors = append(a.Errors, model.ErrorCount{Column: k.column, Rule: k.rule, Code: k.code, Count: n})
+	}
+	sort.Slice(a.Errors, func(i, j int) bool {
+		if a.Errors[i].Count != a.Errors[j].Count {
+			return a.Errors[i].Count > a.Errors[j].Count
+		}
+		return a.Errors[i].Column+a.Errors[i].Code < a.Errors[j].Column+a.Errors[j].Code
+	})
+
+	for i, col := range c.schema.Columns {
+		cs := c.cols[i]
+		p := model.ColumnProfile{
+			Column:           col.Name,
+			Empty:            cs.empty,
+			DistinctEstimate: cs.distinct.estimate(),
+			TopErrorValues:   cs.values.top(analyticsTopN),
+		}
+		if c.rows > 0 {
+			p.EmptyRate = float64(cs.empty) / float64(c.rows)
+		}
+		a.Columns[i] = p
+	}
+
+	for _, vc := range c.cities.top(analyticsTopCities) {
+		province, city, _ := strings.Cut(vc.Value, "\x00")
+		a.Cities = append(a.Cities, model.CityCount{Province: province, City: city, Count: vc.Count})
+	}
+	return a
+}
+
+// mergeCollectors 汇总各 Saver 的统计器
+func mergeCollectors(collectors []*analyticsCollector) *analyticsCollector {
+	if len(collectors) == 0 {
+		return nil
+	}
+	total := collectors[0]
+	for _, c := range collectors[1:] {
+		total.merge(c)
+	}
+	return total
+}
+
+// GetBatchAnalytics 返回批次分析结果：优先使用缓存，没有缓存或 refresh 时对批次分区做一次聚合扫描。
+// 只有已完成批次的结果会被缓存；导入后的手动修正需要 refresh 才会反映到结果中
+func (s *CleanerService) GetBatchAnalytics(id string, refresh bool) (*model.BatchAnalytics, error) {
+	var batch model.ImportBatch
+	if err := s.DB.First(&batch, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	if batch.Analytics != nil && !refresh {
+		return batch.Analytics, nil
+	}
+	switch batch.Status {
+	case model.BatchStatusPending, model.BatchStatusProcessing, model.BatchStatusIndexing:
+		return nil, ErrAnalyticsNotReady
+	}
+
+	analytics, err := s.scanBatchAnalytics(&batch)
+	if err != nil {
+		return nil, err
+	}
+	if batch.Status == model.BatchStatusCompleted {
+		s.DB.Model(&model.ImportBatch{}).Where("id = ?", batch.ID).Update("analytics", analytics)
+	}
+	return analytics, nil
+}
+
+// scanBatchAnalytics 流式读取批次的全部记录并统计
+func (s *CleanerService) scanBatchAnalytics(batch *model.ImportBatch) (*model.BatchAnalytics, error) {
+	collector := newAnalyticsCollector(schemaFromBatch(batch, NewRuleEngine()))
+	rows, err := s.DB.Model(&model.Record{}).
+		Select("name", "phone", "date", "address", "province", "city", "district", "fields", "errors").
+		Where("batch_id = ?", batch.ID).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rec model.Record
+		if err := s.DB.ScanRows(rows, &rec); err != nil {
+			return nil, err
+		}
+		collector.add(&rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return collector.result(analyticsSourceScan), nil
+}
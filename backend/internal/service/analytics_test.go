@@ -0,0 +1,136 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"etl-tool/internal/model"
+)
+
+func TestHyperLogLog_Estimate(t *testing.T) {
+	tests := []struct {
+		distinct int
+		maxError float64
+	}{
+		{0, 0},
+		{100, 0.05},
+		{10000, 0.05},
+		{200000, 0.05},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.distinct), func(t *testing.T) {
+			// 两个分片各加入一半（有重叠），合并后应得到整体的估计
+			var a, b hyperLogLog
+			for i := 0; i < tt.distinct; i++ {
+				v := fmt.Sprintf("value-%d", i)
+				if i%2 == 0 {
+					a.add(v)
+				} else {
+					b.add(v)
+				}
+				a.add(fmt.Sprintf("value-%d", i/2))
+			}
+			a.merge(&b)
+
+			got := float64(a.estimate())
+			if tt.distinct == 0 {
+				if got != 0 {
+					t.Errorf("estimate() = %v, want 0", got)
+				}
+				return
+			}
+			if rel := math.Abs(got-float64(tt.distinct)) / float64(tt.distinct); rel > tt.maxError {
+				t.Errorf("estimate() = %v, want %d ± %.0f%%", got, tt.distinct, tt.maxError*100)
+			}
+		})
+	}
+}
+
+func TestTopK_KeepsHeavyHitters(t *testing.T) {
+	tk := newTopK(5)
+	for i := 0; i < 1000; i++ {
+		tk.add("hot", 1)
+		tk.add(fmt.Sprintf("noise-%d", i), 1)
+		if i%2 == 0 {
+			tk.add("warm", 1)
+		}
+	}
+	top := tk.top(2)
+	if len(top) != 2 || top[0].Value != "hot" || top[1].Value != "warm" {
+		t.Fatalf("top(2) = %+v, want hot then warm", top)
+	}
+	if top[0].Count < 1000 {
+		t.Errorf("hot count = %d, want >= 1000 (Space-Saving never undercounts)", top[0].Count)
+	}
+}
+
+func TestTopK_ReplacesMinimumAndMerges(t *testing.T) {
+	a := newTopK(3)
+	a.add("x", 5)
+	a.add("y", 2)
+	a.add("z", 4)
+	a.add("w", 1) // 替换计数最小的 y，继承其计数
+	want := []model.ValueCount{{Value: "x", Count: 5}, {Value: "z", Count: 4}, {Value: "w", Count: 3}}
+	if got := a.top(3); !reflect.DeepEqual(got, want) {
+		t.Fatalf("top(3) = %+v, want %+v", got, want)
+	}
+
+	b := newTopK(3)
+	b.add("z", 10)
+	a.merge(b)
+	if got := a.top(1); got[0].Value != "z" || got[0].Count != 14 {
+		t.Errorf("merged top(1) = %+v, want z with 14", got)
+	}
+}
+
+func TestAnalyticsCollector_MergedResult(t *testing.T) {
+	schema := buildSchema(model.BatchColumns{
+		{Name: "姓名", Index: 0, Field: FieldName},
+		{Name: "手机", Index: 1, Field: FieldPhone},
+	}, NewRuleEngine())
+
+	phoneErr := func(v string) model.FieldErrors {
+		return model.FieldErrors{{Column: "手机", Rule: "regex", Code: ErrCodePattern, Value: v}}
+	}
+	records := []model.Record{
+		{Fields: model.JSONMap{"姓名": "张三", "手机": "13800138000"}, Province: "北京市", City: "北京市"},
+		{Fields: model.JSONMap{"姓名": "李四", "手机": "123"}, Errors: phoneErr("123"), Province: "广东省", City: "深圳市"},
+		{Fields: model.JSONMap{"姓名": "", "手机": "123"}, Errors: phoneErr("123"), Province: "广东省", City: "广州市"},
+		{Fields: model.JSONMap{"姓名": "王五", "手机": "abc"}, Errors: phoneErr("abc"), Province: "广东省", City: "深圳市"},
+	}
+
+	// 模拟两个 Saver 各自统计后合并
+	a, b := newAnalyticsCollector(schema), newAnalyticsCollector(schema)
+	for i := range records {
+		if i%2 == 0 {
+			a.add(&records[i])
+		} else {
+			b.add(&records[i])
+		}
+	}
+	got := mergeCollectors([]*analyticsCollector{a, b}).result(analyticsSourceRun)
+
+	if got.Rows != 4 || got.Source != analyticsSourceRun {
+		t.Errorf("Rows = %d, Source = %s", got.Rows, got.Source)
+	}
+	if len(got.Errors) != 1 || got.Errors[0] != (model.ErrorCount{Column: "手机", Rule: "regex", Code: ErrCodePattern, Count: 3}) {
+		t.Errorf("Errors = %+v", got.Errors)
+	}
+
+	name, phone := got.Columns[0], got.Columns[1]
+	if name.Empty != 1 || name.EmptyRate != 0.25 || name.DistinctEstimate != 3 {
+		t.Errorf("name profile = %+v", name)
+	}
+	if phone.DistinctEstimate != 3 || len(phone.TopErrorValues) != 2 || phone.TopErrorValues[0] != (model.ValueCount{Value: "123", Count: 2}) {
+		t.Errorf("phone profile = %+v", phone)
+	}
+
+	if got.Provinces[0] != (model.ValueCount{Value: "广东省", Count: 3}) {
+		t.Errorf("Provinces = %+v", got.Provinces)
+	}
+	if got.Cities[0] != (model.CityCount{Province: "广东省", City: "深圳市", Count: 2}) {
+		t.Errorf("Cities = %+v", got.Cities)
+	}
+}
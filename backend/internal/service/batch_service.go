@@ -2,6 +2,7 @@ package service
 
 import (
 	"etl-tool/internal/model"
+	"etl-tool/internal/repository"
 	"fmt"
 	"log"
 	"os"
@@ -10,12 +11,16 @@ import (
 )
 
 // CreateBatch 创建一个新的导入批次记录
-func (s *CleanerService) CreateBatch(filename string, createdBy string, hash string, path string, rules string) (*model.ImportBatch, error) {
+func (s *CleanerService) CreateBatch(filename string, createdBy string, hash string, path string, rules RuleSource, mapping string, dedup string) (*model.ImportBatch, error) {
 	batch := &model.ImportBatch{
 		OriginalFilename: filename,
 		FileHash:         hash,
 		FilePath:         path,
-		Rules:            rules,
+		Rules:            rules.Rules,
+		RuleSetID:        rules.RuleSetID,
+		RuleSetVersion:   rules.RuleSetVersion,
+		Mapping:          mapping,
+		Dedup:            dedup,
 		Status:           model.BatchStatusPending,
 		CreatedBy:        createdBy,
 	}
@@ -24,7 +29,7 @@ func (s *CleanerService) CreateBatch(filename string, createdBy string, hash str
 }
 
 // CreateBatchFromHash 快速创建批次（针对已存在物理文件的情况）
-func (s *CleanerService) CreateBatchFromHash(filename string, createdBy string, hash string, rules string) (*model.ImportBatch, error) {
+func (s *CleanerService) CreateBatchFromHash(filename string, createdBy string, hash string, rules RuleSource, mapping string, dedup string) (*model.ImportBatch, error) {
 	var existing model.ImportBatch
 	if err := s.DB.Where("file_hash = ?", hash).First(&existing).Error; err != nil {
 		return nil, fmt.Errorf("physical file not found for hash: %s", hash)
@@ -34,7 +39,11 @@ func (s *CleanerService) CreateBatchFromHash(filename string, createdBy string,
 		OriginalFilename: filename,
 		FileHash:         hash,
 		FilePath:         existing.FilePath, // 复用物理路径
-		Rules:            rules,
+		Rules:            rules.Rules,
+		RuleSetID:        rules.RuleSetID,
+		RuleSetVersion:   rules.RuleSetVersion,
+		Mapping:          mapping,
+		Dedup:            dedup,
 		Status:           model.BatchStatusPending,
 		CreatedBy:        createdBy,
 	}
@@ -90,8 +99,13 @@ func (s *CleanerService) DeleteBatch(id uint) error {
 			return err
 		}
 
-		// 删除记录 (Record)
-		if err := tx.Where("batch_id = ?", id).Delete(&model.Record{}).Error; err != nil {
+		// 删除批量操作记录
+		if err := tx.Where("batch_id = ?", id).Delete(&model.BulkOperation{}).Error; err != nil {
+			return err
+		}
+
+		// 删除记录 (Record)：直接删除批次分区，无需逐行 DELETE
+		if err := repository.DropBatchPartition(tx, id); err != nil {
 			return err
 		}
 
@@ -0,0 +1,552 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"etl-tool/internal/model"
+	"etl-tool/internal/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 批量操作类型
+const (
+	OpFindReplace  = "find_replace"  // 将列中的 find 全部替换为 replace
+	OpRegexReplace = "regex_replace" // 正则替换，replace 中可用 $1 引用分组
+	OpSetValue     = "set_value"     // 将列设置为 value
+	OpRevalidate   = "revalidate"    // 按规则集重新清洗整行（可选 rules 覆盖批次规则）
+	OpReclean      = "reclean"       // 以新规则集从源数据重新清洗整个批次，见 reclean.go
+	OpDedup        = "dedup"         // 按去重配置标记重复记录，见 dedup.go
+	OpUndo         = "undo"          // 撤销另一个批量操作
+)
+
+// bulkPageSize 每页处理的记录数，每页一个事务
+const bulkPageSize = 500
+
+// 执行中的操作定期刷新 updated_at 作为心跳，超过 bulkStaleAfter 未刷新的未结束操作视为已中断
+const (
+	bulkHeartbeatInterval = 30 * time.Second
+	bulkStaleAfter        = 3 * bulkHeartbeatInterval
+)
+
+var (
+	ErrOperationInProgress = errors.New("another bulk operation is running on this batch")
+	ErrBatchNotSettled     = errors.New("batch is still being processed")
+)
+
+// BulkParams 批量操作参数
+type BulkParams struct {
+	Find    string `json:"find,omitempty"`
+	Replace string `json:"replace,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	Value   string `json:"value,omitempty"`
+
+	// revalidate / reclean 使用的规则；指定 rule_set_id 时创建操作时解析为该版本的规则
+	RuleSource
+
+	OverrideManual bool        `json:"override_manual,omitempty"` // reclean 时覆盖手动修改
+	Previous       *RuleSource `json:"previous,omitempty"`        // reclean 前的批次规则，撤销时恢复
+
+	Dedup *DedupConfig `json:"dedup,omitempty"` // dedup 使用的去重配置
+}
+
+// BulkRequest 创建批量操作的请求
+type BulkRequest struct {
+	Type   string       `json:"type" binding:"required"`
+	Column string       `json:"column"`
+	Params BulkParams   `json:"params"`
+	Filter RecordFilter `json:"filter"`
+	Reason string       `json:"reason"`
+}
+
+// transform 返回作用于单个值的变换；revalidate 不修改值，返回 nil
+func (r *BulkRequest) transform() (func(string) string, error) {
+	switch r.Type {
+	case OpFindReplace:
+		if r.Params.Find == "" {
+			return nil, fmt.Errorf("find is required")
+		}
+		return func(v string) string { return strings.ReplaceAll(v, r.Params.Find, r.Params.Replace) }, nil
+	case OpRegexReplace:
+		re, err := regexp.Compile(r.Params.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		return func(v string) string { return re.ReplaceAllString(v, r.Params.Replace) }, nil
+	case OpSetValue:
+		return func(string) string { return r.Params.Value }, nil
+	case OpRevalidate:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown operation type: %s", r.Type)
+	}
+}
+
+// bulkTarget 读取目标列当前值，key 同时作为 applyUpdates 的更新键
+type bulkTarget struct {
+	key string
+	get func(rec *model.Record) string
+}
+
+func resolveBulkTarget(schema *batchSchema, column string) (*bulkTarget, error) {
+	if column == "" {
+		return nil, fmt.Errorf("column is required")
+	}
+	if isLocationField(column) {
+		return &bulkTarget{key: column, get: func(rec *model.Record) string {
+			return map[string]string{"province": rec.Province, "city": rec.City, "district": rec.District}[column]
+		}}, nil
+	}
+	col, ok := schema.resolveColumn(column)
+	if !ok {
+		return nil, fmt.Errorf("unknown column: %s", column)
+	}
+	return &bulkTarget{key: column, get: func(rec *model.Record) string { return schema.valueOf(rec, col) }}, nil
+}
+
+// CreateBulkOperation 校验请求并创建后台批量操作，立即返回操作记录供前端轮询进度
+func (s *CleanerService) CreateBulkOperation(batchID uint, req BulkRequest, username string) (*model.BulkOperation, error) {
+	if req.Type == OpUndo {
+		return nil, fmt.Errorf("use the undo endpoint to revert an operation")
+	}
+	if _, err := req.transform(); err != nil {
+		return nil, err
+	}
+
+	batch, _, schema, err := s.loadBatchSchema(batchID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkBulkAllowed(batch); err != nil {
+		return nil, err
+	}
+	if req.Type != OpRevalidate {
+		if _, err := resolveBulkTarget(schema, req.Column); err != nil {
+			return nil, err
+		}
+	} else {
+		if req.Params.RuleSetID != nil {
+			version := 0
+			if req.Params.RuleSetVersion != nil {
+				version = *req.Params.RuleSetVersion
+			}
+			if req.Params.RuleSource, err = s.ResolveRuleSource("", *req.Params.RuleSetID, version, username); err != nil {
+				return nil, err
+			}
+		}
+		if req.Params.Rules != "" {
+			if _, err := loadRuleEngine(req.Params.Rules); err != nil {
+				return nil, fmt.Errorf("invalid rules: %w", err)
+			}
+		}
+	}
+
+	params, _ := json.Marshal(req.Params)
+	filter, _ := json.Marshal(req.Filter)
+	op := &model.BulkOperation{
+		BatchID:   batchID,
+		Type:      req.Type,
+		Column:    req.Column,
+		Params:    string(params),
+		Filter:    string(filter),
+		Reason:    utils.Truncate(req.Reason, 255),
+		Status:    model.OperationStatusPending,
+		CreatedBy: username,
+	}
+	var total int64
+	s.filterRecords(batchID, req.Filter).Count(&total)
+	op.Total = int(total)
+
+	if err := s.createBulkOperation(op, nil); err != nil {
+		return nil, err
+	}
+	go s.runBulkOperation(op.ID)
+	return op, nil
+}
+
+// UndoBulkOperation 创建撤销操作：将原操作修改过的记录恢复到操作前的状态，之后又被修改过的记录会被跳过
+func (s *CleanerService) UndoBulkOperation(opID uint, username string) (*model.BulkOperation, error) {
+	var orig model.BulkOperation
+	if err := s.DB.First(&orig, opID).Error; err != nil {
+		return nil, err
+	}
+	if orig.Type == OpUndo {
+		return nil, fmt.Errorf("an undo operation cannot be undone")
+	}
+	if orig.Status != model.OperationStatusCompleted && orig.Status != model.OperationStatusFailed {
+		return nil, fmt.Errorf("operation %d cannot be undone in status %s", orig.ID, orig.Status)
+	}
+
+	var batch model.ImportBatch
+	if err := s.DB.First(&batch, orig.BatchID).Error; err != nil {
+		return nil, err
+	}
+	if err := s.checkBulkAllowed(&batch); err != nil {
+		return nil, err
+	}
+
+	op := &model.BulkOperation{
+		BatchID:   orig.BatchID,
+		Type:      OpUndo,
+		UndoOf:    &orig.ID,
+		Reason:    fmt.Sprintf("Undo bulk operation #%d", orig.ID),
+		Status:    model.OperationStatusPending,
+		Total:     orig.Changed,
+		CreatedBy: username,
+	}
+	if err := s.createBulkOperation(op, nil); err != nil {
+		return nil, err
+	}
+	go s.runBulkOperation(op.ID)
+	return op, nil
+}
+
+// createBulkOperation 锁定批次行后重新检查并创建操作：同一批次的创建请求在锁上串行，
+// 不会有两个请求同时通过检查。extra 在同一事务中执行（如 reclean 更新批次规则），可为 nil
+func (s *CleanerService) createBulkOperation(op *model.BulkOperation, extra func(tx *gorm.DB) error) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var batch model.ImportBatch
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&batch, op.BatchID).Error; err != nil {
+			return err
+		}
+		if err := bulkAllowed(tx, &batch); err != nil {
+			return err
+		}
+		if err := tx.Create(op).Error; err != nil {
+			return err
+		}
+		if extra != nil {
+			return extra(tx)
+		}
+		return nil
+	})
+}
+
+// checkBulkAllowed 批次处理中或已有未结束的批量操作时拒绝新的操作。
+// 只用于创建前尽早返回错误，创建时由 createBulkOperation 在锁内再次检查
+func (s *CleanerService) checkBulkAllowed(batch *model.ImportBatch) error {
+	return bulkAllowed(s.DB, batch)
+}
+
+func bulkAllowed(db *gorm.DB, batch *model.ImportBatch) error {
+	switch batch.Status {
+	case model.BatchStatusPending, model.BatchStatusProcessing, model.BatchStatusIndexing:
+		return ErrBatchNotSettled
+	}
+	var running int64
+	db.Model(&model.BulkOperation{}).
+		Where("batch_id = ? AND status IN ?", batch.ID, []model.OperationStatus{model.OperationStatusPending, model.OperationStatusRunning}).
+		Count(&running)
+	if running > 0 {
+		return ErrOperationInProgress
+	}
+	return nil
+}
+
+// GetBulkOperation 查询批量操作及其进度
+func (s *CleanerService) GetBulkOperation(id uint) (*model.BulkOperation, error) {
+	var op model.BulkOperation
+	err := s.DB.First(&op, id).Error
+	return &op, err
+}
+
+// GetBulkOperations 列出批次的批量操作，最新的在前
+func (s *CleanerService) GetBulkOperations(batchID uint) ([]model.BulkOperation, error) {
+	var ops []model.BulkOperation
+	err := s.DB.Where("batch_id = ?", batchID).Order("id desc").Find(&ops).Error
+	return ops, err
+}
+
+// RecoverBulkOperations 将心跳已过期的未结束操作标记为失败；已处理的部分仍可通过 undo 撤销。
+// 其他实例正在执行的操作会持续刷新心跳，不受影响。服务启动时与 Reaper 每次扫描时调用
+func (s *CleanerService) RecoverBulkOperations() {
+	res := s.DB.Model(&model.BulkOperation{}).
+		Where("status IN ? AND updated_at < ?",
+			[]model.OperationStatus{model.OperationStatusPending, model.OperationStatusRunning}, time.Now().Add(-bulkStaleAfter)).
+		Updates(map[string]interface{}{
+			"status": model.OperationStatusFailed,
+			"error":  fmt.Sprintf("interrupted: no heartbeat for %v", bulkStaleAfter),
+		})
+	if res.RowsAffected > 0 {
+		log.Printf("[Bulk] Marked %d interrupted operation(s) as failed", res.RowsAffected)
+	}
+}
+
+// runBulkOperation 后台执行批量操作，每页一个事务，进度随每页提交更新
+func (s *CleanerService) runBulkOperation(opID uint) {
+	var op model.BulkOperation
+	if err := s.DB.First(&op, opID).Error; err != nil {
+		log.Printf("[Bulk] Operation %d not found: %v", opID, err)
+		return
+	}
+	s.DB.Model(&op).Update("status", model.OperationStatusRunning)
+	start := time.Now()
+	stopHeartbeat := s.bulkHeartbeat(op.ID)
+
+	var err error
+	switch op.Type {
+	case OpUndo:
+		err = s.runUndo(&op)
+	case OpReclean:
+		err = s.runReclean(&op)
+	case OpDedup:
+		err = s.runDedup(&op)
+	default:
+		err = s.runTransform(&op)
+	}
+
+	stopHeartbeat()
+	now := time.Now()
+	final := map[string]interface{}{"status": model.OperationStatusCompleted, "completed_at": &now}
+	if err != nil {
+		log.Printf("[Bulk] Operation %d failed: %v", op.ID, err)
+		final["status"] = model.OperationStatusFailed
+		final["error"] = err.Error()
+	} else {
+		log.Printf("[Bulk] Operation %d (%s) finished in %v: %d processed, %d changed", op.ID, op.Type, time.Since(start), op.Processed, op.Changed)
+	}
+	s.DB.Model(&op).Updates(final)
+	if err == nil && op.UndoOf != nil {
+		s.DB.Model(&model.BulkOperation{}).Where("id = ?", *op.UndoOf).Update("status", model.OperationStatusUndone)
+		s.restoreRecleanRules(*op.UndoOf)
+		s.clearUndoneDedup(*op.UndoOf)
+	}
+	s.refreshBatchCounts(op.BatchID)
+}
+
+// bulkHeartbeat 在操作执行期间定期刷新 updated_at，返回的 stop 结束心跳。
+// 单页或去重分组耗时较长时进度不会更新，心跳保证操作不被误判为中断
+func (s *CleanerService) bulkHeartbeat(opID uint) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(bulkHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.DB.Model(&model.BulkOperation{}).Where("id = ?", opID).Update("updated_at", time.Now())
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// runTransform 按 id 顺序分页处理匹配的记录；修改会改变记录状态，按 id 游标分页保证每条记录只处理一次
+func (s *CleanerService) runTransform(op *model.BulkOperation) error {
+	req := BulkRequest{Type: op.Type, Column: op.Column}
+	if err := json.Unmarshal([]byte(op.Params), &req.Params); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(op.Filter), &req.Filter); err != nil {
+		return err
+	}
+	transform, err := req.transform()
+	if err != nil {
+		return err
+	}
+
+	_, engine, schema, err := s.loadBatchSchema(op.BatchID)
+	if err != nil {
+		return err
+	}
+	var target *bulkTarget
+	if transform != nil {
+		if target, err = resolveBulkTarget(schema, op.Column); err != nil {
+			return err
+		}
+	} else if req.Params.Rules != "" {
+		if engine, err = loadRuleEngine(req.Params.Rules); err != nil {
+			return err
+		}
+		schema = buildSchema(schema.Columns, engine)
+	}
+
+	// 查找替换作用于已清洗的值，结果只重新校验；设置值视为用户输入，执行全部规则
+	apply := schema.applyCleanedUpdates
+	if op.Type == OpSetValue {
+		apply = schema.applyUpdates
+	}
+
+	reason := bulkReason(op)
+	var lastID uint
+	for {
+		var recs []model.Record
+		if err := s.filterRecords(op.BatchID, req.Filter).Where("id > ?", lastID).
+			Order("id asc").Limit(bulkPageSize).Find(&recs).Error; err != nil {
+			return err
+		}
+		if len(recs) == 0 {
+			return nil
+		}
+		lastID = recs[len(recs)-1].ID
+
+		changed := 0
+		err := s.DB.Transaction(func(tx *gorm.DB) error {
+			versions := make([]model.RecordVersion, 0, len(recs))
+			for i := range recs {
+				rec := &recs[i]
+				var updates map[string]interface{}
+				if target != nil {
+					updates = map[string]interface{}{target.key: transform(target.get(rec))}
+				}
+				next, err := apply(rec, updates, engine)
+				if err != nil {
+					return err
+				}
+				if reflect.DeepEqual(recordUpdateMap(rec), recordUpdateMap(&next)) {
+					continue
+				}
+				if err := recordScope(tx, rec).Updates(recordUpdateMap(&next)).Error; err != nil {
+					return err
+				}
+				countTransition(op, rec.Status, next.Status)
+				versions = append(versions, newBulkVersion(rec, &next, reason, op.ID))
+			}
+			changed = len(versions)
+			if len(versions) == 0 {
+				return nil
+			}
+			return tx.CreateInBatches(versions, bulkPageSize).Error
+		})
+		if err != nil {
+			return err
+		}
+
+		op.Processed += len(recs)
+		op.Changed += changed
+		s.saveProgress(op)
+	}
+}
+
+// runUndo 按版本顺序恢复原操作修改过的记录。只有当原操作的版本仍是记录的最新版本时才恢复，避免覆盖之后的修改
+func (s *CleanerService) runUndo(op *model.BulkOperation) error {
+	var lastID uint
+	for {
+		var versions []model.RecordVersion
+		if err := s.DB.Where("operation_id = ? AND id > ?", *op.UndoOf, lastID).
+			Order("id asc").Limit(bulkPageSize).Find(&versions).Error; err != nil {
+			return err
+		}
+		if len(versions) == 0 {
+			return nil
+		}
+		lastID = versions[len(versions)-1].ID
+
+		changed, skipped := 0, 0
+		err := s.DB.Transaction(func(tx *gorm.DB) error {
+			var undo []model.RecordVersion
+			for _, v := range versions {
+				var latest uint
+				tx.Model(&model.RecordVersion{}).Select("MAX(id)").Where("record_id = ?", v.RecordID).Scan(&latest)
+				if latest != v.ID {
+					skipped++
+					continue
+				}
+
+				var rec model.Record
+				if err := tx.First(&rec, "id = ? AND batch_id = ?", v.RecordID, op.BatchID).Error; err != nil {
+					skipped++
+					continue
+				}
+				target, err := s.smartUnmarshal(v.Before)
+				if err != nil {
+					return fmt.Errorf("version %d: %w", v.ID, err)
+				}
+				before := rec
+				if err := recordScope(tx, &rec).Updates(s.buildRollbackUpdates(target)).Error; err != nil {
+					return err
+				}
+				tx.First(&rec, "id = ? AND batch_id = ?", v.RecordID, op.BatchID)
+				countTransition(op, before.Status, rec.Status)
+				undo = append(undo, newBulkVersion(&before, &rec, op.Reason, op.ID))
+			}
+			changed = len(undo)
+			if len(undo) == 0 {
+				return nil
+			}
+			return tx.CreateInBatches(undo, bulkPageSize).Error
+		})
+		if err != nil {
+			return err
+		}
+
+		op.Processed += len(versions)
+		op.Changed += changed
+		op.Skipped += skipped
+		s.saveProgress(op)
+	}
+}
+
+// saveProgress 持久化操作的进度计数，前端轮询时读取
+func (s *CleanerService) saveProgress(op *model.BulkOperation) {
+	s.DB.Model(op).Updates(map[string]interface{}{
+		"processed":  op.Processed,
+		"changed":    op.Changed,
+		"skipped":    op.Skipped,
+		"to_clean":   op.ToClean,
+		"to_error":   op.ToError,
+		"preserved":  op.Preserved,
+		"duplicates": op.Duplicates,
+		"dup_groups": op.DupGroups,
+	})
+}
+
+// countTransition 统计记录状态的变化方向
+func countTransition(op *model.BulkOperation, from, to string) {
+	if from == to {
+		return
+	}
+	switch to {
+	case "Clean":
+		op.ToClean++
+	case "Error":
+		op.ToError++
+	}
+}
+
+// recordScope 定位单条记录，带上 batch_id 以便只访问该批次的分区
+func recordScope(tx *gorm.DB, rec *model.Record) *gorm.DB {
+	return tx.Model(&model.Record{}).Where("id = ? AND batch_id = ?", rec.ID, rec.BatchID)
+}
+
+func newBulkVersion(before, after *model.Record, reason string, opID uint) model.RecordVersion {
+	b, _ := json.Marshal(before)
+	a, _ := json.Marshal(after)
+	return model.RecordVersion{
+		RecordID:    before.ID,
+		Before:      string(b),
+		After:       string(a),
+		ChangedAt:   time.Now(),
+		Reason:      reason,
+		OperationID: &opID,
+	}
+}
+
+func bulkReason(op *model.BulkOperation) string {
+	if op.Reason != "" {
+		return op.Reason
+	}
+	return utils.Truncate(fmt.Sprintf("Bulk #%d: %s %s", op.ID, op.Type, op.Column), 255)
+}
+
+// refreshBatchCounts 批量修改会改变记录状态，重新统计批次的成功/失败数并清除分析缓存
+func (s *CleanerService) refreshBatchCounts(batchID uint) {
+	var clean, total int64
+	s.DB.Model(&model.Record{}).Where("batch_id = ? AND status = ?", batchID, "Clean").Count(&clean)
+	s.DB.Model(&model.Record{}).Where("batch_id = ?", batchID).Count(&total)
+	s.DB.Model(&model.ImportBatch{}).Where("id = ?", batchID).Updates(map[string]interface{}{
+		"success_count": clean,
+		"failure_count": total - clean,
+		"analytics":     nil,
+	})
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"testing"
+
+	"etl-tool/internal/model"
+)
+
+func TestBulkRequest_Transform(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     BulkRequest
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"find replace", BulkRequest{Type: OpFindReplace, Params: BulkParams{Find: "-", Replace: ""}}, "138-0013-8000", "13800138000", false},
+		{"find required", BulkRequest{Type: OpFindReplace}, "", "", true},
+		{"regex replace", BulkRequest{Type: OpRegexReplace, Params: BulkParams{Pattern: `^\+86\s*(\d{11})$`, Replace: "$1"}}, "+86 13800138000", "13800138000", false},
+		{"invalid regex", BulkRequest{Type: OpRegexReplace, Params: BulkParams{Pattern: "("}}, "", "", true},
+		{"set value", BulkRequest{Type: OpSetValue, Params: BulkParams{Value: "未知"}}, "abc", "未知", false},
+		{"unknown type", BulkRequest{Type: "drop"}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn, err := tt.req.transform()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("transform() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := fn(tt.in); got != tt.want {
+				t.Errorf("transform()(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+
+	if fn, err := (&BulkRequest{Type: OpRevalidate}).transform(); err != nil || fn != nil {
+		t.Errorf("revalidate transform() returned fn = %t, err = %v, want nil, nil", fn != nil, err)
+	}
+}
+
+func TestResolveBulkTarget(t *testing.T) {
+	schema := buildSchema(model.BatchColumns{
+		{Name: "姓名", Index: 0, Field: FieldName},
+		{Name: "手机", Index: 1, Field: FieldPhone},
+		{Name: "部门", Index: 2},
+	}, NewRuleEngine())
+	rec := &model.Record{
+		Name:     "张三",
+		Phone:    "13800138000",
+		Fields:   model.JSONMap{"姓名": "张三", "手机": "13800138000", "部门": "研发"},
+		Province: "广东省",
+	}
+
+	tests := []struct {
+		column  string
+		want    string
+		wantErr bool
+	}{
+		{"手机", "13800138000", false},
+		{"部门", "研发", false},
+		{"province", "广东省", false},
+		{"", "", true},
+		{"不存在", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.column, func(t *testing.T) {
+			target, err := resolveBulkTarget(schema, tt.column)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveBulkTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && target.get(rec) != tt.want {
+				t.Errorf("get() = %q, want %q", target.get(rec), tt.want)
+			}
+		})
+	}
+}
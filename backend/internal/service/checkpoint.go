@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"etl-tool/internal/config"
+	"etl-tool/internal/model"
+	"etl-tool/internal/repository"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// checkpointInterval 进度监控写入断点的间隔，也是控制频道不可用时轮询批次状态的间隔
+const checkpointInterval = time.Second
+
+// batchCheckpoint 批次的断点：Rows 及之前的所有行都已提交到数据库，Success/Failure 为这些行的统计
+type batchCheckpoint struct {
+	Rows    int
+	Success int
+	Failure int
+}
+
+// checkpointOf 读取批次上保存的断点
+func checkpointOf(batch *model.ImportBatch) batchCheckpoint {
+	return batchCheckpoint{
+		Rows:    batch.ProcessedRows,
+		Success: batch.SuccessCount,
+		Failure: batch.FailureCount,
+	}
+}
+
+// rowWatermark 跟踪已提交行号的连续水位。
+// 多个 Saver 并发写入时提交顺序是乱序的，只有水位之前的行才能作为恢复断点，
+// 水位之后已提交的行在恢复时会被重新写入并由唯一索引去重。
+type rowWatermark struct {
+	mu      sync.Mutex
+	cp      batchCheckpoint
+	pending map[int]bool // 已提交但前面仍有空洞的行 -> 是否为 Clean
+}
+
+func newRowWatermark(cp batchCheckpoint) *rowWatermark {
+	return &rowWatermark{cp: cp, pending: make(map[int]bool)}
+}
+
+// commit 记录一组已成功写入的记录并推进水位
+func (w *rowWatermark) commit(recs []model.Record) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for i := range recs {
+		if recs[i].RowIndex > w.cp.Rows {
+			w.pending[recs[i].RowIndex] = recs[i].Status == "Clean"
+		}
+	}
+	for {
+		clean, ok := w.pending[w.cp.Rows+1]
+		if !ok {
+			break
+		}
+		delete(w.pending, w.cp.Rows+1)
+		w.cp.Rows++
+		if clean {
+			w.cp.Success++
+		} else {
+			w.cp.Failure++
+		}
+	}
+}
+
+// checkpoint 返回当前水位
+func (w *rowWatermark) checkpoint() batchCheckpoint {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.cp
+}
+
+// batchStore 抽象行处理期间的数据库操作，便于在测试中替换
+type batchStore interface {
+	// SaveRecords 幂等写入：(batch_id, row_index) 已存在的行会被忽略；ctx 取消时中止写入
+	SaveRecords(ctx context.Context, recs []model.Record) error
+	SaveCheckpoint(batchID uint, cp batchCheckpoint) error
+}
+
+type gormBatchStore struct {
+	db *gorm.DB
+}
+
+// SaveRecords 直接写入批次分区，省去父表的分区路由
+func (g gormBatchStore) SaveRecords(ctx context.Context, recs []model.Record) error {
+	if len(recs) == 0 {
+		return nil
+	}
+	return g.db.WithContext(ctx).Table(repository.PartitionName(recs[0].BatchID)).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "batch_id"}, {Name: "row_index"}},
+		DoNothing: true,
+	}).CreateInBatches(recs, len(recs)).Error
+}
+
+func (g gormBatchStore) SaveCheckpoint(batchID uint, cp batchCheckpoint) error {
+	return g.db.Model(&model.ImportBatch{}).Where("id = ?", batchID).
+		Updates(map[string]interface{}{
+			"processed_rows": cp.Rows,
+			"success_count":  cp.Success,
+			"failure_count":  cp.Failure,
+		}).Error
+}
+
+// batchStore 返回行处理使用的存储，未指定时按配置的 Saver 写入数据库
+func (s *CleanerService) batchStore() batchStore {
+	if s.store != nil {
+		return s.store
+	}
+	store := gormBatchStore{db: s.DB}
+	if config.AppConfig != nil && config.AppConfig.Database.Saver == SaverCopy {
+		return copyBatchStore{gormBatchStore: store}
+	}
+	return store
+}
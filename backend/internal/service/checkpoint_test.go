@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"etl-tool/internal/model"
+	"etl-tool/internal/utils"
+)
+
+// sliceIterator 基于内存切片的 RowIterator
+type sliceIterator struct {
+	rows [][]string
+	pos  int
+}
+
+func (it *sliceIterator) Next() bool {
+	it.pos++
+	return it.pos <= len(it.rows)
+}
+func (it *sliceIterator) Row() []string { return it.rows[it.pos-1] }
+func (it *sliceIterator) Err() error    { return nil }
+func (it *sliceIterator) Close() error  { return nil }
+
+// memBatchStore 模拟数据库：按 (batch_id, row_index) 去重，写入带随机延迟以打乱提交顺序，
+// 延迟期间 ctx 被取消则整批不写入（模拟事务中止）
+type memBatchStore struct {
+	mu      sync.Mutex
+	records map[int]model.Record
+	cp      batchCheckpoint
+	rnd     *rand.Rand
+}
+
+func newMemBatchStore(seed int64) *memBatchStore {
+	return &memBatchStore{
+		records: make(map[int]model.Record),
+		rnd:     rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (m *memBatchStore) SaveRecords(ctx context.Context, recs []model.Record) error {
+	m.mu.Lock()
+	delay := time.Duration(m.rnd.Intn(3000)) * time.Microsecond
+	m.mu.Unlock()
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, rec := range recs {
+		if _, exists := m.records[rec.RowIndex]; !exists {
+			m.records[rec.RowIndex] = rec
+		}
+	}
+	return nil
+}
+
+func (m *memBatchStore) SaveCheckpoint(batchID uint, cp batchCheckpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cp = cp
+	return nil
+}
+
+func TestRowWatermark_OutOfOrder(t *testing.T) {
+	w := newRowWatermark(batchCheckpoint{Rows: 10, Success: 8, Failure: 2})
+
+	w.commit([]model.Record{{RowIndex: 13, Status: "Clean"}, {RowIndex: 14, Status: "Error"}})
+	if cp := w.checkpoint(); cp.Rows != 10 {
+		t.Fatalf("Watermark should not pass the gap at row 11, got %+v", cp)
+	}
+
+	w.commit([]model.Record{{RowIndex: 11, Status: "Clean"}})
+	if cp := w.checkpoint(); cp.Rows != 11 || cp.Success != 9 {
+		t.Fatalf("Expected watermark 11, got %+v", cp)
+	}
+
+	// 已在断点之前的行（恢复时重复写入）不重复计数
+	w.commit([]model.Record{{RowIndex: 12, Status: "Clean"}, {RowIndex: 5, Status: "Clean"}})
+	want := batchCheckpoint{Rows: 14, Success: 11, Failure: 3}
+	if cp := w.checkpoint(); cp != want {
+		t.Errorf("checkpoint() = %+v, want %+v", cp, want)
+	}
+}
+
+func TestProcessRows_ExactlyOnceAcrossRandomPauses(t *testing.T) {
+	const totalRows = 30000
+	header := []string{"name", "phone", "department"}
+
+	rows := make([][]string, totalRows)
+	wantClean := 0
+	for i := range rows {
+		name := fmt.Sprintf("user-%d", i+1)
+		if i%7 == 0 {
+			name = "" // 触发 required 规则，产生 Error 记录
+		} else {
+			wantClean++
+		}
+		rows[i] = []string{name, "13812345678", "研发部"}
+	}
+
+	engine := NewRuleEngine()
+	if err := engine.LoadConfig([]byte(`[{"column": "name", "rules": [{"type": "required"}]}]`)); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	seed := time.Now().UnixNano()
+	t.Logf("seed = %d", seed)
+	rnd := rand.New(rand.NewSource(seed))
+
+	store := newMemBatchStore(seed)
+	s := &CleanerService{store: store}
+	schema := newBatchSchema(header, utils.DetectHeaders(header), nil, engine)
+
+	var cp batchCheckpoint
+	pauses := 0
+	for attempt := 0; ; attempt++ {
+		if attempt > 200 {
+			t.Fatalf("Batch did not complete after %d attempts, checkpoint %+v", attempt, cp)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		timer := time.AfterFunc(time.Duration(rnd.Intn(80000))*time.Microsecond, cancel)
+		stats, err := s.processRows(ctx, &sliceIterator{rows: rows}, 1, schema, cp, engine)
+		timer.Stop()
+		cancel()
+
+		store.mu.Lock()
+		saved := store.cp
+		store.mu.Unlock()
+		if saved.Rows != stats.rowIdx {
+			t.Fatalf("Saved checkpoint %+v differs from stats %+v", saved, stats)
+		}
+		if saved.Rows < cp.Rows {
+			t.Fatalf("Checkpoint moved backwards: %+v -> %+v", cp, saved)
+		}
+		cp = saved
+
+		if err == nil {
+			break
+		}
+		pauses++
+	}
+	t.Logf("completed after %d pauses", pauses)
+
+	if len(store.records) != totalRows {
+		t.Fatalf("Expected %d stored rows, got %d", totalRows, len(store.records))
+	}
+	clean := 0
+	for i := 1; i <= totalRows; i++ {
+		rec, ok := store.records[i]
+		if !ok {
+			t.Fatalf("Row %d missing", i)
+		}
+		if rec.Fields["name"] != rows[i-1][0] {
+			t.Fatalf("Row %d has data of another row: %q", i, rec.Fields["name"])
+		}
+		if rec.Status == "Clean" {
+			clean++
+		}
+	}
+
+	want := batchCheckpoint{Rows: totalRows, Success: wantClean, Failure: totalRows - wantClean}
+	if cp != want || clean != wantClean {
+		t.Errorf("Final checkpoint %+v (stored clean %d), want %+v", cp, clean, want)
+	}
+}
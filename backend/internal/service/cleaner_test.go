@@ -35,6 +35,30 @@ func TestCleanDate(t *testing.T) {
 			want:    "2023-12-25",
 			wantErr: false,
 		},
+		{
+			name:    "Two-digit year after pivot",
+			input:   "85年3月7日",
+			want:    "1985-03-07",
+			wantErr: false,
+		},
+		{
+			name:    "Two-digit year before pivot",
+			input:   "23年1月1日",
+			want:    "2023-01-01",
+			wantErr: false,
+		},
+		{
+			name:    "Nonexistent day",
+			input:   "2023-02-30",
+			want:    "2023-02-30",
+			wantErr: true,
+		},
+		{
+			name:    "Nonexistent month",
+			input:   "2023-13-45",
+			want:    "2023-13-45",
+			wantErr: true,
+		},
 		{
 			name:    "Empty string",
 			input:   "",
@@ -0,0 +1,162 @@
+// internal/service/control.go - Batch Control Signals
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"etl-tool/internal/infrastructure/redis"
+	"etl-tool/internal/model"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	// ControlChannelPrefix 批次控制信号的发布频道
+	ControlChannelPrefix = "batch:control:"
+	// ControlKeyPrefix 最近一次控制信号，供信号发出后才开始处理的 Worker 读取
+	ControlKeyPrefix = "batch:control_state:"
+	// controlKeyTTL 控制信号的保留时间
+	controlKeyTTL = 24 * time.Hour
+)
+
+// 控制动作
+const (
+	ControlPause  = "pause"
+	ControlCancel = "cancel"
+)
+
+// 作为 ProcessBatch context 的取消原因，区分用户操作与 Worker 退出
+var (
+	ErrBatchPaused    = errors.New("batch paused by user")
+	ErrBatchCancelled = errors.New("batch cancelled by user")
+)
+
+// ControlService 通过 Redis Pub/Sub 向正在处理批次的 Worker 推送暂停/取消信号
+type ControlService struct {
+	client *goredis.Client
+}
+
+func NewControlService() *ControlService {
+	return NewControlServiceWithClient(nil)
+}
+
+// NewControlServiceWithClient 使用指定的 Redis 客户端（为 nil 时使用全局客户端）
+func NewControlServiceWithClient(client *goredis.Client) *ControlService {
+	return &ControlService{client: client}
+}
+
+func (c *ControlService) rdb() (*goredis.Client, error) {
+	if c.client != nil {
+		return c.client, nil
+	}
+	if redis.Client == nil {
+		return nil, fmt.Errorf("redis client not initialized")
+	}
+	return redis.Client, nil
+}
+
+func controlChannel(batchID uint) string {
+	return ControlChannelPrefix + strconv.FormatUint(uint64(batchID), 10)
+}
+
+func controlKey(batchID uint) string {
+	return ControlKeyPrefix + strconv.FormatUint(uint64(batchID), 10)
+}
+
+// controlCause 将控制动作转换为取消原因，未知动作返回 nil
+func controlCause(action string) error {
+	switch action {
+	case ControlPause:
+		return ErrBatchPaused
+	case ControlCancel:
+		return ErrBatchCancelled
+	}
+	return nil
+}
+
+// Publish 保存并广播控制信号
+func (c *ControlService) Publish(ctx context.Context, batchID uint, action string) error {
+	client, err := c.rdb()
+	if err != nil {
+		return err
+	}
+	pipe := client.TxPipeline()
+	pipe.Set(ctx, controlKey(batchID), action, controlKeyTTL)
+	pipe.Publish(ctx, controlChannel(batchID), action)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Clear 清除批次的控制信号（恢复处理前调用）
+func (c *ControlService) Clear(ctx context.Context, batchID uint) error {
+	client, err := c.rdb()
+	if err != nil {
+		return err
+	}
+	return client.Del(ctx, controlKey(batchID)).Err()
+}
+
+// Watch 订阅批次的控制信号，收到暂停/取消时以对应原因调用 cancel。
+// 订阅建立后会补查一次已保存的信号，因此在 Watch 之前发出的信号也不会丢失。返回的 stop 用于结束订阅。
+func (c *ControlService) Watch(ctx context.Context, batchID uint, cancel context.CancelCauseFunc) (stop func(), err error) {
+	client, err := c.rdb()
+	if err != nil {
+		return nil, err
+	}
+
+	sub := client.Subscribe(ctx, controlChannel(batchID))
+	// 等待订阅确认，之后发布的信号一定能收到
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	action, err := client.Get(ctx, controlKey(batchID)).Result()
+	if err != nil && err != goredis.Nil {
+		sub.Close()
+		return nil, err
+	}
+	if cause := controlCause(action); cause != nil {
+		cancel(cause)
+	}
+
+	go func() {
+		for msg := range sub.Channel() {
+			if cause := controlCause(msg.Payload); cause != nil {
+				cancel(cause)
+				return
+			}
+		}
+	}()
+	return func() { sub.Close() }, nil
+}
+
+// pollStatus 控制频道不可用时的回退：每隔 interval 读取一次批次状态，发现暂停/取消时以对应原因调用 cancel，
+// ctx 结束时返回。读取失败时等待下一次，不中断处理
+func pollStatus(ctx context.Context, interval time.Duration, status func() (model.BatchStatus, error), cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current, err := status()
+			if err != nil {
+				continue
+			}
+			switch current {
+			case model.BatchStatusPaused:
+				cancel(ErrBatchPaused)
+				return
+			case model.BatchStatusCancelled:
+				cancel(ErrBatchCancelled)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"etl-tool/internal/model"
+	"etl-tool/internal/utils"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func newTestControl(t *testing.T) *ControlService {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewControlServiceWithClient(client)
+}
+
+// waitCause 等待 ctx 被取消并返回取消原因，超时返回 nil
+func waitCause(ctx context.Context, timeout time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+func TestControl_PublishAfterWatch(t *testing.T) {
+	control := newTestControl(t)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	stop, err := control.Watch(ctx, 1, cancel)
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	defer stop()
+
+	// 其他批次的信号不影响当前批次
+	control.Publish(context.Background(), 2, ControlCancel)
+	if cause := waitCause(ctx, 100*time.Millisecond); cause != nil {
+		t.Fatalf("Batch 1 should ignore signals for batch 2, got %v", cause)
+	}
+
+	start := time.Now()
+	if err := control.Publish(context.Background(), 1, ControlPause); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if cause := waitCause(ctx, time.Second); !errors.Is(cause, ErrBatchPaused) {
+		t.Fatalf("Expected ErrBatchPaused, got %v", cause)
+	}
+	t.Logf("pause delivered in %v", time.Since(start))
+}
+
+func TestControl_SignalBeforeWatch(t *testing.T) {
+	control := newTestControl(t)
+	control.Publish(context.Background(), 1, ControlCancel)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	stop, err := control.Watch(ctx, 1, cancel)
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	defer stop()
+
+	if cause := waitCause(ctx, time.Second); !errors.Is(cause, ErrBatchCancelled) {
+		t.Fatalf("Expected ErrBatchCancelled from saved signal, got %v", cause)
+	}
+}
+
+func TestControl_ClearOnResume(t *testing.T) {
+	control := newTestControl(t)
+	control.Publish(context.Background(), 1, ControlPause)
+	if err := control.Clear(context.Background(), 1); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	stop, err := control.Watch(ctx, 1, cancel)
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	defer stop()
+
+	if cause := waitCause(ctx, 100*time.Millisecond); cause != nil {
+		t.Fatalf("Cleared signal should not interrupt a resumed batch, got %v", cause)
+	}
+}
+
+func TestPollStatus(t *testing.T) {
+	statuses := []model.BatchStatus{model.BatchStatusProcessing, "", model.BatchStatusCancelled}
+	calls := 0
+	status := func() (model.BatchStatus, error) {
+		current := statuses[min(calls, len(statuses)-1)]
+		calls++
+		if current == "" {
+			return "", errors.New("db unavailable") // 读取失败不中断处理
+		}
+		return current, nil
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	go pollStatus(ctx, 10*time.Millisecond, status, cancel)
+	if cause := waitCause(ctx, time.Second); !errors.Is(cause, ErrBatchCancelled) {
+		t.Fatalf("Expected ErrBatchCancelled from polled status, got %v", cause)
+	}
+	if calls != 3 {
+		t.Errorf("status polled %d times, want 3", calls)
+	}
+}
+
+// blockingStore 的写入一直阻塞到 ctx 取消，模拟被锁住的 Saver
+type blockingStore struct {
+	memBatchStore
+}
+
+func (b *blockingStore) SaveRecords(ctx context.Context, recs []model.Record) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestProcessRows_PauseInterruptsBlockedSaver(t *testing.T) {
+	header := []string{"name", "phone"}
+	rows := make([][]string, 50000)
+	for i := range rows {
+		rows[i] = []string{fmt.Sprintf("user-%d", i+1), "13812345678"}
+	}
+
+	store := &blockingStore{memBatchStore: *newMemBatchStore(1)}
+	s := &CleanerService{store: store}
+	engine := NewRuleEngine()
+	schema := newBatchSchema(header, utils.DetectHeaders(header), nil, engine)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	time.AfterFunc(50*time.Millisecond, func() { cancel(ErrBatchPaused) })
+
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		_, err := s.processRows(ctx, &sliceIterator{rows: rows}, 1, schema, batchCheckpoint{}, engine)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) || !errors.Is(context.Cause(ctx), ErrBatchPaused) {
+			t.Errorf("Unexpected result: err=%v cause=%v", err, context.Cause(ctx))
+		}
+		t.Logf("pipeline stopped %v after start", time.Since(start))
+	case <-time.After(5 * time.Second):
+		t.Fatal("Pause did not stop a pipeline with blocked savers")
+	}
+
+	if cp := store.cp; cp.Rows != 0 {
+		t.Errorf("No rows were committed, checkpoint must stay at 0: %+v", cp)
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"etl-tool/internal/model"
+	"etl-tool/internal/repository"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Saver 后端
+const (
+	SaverGorm = "gorm" // GORM CreateInBatches（多行 INSERT）
+	SaverCopy = "copy" // pgx COPY FROM STDIN
+)
+
+// copyColumns COPY 写入的列，id 由目标表的序列生成
+var copyColumns = []string{
+	"batch_id", "row_index", "name", "phone", "date", "address",
+	"province", "city", "district", "fields", "status", "error_message", "errors", "raw_data",
+	"dup_group", "dup_of", "dup_match",
+}
+
+// copyRow 按 copyColumns 的顺序展开记录
+func copyRow(rec *model.Record) []any {
+	return []any{
+		int64(rec.BatchID), rec.RowIndex, rec.Name, rec.Phone, rec.Date, rec.Address,
+		rec.Province, rec.City, rec.District, rec.Fields, rec.Status, rec.ErrorMessage, rec.Errors, rec.RawData,
+		nullableID(rec.DupGroup), nullableID(rec.DupOf), rec.DupMatch,
+	}
+}
+
+// nullableID 可空的 ID 列：COPY 不接受 *uint，转换为 int64 或 NULL
+func nullableID(id *uint) any {
+	if id == nil {
+		return nil
+	}
+	return int64(*id)
+}
+
+// copyStageTable 每个连接私有的临时表，事务提交时自动清空
+const copyStageTable = "records_stage"
+
+// copyBatchStore 通过 COPY 将记录流式写入临时表，再以 INSERT ... ON CONFLICT DO NOTHING 合并到批次分区。
+// COPY 本身不支持冲突处理，经由临时表中转才能保持与 GORM 路径相同的幂等语义
+type copyBatchStore struct {
+	gormBatchStore
+}
+
+func (c copyBatchStore) SaveRecords(ctx context.Context, recs []model.Record) error {
+	if len(recs) == 0 {
+		return nil
+	}
+
+	sqlDB, err := c.db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	cols := strings.Join(copyColumns, ", ")
+	return conn.Raw(func(driverConn any) error {
+		pc, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("copy saver requires the pgx driver, got %T", driverConn)
+		}
+
+		tx, err := pc.Conn().Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		stage := fmt.Sprintf("CREATE TEMP TABLE IF NOT EXISTS %s ON COMMIT DELETE ROWS AS SELECT %s FROM records WITH NO DATA",
+			copyStageTable, cols)
+		if _, err := tx.Exec(ctx, stage); err != nil {
+			return err
+		}
+
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{copyStageTable}, copyColumns,
+			pgx.CopyFromSlice(len(recs), func(i int) ([]any, error) {
+				return copyRow(&recs[i]), nil
+			}))
+		if err != nil {
+			return err
+		}
+
+		merge := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s ON CONFLICT (batch_id, row_index) DO NOTHING",
+			repository.PartitionName(recs[0].BatchID), cols, cols, copyStageTable)
+		if _, err := tx.Exec(ctx, merge); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	})
+}
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 日期解析策略（type: date）：按输入格式解析日期并校验日历（2023-02-30、2023-13-45 不存在），输出统一格式。
+//   - layouts 为空时识别常见写法：2023-12-25、2023/12/25、2023.12.25、2023年12月25日、20231225；
+//     年份不在首位的数字日期（25/12/2023、12/25/23）按 order 确定日、月的顺序
+//   - 格式使用 yyyy / yy / M / MM / MMM（Jan）/ MMMM（January）/ d / dd / H / HH / m / mm / s / ss 占位符，
+//     如 dd/MM/yyyy、yyyy年M月d日、yyyy-MM-dd HH:mm:ss；两位年份按 pivot_year 补全世纪
+//   - excel_serial 识别 Excel 日期序列号（.xlsx 中未设置日期格式的单元格），timestamp 识别 Unix 时间戳
+//   - min / max 为 yyyy-MM-dd 或 today，按日期（不含时间）比较
+//
+// 示例：
+//
+//	{"type": "date", "layouts": ["dd/MM/yyyy", "dd.MM.yy"], "pivot_year": 30}
+//	{"type": "date", "excel_serial": true, "min": "1950-01-01", "max": "today"}
+//	{"type": "date", "timestamp": "ms", "timezone": "+08:00", "format": "yyyy-MM-dd HH:mm"}
+
+// 错误代码（见 rule_engine.go 中的说明）
+const (
+	ErrCodeDateTooEarly = "date_too_early"
+	ErrCodeDateTooLate  = "date_too_late"
+
+	defaultPivotYear = 50
+	isoDateLayout    = "2006-01-02"
+	excelMaxSerial   = 2958465 // 9999-12-31
+)
+
+var (
+	// regexDateParts 年、月、日三段数字，分隔符为 - / . 或 年 月 日
+	regexDateParts = regexp.MustCompile(`^(\d{1,4})\s*[-/.年]\s*(\d{1,2})\s*[-/.月]\s*(\d{1,4})\s*日?$`)
+	// regexCompactDate yyyyMMdd
+	regexCompactDate = regexp.MustCompile(`^(\d{4})(\d{2})(\d{2})$`)
+	regexNumber      = regexp.MustCompile(`^\d+(\.\d+)?$`)
+	regexUTCOffset   = regexp.MustCompile(`^([+-])(\d{2}):?(\d{2})$`)
+
+	// dateTokens 格式占位符与对应的 Go 布局，同一字母按长度从长到短匹配
+	dateTokens = []struct{ token, layout string }{
+		{"yyyy", "2006"}, {"yy", "06"},
+		{"MMMM", "January"}, {"MMM", "Jan"}, {"MM", "01"}, {"M", "1"},
+		{"dd", "02"}, {"d", "2"},
+		{"HH", "15"}, {"H", "15"},
+		{"mm", "04"}, {"m", "4"},
+		{"ss", "05"}, {"s", "5"},
+	}
+
+	// defaultDateStrategy 无参数的 date 策略，供 CleanDate 与行级规则的 age() 使用
+	defaultDateStrategy, _ = newDateStrategy(dateParams{})
+)
+
+type dateParams struct {
+	Layouts     []string `json:"layouts" desc:"输入格式，依次尝试，如 dd/MM/yyyy、yyyy年M月d日、yyyy-MM-dd HH:mm:ss；为空时识别常见写法"`
+	Order       string   `json:"order" desc:"未指定 layouts 时，年份不在首位的数字日期的顺序：ymd（默认）、dmy（日/月/年）、mdy（月/日/年）" enum:"ymd,dmy,mdy"`
+	PivotYear   *int     `json:"pivot_year" desc:"两位年份小于该值时为 20xx，否则为 19xx，默认 50"`
+	ExcelSerial bool     `json:"excel_serial" desc:"识别 Excel 日期序列号（如 45000 → 2023-03-15）"`
+	Timestamp   string   `json:"timestamp" desc:"识别 Unix 时间戳（秒或毫秒）" enum:"s,ms"`
+	Timezone    string   `json:"timezone" desc:"时间戳转换使用的时区，如 +08:00 或 Asia/Shanghai，默认为服务器时区"`
+	Min         string   `json:"min" desc:"最早日期（含），yyyy-MM-dd 或 today"`
+	Max         string   `json:"max" desc:"最晚日期（含），yyyy-MM-dd 或 today"`
+	Format      string   `json:"format" desc:"输出格式，默认 yyyy-MM-dd"`
+}
+
+func init() {
+	RegisterStrategy("date", "日期解析与格式化，默认输出 YYYY-MM-DD", func(p dateParams) (CleaningStrategy, error) {
+		return newDateStrategy(p)
+	})
+}
+
+func newDateStrategy(p dateParams) (*DateStrategy, error) {
+	s := &DateStrategy{Order: p.Order, PivotYear: defaultPivotYear, ExcelSerial: p.ExcelSerial, Timestamp: p.Timestamp,
+		output: isoDateLayout, loc: time.Local}
+	if s.Order == "" {
+		s.Order = "ymd"
+	}
+	if p.PivotYear != nil {
+		if *p.PivotYear < 0 || *p.PivotYear > 100 {
+			return nil, NewParamError("pivot_year", "pivot_year must be between 0 and 100")
+		}
+		s.PivotYear = *p.PivotYear
+	}
+	for i, l := range p.Layouts {
+		layout, short, err := goDateLayout(l)
+		if err != nil {
+			return nil, NewParamError("layouts", "layouts[%d]: %v", i, err)
+		}
+		s.layouts = append(s.layouts, dateLayout{layout, short})
+	}
+	if p.Format != "" {
+		layout, _, err := goDateLayout(p.Format)
+		if err != nil {
+			return nil, NewParamError("format", "format: %v", err)
+		}
+		s.output = layout
+	}
+	if p.Timezone != "" {
+		loc, err := loadTimezone(p.Timezone)
+		if err != nil {
+			return nil, NewParamError("timezone", "unknown timezone %q", p.Timezone)
+		}
+		s.loc = loc
+	}
+
+	var err error
+	if s.min, err = parseDateBound(p.Min); err != nil {
+		return nil, NewParamError("min", "min must be yyyy-MM-dd or today")
+	}
+	if s.max, err = parseDateBound(p.Max); err != nil {
+		return nil, NewParamError("max", "max must be yyyy-MM-dd or today")
+	}
+	if s.min != nil && s.max != nil && !s.min.today && !s.max.today && s.min.date.After(s.max.date) {
+		return nil, NewParamError("min", "min (%s) must not be later than max (%s)", p.Min, p.Max)
+	}
+	return s, nil
+}
+
+// DateStrategy 日期解析与规范化，参数见 dateParams
+type DateStrategy struct {
+	Order       string
+	PivotYear   int
+	ExcelSerial bool
+	Timestamp   string // "", "s" or "ms"
+
+	layouts  []dateLayout // 为空时使用内置的常见写法
+	output   string       // Go 布局
+	loc      *time.Location
+	min, max *dateBound
+}
+
+type dateLayout struct {
+	layout    string // Go 布局
+	shortYear bool   // 含两位年份，解析后按 PivotYear 补全世纪
+}
+
+// dateBound 日期范围的边界，today 在每次校验时取当天
+type dateBound struct {
+	date  time.Time
+	today bool
+}
+
+func (s *DateStrategy) Clean(input string) (string, error) {
+	d := strings.TrimSpace(input)
+	if d == "" {
+		return "", ruleError(ErrCodeRequired, "empty date")
+	}
+	t, ok := s.parse(d)
+	if !ok {
+		return input, ruleError(ErrCodeInvalidDate, "invalid format")
+	}
+
+	out := t.Format(s.output)
+	day := dateOf(t)
+	if b := s.min; b != nil && day.Before(s.bound(b)) {
+		return out, ruleError(ErrCodeDateTooEarly, "too early: min %s", s.bound(b).Format(isoDateLayout))
+	}
+	if b := s.max; b != nil && day.After(s.bound(b)) {
+		return out, ruleError(ErrCodeDateTooLate, "too late: max %s", s.bound(b).Format(isoDateLayout))
+	}
+	return out, nil
+}
+
+func (s *DateStrategy) GetType() string { return "date" }
+
+// Idempotent 输出格式能被再次解析为同一天时，重新清洗不会改变结果
+func (s *DateStrategy) Idempotent() bool {
+	sample := time.Date(2001, 2, 3, 0, 0, 0, 0, s.loc)
+	t, ok := s.parse(sample.Format(s.output))
+	return ok && t.Format(isoDateLayout) == sample.Format(isoDateLayout)
+}
+
+// parse 依次尝试输入格式、时间戳与 Excel 序列号；不存在的日期视为解析失败
+func (s *DateStrategy) parse(d string) (time.Time, bool) {
+	if len(s.layouts) == 0 {
+		if t, ok := s.parseCommon(d); ok {
+			return t, true
+		}
+	}
+	for _, l := range s.layouts {
+		t, err := time.ParseInLocation(l.layout, d, s.loc)
+		if err != nil {
+			continue
+		}
+		if l.shortYear {
+			// Go 按 1969–2068 补全两位年份，改按 PivotYear 重新构造（2 月 29 日需重新校验）
+			year := s.fullYear(t.Year() % 100)
+			c := time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, s.loc)
+			if c.Day() != t.Day() {
+				continue
+			}
+			t = c
+		}
+		return t, true
+	}
+
+	if !regexNumber.MatchString(d) {
+		return time.Time{}, false
+	}
+	intLen := strings.IndexByte(d+".", '.')
+	// 时间戳至少 9 位，Excel 序列号最多 7 位，二者与 yyyyMMdd 不会混淆
+	if s.Timestamp != "" && intLen >= 9 && intLen == len(d) {
+		n, err := strconv.ParseInt(d, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		if s.Timestamp == "ms" {
+			return time.UnixMilli(n).In(s.loc), true
+		}
+		return time.Unix(n, 0).In(s.loc), true
+	}
+	if s.ExcelSerial && intLen <= 7 {
+		v, _ := strconv.ParseFloat(d, 64)
+		return excelSerialTime(v, s.loc)
+	}
+	return time.Time{}, false
+}
+
+// parseCommon 内置的常见写法：年月日三段数字（含中文）与 yyyyMMdd
+func (s *DateStrategy) parseCommon(d string) (time.Time, bool) {
+	var y, m, day string
+	if p := regexCompactDate.FindStringSubmatch(d); p != nil {
+		y, m, day = p[1], p[2], p[3]
+	} else if p := regexDateParts.FindStringSubmatch(d); p != nil {
+		switch {
+		case len(p[1]) == 4 || s.Order == "ymd":
+			y, m, day = p[1], p[2], p[3]
+		case s.Order == "dmy":
+			day, m, y = p[1], p[2], p[3]
+		default:
+			m, day, y = p[1], p[2], p[3]
+		}
+		if len(day) > 2 {
+			return time.Time{}, false
+		}
+	} else {
+		return time.Time{}, false
+	}
+
+	year, _ := strconv.Atoi(y)
+	switch len(y) {
+	case 2:
+		year = s.fullYear(year)
+	case 4:
+	default:
+		return time.Time{}, false
+	}
+	month, _ := strconv.Atoi(m)
+	dd, _ := strconv.Atoi(day)
+	return calendarDate(year, month, dd, s.loc)
+}
+
+// fullYear 两位年份按 PivotYear 补全世纪
+func (s *DateStrategy) fullYear(yy int) int {
+	if yy < s.PivotYear {
+		return 2000 + yy
+	}
+	return 1900 + yy
+}
+
+func (s *DateStrategy) bound(b *dateBound) time.Time {
+	if b.today {
+		return dateOf(time.Now().In(s.loc))
+	}
+	return b.date
+}
+
+// calendarDate 构造日期并校验其存在（time.Date 会把 2 月 30 日顺延为 3 月 2 日）
+func calendarDate(year, month, day int, loc *time.Location) (time.Time, bool) {
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, loc)
+	if t.Year() != year || int(t.Month()) != month || t.Day() != day {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// dateOf 去掉时间部分，用于范围比较
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// excelSerialTime Excel（1900 日期系统）序列号转日期，小数部分为一天中的时间。
+// Excel 将 1900 年视为闰年，序列号 60 对应不存在的 1900-02-29，之前的序列号需少算一天
+func excelSerialTime(v float64, loc *time.Location) (time.Time, bool) {
+	if v < 1 || v >= excelMaxSerial+1 || (v >= 60 && v < 61) {
+		return time.Time{}, false
+	}
+	base := time.Date(1899, 12, 30, 0, 0, 0, 0, loc)
+	if v < 60 {
+		base = base.AddDate(0, 0, 1)
+	}
+	days := math.Floor(v)
+	seconds := math.Round((v - days) * 86400)
+	return base.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second), true
+}
+
+// goDateLayout 将 yyyy-MM-dd 形式的格式转换为 Go 布局；除 T 外不允许字母、数字与下划线作为分隔符，
+// 避免与 Go 布局中的占位符冲突
+func goDateLayout(format string) (layout string, shortYear bool, err error) {
+	var b strings.Builder
+	for i := 0; i < len(format); {
+		matched := false
+		for _, tok := range dateTokens {
+			if strings.HasPrefix(format[i:], tok.token) {
+				b.WriteString(tok.layout)
+				shortYear = shortYear || tok.token == "yy"
+				i += len(tok.token)
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+		c := format[i]
+		if c != 'T' && (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return "", false, fmt.Errorf("unsupported character %q in %q", c, format)
+		}
+		b.WriteByte(c)
+		i++
+	}
+	return b.String(), shortYear, nil
+}
+
+// loadTimezone 支持 +08:00 形式的固定时差（部署镜像未安装 tzdata）与 IANA 时区名
+func loadTimezone(name string) (*time.Location, error) {
+	if m := regexUTCOffset.FindStringSubmatch(name); m != nil {
+		h, _ := strconv.Atoi(m[2])
+		mm, _ := strconv.Atoi(m[3])
+		offset := h*3600 + mm*60
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(name, offset), nil
+	}
+	return time.LoadLocation(name)
+}
+
+func parseDateBound(v string) (*dateBound, error) {
+	switch v {
+	case "":
+		return nil, nil
+	case "today":
+		return &dateBound{today: true}, nil
+	}
+	t, err := time.Parse(isoDateLayout, v)
+	if err != nil {
+		return nil, err
+	}
+	return &dateBound{date: t}, nil
+}
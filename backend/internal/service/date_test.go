@@ -0,0 +1,84 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDateStrategy(t *testing.T) {
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	tests := []struct {
+		name     string
+		params   string
+		input    string
+		want     string
+		wantCode string
+	}{
+		{"default", `{}`, "2024/2/29", "2024-02-29", ""},
+		{"default not leap", `{}`, "2023/2/29", "2023/2/29", ErrCodeInvalidDate},
+		{"default compact", `{}`, "20231225", "2023-12-25", ""},
+		{"default ambiguous", `{}`, "25/12/2023", "25/12/2023", ErrCodeInvalidDate},
+		{"order dmy", `{"order": "dmy"}`, "25/12/2023", "2023-12-25", ""},
+		{"order mdy", `{"order": "mdy"}`, "12/25/23", "2023-12-25", ""},
+		{"order keeps year first", `{"order": "mdy"}`, "2023-12-25", "2023-12-25", ""},
+		{"layouts", `{"layouts": ["dd/MM/yyyy", "d MMM yyyy"]}`, "5 Mar 2023", "2023-03-05", ""},
+		{"layouts only", `{"layouts": ["dd/MM/yyyy"]}`, "2023-03-05", "2023-03-05", ErrCodeInvalidDate},
+		{"layout with time", `{"layouts": ["yyyy-MM-dd HH:mm:ss"], "format": "yyyy/MM/dd HH:mm"}`, "2023-03-05 08:30:00", "2023/03/05 08:30", ""},
+		{"layout calendar", `{"layouts": ["dd/MM/yyyy"]}`, "31/04/2023", "31/04/2023", ErrCodeInvalidDate},
+		{"pivot", `{"layouts": ["dd.MM.yy"], "pivot_year": 30}`, "01.01.45", "1945-01-01", ""},
+		{"pivot after", `{"layouts": ["dd.MM.yy"], "pivot_year": 30}`, "01.01.29", "2029-01-01", ""},
+		{"pivot leap", `{"layouts": ["dd.MM.yy"], "pivot_year": 0}`, "29.02.00", "29.02.00", ErrCodeInvalidDate}, // 1900 年不是闰年
+		{"chinese layout", `{"layouts": ["yyyy年M月d日"]}`, "2023年3月5日", "2023-03-05", ""},
+		{"format", `{"format": "yyyy年M月d日"}`, "2023-03-05", "2023年3月5日", ""},
+		{"excel serial", `{"excel_serial": true}`, "45000", "2023-03-15", ""},
+		{"excel serial with time", `{"excel_serial": true, "format": "yyyy-MM-dd HH:mm"}`, "45000.75", "2023-03-15 18:00", ""},
+		{"excel 1900 bug", `{"excel_serial": true}`, "61", "1900-03-01", ""},
+		{"excel fake leap day", `{"excel_serial": true}`, "60", "60", ErrCodeInvalidDate},
+		{"excel disabled", `{}`, "45000", "45000", ErrCodeInvalidDate},
+		{"compact before excel", `{"excel_serial": true}`, "20231225", "2023-12-25", ""},
+		{"timestamp", `{"timestamp": "s", "timezone": "+08:00"}`, "1700000000", "2023-11-15", ""},
+		{"timestamp ms", `{"timestamp": "ms", "timezone": "UTC", "format": "yyyy-MM-ddTHH:mm:ss"}`, "1700000000000", "2023-11-14T22:13:20", ""},
+		{"min", `{"min": "1950-01-01"}`, "1949-12-31", "1949-12-31", ErrCodeDateTooEarly},
+		{"max today", `{"max": "today"}`, tomorrow, tomorrow, ErrCodeDateTooLate},
+		{"within range", `{"min": "1950-01-01", "max": "today"}`, "1990年1月1日", "1990-01-01", ""},
+		{"empty", `{}`, " ", "", ErrCodeRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newStrategy(ruleSpec("date", tt.params))
+			if err != nil {
+				t.Fatalf("newStrategy() error = %v", err)
+			}
+			got, err := s.Clean(tt.input)
+			var re *RuleError
+			if got != tt.want || (tt.wantCode == "") != (err == nil) || (err != nil && (!errors.As(err, &re) || re.Code != tt.wantCode)) {
+				t.Errorf("Clean(%q) = %q, %v; want %q, %s", tt.input, got, err, tt.want, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestDateStrategy_Params(t *testing.T) {
+	tests := []struct {
+		params    string
+		wantField string
+	}{
+		{`{"layouts": ["yyyy-MM-dd"], "pivot_year": 30, "timezone": "-05:30", "min": "today", "max": "2099-12-31"}`, ""},
+		{`{"layouts": ["dd/MM/yyyy", "YYYY-MM-DD"]}`, "layouts"},
+		{`{"format": "yyyy-MM-dd 1"}`, "format"},
+		{`{"pivot_year": 101}`, "pivot_year"},
+		{`{"order": "ydm"}`, "order"},
+		{`{"timestamp": "us"}`, "timestamp"},
+		{`{"timezone": "Mars/Olympus"}`, "timezone"},
+		{`{"min": "01/01/1950"}`, "min"},
+		{`{"min": "2000-01-01", "max": "1999-12-31"}`, "min"},
+	}
+	for _, tt := range tests {
+		_, err := newStrategy(ruleSpec("date", tt.params))
+		var pe *ParamError
+		if tt.wantField == "" && err != nil || tt.wantField != "" && (!errors.As(err, &pe) || pe.Field != tt.wantField) {
+			t.Errorf("newStrategy(%s) error = %v, want error on %q", tt.params, err, tt.wantField)
+		}
+	}
+}
@@ -0,0 +1,959 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"etl-tool/internal/model"
+	"etl-tool/internal/utils"
+
+	"github.com/mozillazg/go-pinyin"
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+)
+
+// 去重：在清洗之后按配置的键识别重复记录。
+//   - 每个键由一个或多个字段组成，所有字段都匹配时视为重复；多个键之间为"或"，通过任一键相连的记录属于同一重复组
+//   - 字段匹配方式：exact（NFKC 规范化，忽略大小写与空白）、phone（只比较数字，忽略 86 / 0086 前缀）、
+//     pinyin（拼音姓名忽略声调、大小写与姓名顺序，如 "Zhang San" 与 "san zhāng"；汉字转写为不带声调的拼音，张三与章三、Zhang San 相同）、
+//     edit（编辑距离不超过 max_distance 且小于较长值长度的一半，用于姓名错别字）
+//   - 含 edit 字段的键至少还需要一个非 edit 字段用于分块，避免在全部记录之间两两比较
+//   - 任一字段为空的记录不参与该键
+//
+// 同组记录按 (批次, 行号) 排序，组 ID 为最早记录的 ID。保留策略：keep_first 保留最早的记录，keep_last 保留最晚的记录，
+// merge 保留本批次最早的记录，并用组内其他记录补全其空白列（写入版本，可撤销）。其余记录的 dup_of 指向保留的记录。
+// scope 为 user（同一用户的全部已完成批次）或 batches（指定批次）时跨批次匹配，其他批次的记录只参与匹配，不会被修改。
+//
+// 去重作为批量操作执行：上传时通过 dedup 字段配置后在导入完成时自动执行，也可通过 /batches/:id/dedup 重新执行。示例：
+//
+//	{"keys": [{"name": "phone", "fields": ["phone"]},
+//	          {"name": "name_date", "fields": [{"field": "name", "match": "edit", "max_distance": 1}, "date"]}],
+//	 "policy": "keep_first", "scope": "user"}
+
+// 保留策略与匹配范围
+const (
+	DedupKeepFirst = "keep_first"
+	DedupKeepLast  = "keep_last"
+	DedupMerge     = "merge"
+
+	DedupScopeBatch   = "batch"
+	DedupScopeUser    = "user"
+	DedupScopeBatches = "batches"
+)
+
+// 字段匹配方式
+const (
+	MatchExact  = "exact"
+	MatchPhone  = "phone"
+	MatchPinyin = "pinyin"
+	MatchEdit   = "edit"
+)
+
+const (
+	dedupMaxDistance = 3
+	dedupMaxBlock    = 500 // 含 edit 字段的键在一个分块内两两比较的上限，超出时只合并完全相同的值
+)
+
+// DedupConfig 去重配置
+type DedupConfig struct {
+	Keys     []DedupKey `json:"keys"`
+	Policy   string     `json:"policy"`
+	Scope    string     `json:"scope"`
+	BatchIDs []uint     `json:"batch_ids,omitempty"` // scope 为 batches 时参与匹配的其他批次
+}
+
+// DedupKey 去重键，Name 记录在命中的记录上（dup_match）
+type DedupKey struct {
+	Name   string       `json:"name"`
+	Fields []DedupField `json:"fields"`
+}
+
+// DedupField 去重键中的字段：逻辑字段或源表头，Match 默认为 exact（phone 字段默认为 phone）
+type DedupField struct {
+	Field       string `json:"field"`
+	Match       string `json:"match,omitempty"`
+	MaxDistance int    `json:"max_distance,omitempty"` // edit 允许的最大编辑距离，默认 1
+}
+
+// UnmarshalJSON 字段也可以直接写为字段名
+func (f *DedupField) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*f = DedupField{Field: name}
+		return nil
+	}
+	type plain DedupField
+	return json.Unmarshal(data, (*plain)(f))
+}
+
+// defaultDedupKeys 未配置键时的默认键：手机号相同，或姓名相近且日期相同
+func defaultDedupKeys() []DedupKey {
+	return []DedupKey{
+		{Name: "phone", Fields: []DedupField{{Field: FieldPhone}}},
+		{Name: "name+date", Fields: []DedupField{{Field: FieldName, Match: MatchEdit}, {Field: FieldDate}}},
+	}
+}
+
+// ParseDedupConfig 解析并校验去重配置，补全默认值；raw 为空时返回 nil（不去重）
+func ParseDedupConfig(raw string) (*DedupConfig, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var cfg DedupConfig
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return nil, fmt.Errorf("invalid dedup config: %w", err)
+	}
+	if err := cfg.normalize(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// normalize 校验配置并补全默认值
+func (c *DedupConfig) normalize() error {
+	if c.Policy == "" {
+		c.Policy = DedupKeepFirst
+	}
+	if !oneOf(c.Policy, []string{DedupKeepFirst, DedupKeepLast, DedupMerge}) {
+		return fmt.Errorf("dedup policy: unknown policy %q, expected keep_first/keep_last/merge", c.Policy)
+	}
+	if c.Scope == "" {
+		c.Scope = DedupScopeBatch
+	}
+	if !oneOf(c.Scope, []string{DedupScopeBatch, DedupScopeUser, DedupScopeBatches}) {
+		return fmt.Errorf("dedup scope: unknown scope %q, expected batch/user/batches", c.Scope)
+	}
+	if c.Scope == DedupScopeBatches && len(c.BatchIDs) == 0 {
+		return fmt.Errorf("dedup batch_ids: batch_ids is required when scope is batches")
+	}
+	if len(c.Keys) == 0 {
+		c.Keys = defaultDedupKeys()
+	}
+
+	for i := range c.Keys {
+		key := &c.Keys[i]
+		if len(key.Fields) == 0 {
+			return fmt.Errorf("dedup keys[%d].fields: at least one field is required", i)
+		}
+		blocking := false
+		names := make([]string, len(key.Fields))
+		for j := range key.Fields {
+			f := &key.Fields[j]
+			path := fmt.Sprintf("dedup keys[%d].fields[%d]", i, j)
+			if f.Field = strings.TrimSpace(f.Field); f.Field == "" {
+				return fmt.Errorf("%s.field: field is required", path)
+			}
+			if f.Match == "" {
+				f.Match = MatchExact
+				if f.Field == FieldPhone {
+					f.Match = MatchPhone
+				}
+			}
+			if !oneOf(f.Match, []string{MatchExact, MatchPhone, MatchPinyin, MatchEdit}) {
+				return fmt.Errorf("%s.match: unknown match %q, expected exact/phone/pinyin/edit", path, f.Match)
+			}
+			if f.Match == MatchEdit {
+				if f.MaxDistance == 0 {
+					f.MaxDistance = 1
+				}
+				if f.MaxDistance < 1 || f.MaxDistance > dedupMaxDistance {
+					return fmt.Errorf("%s.max_distance: must be between 1 and %d", path, dedupMaxDistance)
+				}
+			} else {
+				blocking = true
+			}
+			names[j] = f.Field
+		}
+		if !blocking {
+			return fmt.Errorf("dedup keys[%d]: a key with edit fields needs at least one exact/phone/pinyin field", i)
+		}
+		if key.Name == "" {
+			key.Name = strings.Join(names, "+")
+		}
+		key.Name = utils.Truncate(key.Name, 100)
+	}
+	return nil
+}
+
+// fields 返回配置引用的全部字段（去重后按出现顺序）
+func (c *DedupConfig) fields() []string {
+	var fields []string
+	for _, key := range c.Keys {
+		for _, f := range key.Fields {
+			if !oneOf(f.Field, fields) {
+				fields = append(fields, f.Field)
+			}
+		}
+	}
+	return fields
+}
+
+// fieldIndex 返回字段在 fields() 中的位置
+func (c *DedupConfig) fieldIndex() map[string]int {
+	idx := make(map[string]int)
+	for i, f := range c.fields() {
+		idx[f] = i
+	}
+	return idx
+}
+
+// values 返回记录在键上的分块值（非 edit 字段的规范化值）与 edit 字段的规范化值；任一字段为空时 ok 为 false
+func (key DedupKey) values(e *dedupEntry, fieldIdx map[string]int) (block string, fuzzy [][]rune, ok bool) {
+	var parts []string
+	for _, f := range key.Fields {
+		v := dedupNormalize(f.Match, e.Values[fieldIdx[f.Field]])
+		if v == "" {
+			return "", nil, false
+		}
+		if f.Match == MatchEdit {
+			fuzzy = append(fuzzy, []rune(v))
+		} else {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, "\x1f"), fuzzy, true
+}
+
+// dedupNormalize 按匹配方式规范化字段值，用于分块与比较
+func dedupNormalize(match, v string) string {
+	switch match {
+	case MatchPhone:
+		return normalizeDedupPhone(v)
+	case MatchPinyin:
+		return normalizeDedupPinyin(v)
+	default:
+		return normalizeDedupText(v)
+	}
+}
+
+// normalizeDedupText NFKC 规范化并去除空白、转为小写
+func normalizeDedupText(v string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, strings.ToLower(norm.NFKC.String(v)))
+}
+
+// normalizeDedupPhone 只保留数字，并去掉 +86 / 0086 国家码
+func normalizeDedupPhone(v string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, norm.NFKC.String(v))
+	switch {
+	case len(digits) == 15 && strings.HasPrefix(digits, "0086"):
+		return digits[4:]
+	case len(digits) == 13 && strings.HasPrefix(digits, "86"):
+		return digits[2:]
+	}
+	return digits
+}
+
+// normalizeDedupPinyin 拼音姓名去掉声调并忽略大小写、分隔符与音节顺序；汉字按常用读音转写为拼音（ü 记为 u）
+func normalizeDedupPinyin(v string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(norm.NFKC.String(v))) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			if py := pinyin.SinglePinyin(r, dedupPinyinArgs); len(py) > 0 {
+				b.WriteString(" " + strings.ReplaceAll(py[0], "v", "u") + " ")
+			} else {
+				b.WriteRune(r) // 没有读音的汉字原样参与比较
+			}
+		case unicode.Is(unicode.Mn, r):
+		case unicode.IsLetter(r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	tokens := strings.Fields(b.String())
+	sort.Strings(tokens)
+	return strings.Join(tokens, "")
+}
+
+// dedupPinyinArgs 不带声调、每个字只取常用读音；没有读音的字返回空
+var dedupPinyinArgs = pinyin.Args{Style: pinyin.Normal, Fallback: func(rune, pinyin.Args) []string { return nil }}
+
+// levenshtein 按字符（rune）计算编辑距离
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// editMatch 编辑距离不超过 maxDistance，且小于较长值长度的一半（避免 "张三" 与 "李三" 这类短姓名误判）
+func editMatch(a, b []rune, maxDistance int) bool {
+	d := levenshtein(a, b)
+	return d <= maxDistance && d*2 < max(len(a), len(b))
+}
+
+// dedupEntry 参与去重的记录，Values 与 DedupConfig.fields() 一一对应
+type dedupEntry struct {
+	ID       uint
+	BatchID  uint
+	RowIndex int
+	Values   []string
+}
+
+// dupMember 重复组成员，Match 为最先命中的去重键
+type dupMember struct {
+	*dedupEntry
+	Match string
+}
+
+// dupGroup 重复组：成员按 (批次, 行号) 排序，ID 为最早成员的 ID
+type dupGroup struct {
+	ID       uint
+	Survivor uint
+	Members  []dupMember
+}
+
+// groupDuplicates 按去重键合并重复记录并选出保留的记录；只返回包含目标批次记录的组
+func groupDuplicates(entries []dedupEntry, cfg *DedupConfig, target uint) []dupGroup {
+	parent := make([]int, len(entries))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	match := make([]string, len(entries))
+	link := func(i, j int, key string) {
+		for _, k := range []int{i, j} {
+			if match[k] == "" {
+				match[k] = key
+			}
+		}
+		if ri, rj := find(i), find(j); ri != rj {
+			parent[rj] = ri
+		}
+	}
+
+	fieldIdx := cfg.fieldIndex()
+	for _, key := range cfg.Keys {
+		blocks := make(map[string][]int)
+		fuzzy := make([][][]rune, len(entries)) // edit 字段的规范化值
+		for i := range entries {
+			b, f, ok := key.values(&entries[i], fieldIdx)
+			if ok {
+				fuzzy[i] = f
+				blocks[b] = append(blocks[b], i)
+			}
+		}
+
+		for _, members := range blocks {
+			if len(members) < 2 {
+				continue
+			}
+			if len(fuzzy[members[0]]) == 0 || len(members) > dedupMaxBlock {
+				// 无 edit 字段（或分块过大）时按完全相同的值合并
+				same := make(map[string]int)
+				for _, i := range members {
+					k := ""
+					for _, v := range fuzzy[i] {
+						k += string(v) + "\x1f"
+					}
+					if first, ok := same[k]; ok {
+						link(first, i, key.Name)
+					} else {
+						same[k] = i
+					}
+				}
+				continue
+			}
+			edits := editFields(key)
+			for x := 0; x < len(members); x++ {
+				for y := x + 1; y < len(members); y++ {
+					a, b := fuzzy[members[x]], fuzzy[members[y]]
+					ok := true
+					for k, f := range edits {
+						if !editMatch(a[k], b[k], f.MaxDistance) {
+							ok = false
+							break
+						}
+					}
+					if ok {
+						link(members[x], members[y], key.Name)
+					}
+				}
+			}
+		}
+	}
+
+	components := make(map[int][]int)
+	for i := range entries {
+		if match[i] != "" {
+			r := find(i)
+			components[r] = append(components[r], i)
+		}
+	}
+	var groups []dupGroup
+	for _, idx := range components {
+		if len(idx) < 2 {
+			continue
+		}
+		members := make([]dupMember, len(idx))
+		for k, i := range idx {
+			members[k] = dupMember{dedupEntry: &entries[i], Match: match[i]}
+		}
+		sort.Slice(members, func(i, j int) bool {
+			if members[i].BatchID != members[j].BatchID {
+				return members[i].BatchID < members[j].BatchID
+			}
+			return members[i].RowIndex < members[j].RowIndex
+		})
+		survivor := -1
+		for k := range members {
+			if members[k].BatchID == target {
+				survivor = k
+				break
+			}
+		}
+		if survivor < 0 {
+			continue
+		}
+		switch cfg.Policy {
+		case DedupKeepFirst:
+			survivor = 0
+		case DedupKeepLast:
+			survivor = len(members) - 1
+		}
+		groups = append(groups, dupGroup{ID: members[0].ID, Survivor: members[survivor].ID, Members: members})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups
+}
+
+// editFields 返回键中 edit 字段，顺序与 groupDuplicates 中的规范化值一致
+func editFields(key DedupKey) []DedupField {
+	var fields []DedupField
+	for _, f := range key.Fields {
+		if f.Match == MatchEdit {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// mergeUpdates 用组内其他记录（按顺序）补全保留记录的空白列；其他批次的记录按列名或逻辑字段取值
+func mergeUpdates(sc *batchSchema, survivor *model.Record, others []model.Record) map[string]interface{} {
+	updates := make(map[string]interface{})
+	for _, col := range sc.Columns {
+		if strings.TrimSpace(sc.valueOf(survivor, col)) != "" {
+			continue
+		}
+		for i := range others {
+			v := others[i].Fields[col.Name]
+			if v == "" && col.Field != "" {
+				v = fixedValue(&others[i], col.Field)
+			}
+			if strings.TrimSpace(v) != "" {
+				updates[col.Name] = v
+				break
+			}
+		}
+	}
+	return updates
+}
+
+// fixedValue 返回记录中逻辑字段对应的固定列
+func fixedValue(rec *model.Record, field string) string {
+	switch field {
+	case FieldName:
+		return rec.Name
+	case FieldPhone:
+		return rec.Phone
+	case FieldDate:
+		return rec.Date
+	case FieldAddress:
+		return rec.Address
+	}
+	return ""
+}
+
+// DedupRequest 去重请求；未指定 keys、policy 与 scope 时使用批次上传时保存的配置
+type DedupRequest struct {
+	DedupConfig
+	Reason string `json:"reason"`
+}
+
+// DedupBatch 校验配置并创建后台去重操作，生效的配置保存到批次供下次使用
+func (s *CleanerService) DedupBatch(batchID uint, req DedupRequest, username string) (*model.BulkOperation, error) {
+	var batch model.ImportBatch
+	if err := s.DB.First(&batch, batchID).Error; err != nil {
+		return nil, err
+	}
+	if err := s.checkBulkAllowed(&batch); err != nil {
+		return nil, err
+	}
+
+	cfg := &req.DedupConfig
+	if len(cfg.Keys) == 0 && cfg.Policy == "" && cfg.Scope == "" && batch.Dedup != "" {
+		saved, err := ParseDedupConfig(batch.Dedup)
+		if err != nil {
+			return nil, err
+		}
+		cfg = saved
+	} else if err := cfg.normalize(); err != nil {
+		return nil, err
+	}
+	if _, err := s.dedupBatchIDs(&batch, cfg); err != nil {
+		return nil, err
+	}
+
+	raw, _ := json.Marshal(cfg)
+	op, err := s.createDedupOperation(&batch, cfg, req.Reason, username, func(tx *gorm.DB) error {
+		return tx.Model(&batch).Update("dedup", string(raw)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	go s.runBulkOperation(op.ID)
+	return op, nil
+}
+
+// dedupAfterImport 导入完成后按上传时的配置同步执行去重，失败只记录在操作上，不影响批次状态
+func (s *CleanerService) dedupAfterImport(batch *model.ImportBatch) {
+	cfg, err := ParseDedupConfig(batch.Dedup)
+	if err != nil || cfg == nil {
+		log.Printf("[Dedup] Batch %d: skipped, invalid config: %v", batch.ID, err)
+		return
+	}
+	op, err := s.createDedupOperation(batch, cfg, "", batch.CreatedBy, nil)
+	if err != nil {
+		log.Printf("[Dedup] Batch %d: failed to create operation: %v", batch.ID, err)
+		return
+	}
+	s.runBulkOperation(op.ID)
+}
+
+// createDedupOperation 创建去重操作，extra 与创建在同一事务中执行（保存生效的配置），可为 nil
+func (s *CleanerService) createDedupOperation(batch *model.ImportBatch, cfg *DedupConfig, reason, username string, extra func(tx *gorm.DB) error) (*model.BulkOperation, error) {
+	params, _ := json.Marshal(BulkParams{Dedup: cfg})
+	op := &model.BulkOperation{
+		BatchID:   batch.ID,
+		Type:      OpDedup,
+		Params:    string(params),
+		Filter:    "{}",
+		Reason:    utils.Truncate(reason, 255),
+		Status:    model.OperationStatusPending,
+		CreatedBy: username,
+	}
+	var total int64
+	s.DB.Model(&model.Record{}).Where("batch_id = ?", batch.ID).Count(&total)
+	op.Total = int(total)
+	if err := s.createBulkOperation(op, extra); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// dedupBatchIDs 返回参与匹配的批次（目标批次在前）；其他批次只能是同一用户的已完成批次
+func (s *CleanerService) dedupBatchIDs(batch *model.ImportBatch, cfg *DedupConfig) ([]uint, error) {
+	ids := []uint{batch.ID}
+	if cfg.Scope == DedupScopeBatch {
+		return ids, nil
+	}
+	query := s.DB.Model(&model.ImportBatch{}).
+		Where("id <> ? AND created_by = ? AND status = ?", batch.ID, batch.CreatedBy, model.BatchStatusCompleted)
+	if cfg.Scope == DedupScopeBatches {
+		query = query.Where("id IN ?", cfg.BatchIDs)
+	}
+	var others []uint
+	if err := query.Order("id asc").Pluck("id", &others).Error; err != nil {
+		return nil, err
+	}
+	if cfg.Scope == DedupScopeBatches {
+		found := make(map[uint]bool, len(others))
+		for _, id := range others {
+			found[id] = true
+		}
+		for _, id := range cfg.BatchIDs {
+			if id != batch.ID && !found[id] {
+				return nil, fmt.Errorf("batch %d is not a completed batch of the same user", id)
+			}
+		}
+	}
+	return append(ids, others...), nil
+}
+
+// runDedup 读取参与匹配的记录，分组后先清除目标批次原有的标记再写入新的标记；merge 时补全保留记录并写入版本
+func (s *CleanerService) runDedup(op *model.BulkOperation) error {
+	var params BulkParams
+	if err := json.Unmarshal([]byte(op.Params), &params); err != nil {
+		return err
+	}
+	cfg := params.Dedup
+	if cfg == nil {
+		return fmt.Errorf("missing dedup config")
+	}
+	batch, engine, schema, err := s.loadBatchSchema(op.BatchID)
+	if err != nil {
+		return err
+	}
+	batchIDs, err := s.dedupBatchIDs(batch, cfg)
+	if err != nil {
+		return err
+	}
+
+	entries, err := s.loadDedupEntries(op, batchIDs, cfg)
+	if err != nil {
+		return err
+	}
+	groups := groupDuplicates(entries, cfg, op.BatchID)
+
+	if err := s.clearDedupFlags(op.BatchID); err != nil {
+		return err
+	}
+	if err := s.writeDedupFlags(op, groups); err != nil {
+		return err
+	}
+	if cfg.Policy == DedupMerge {
+		if err := s.mergeDuplicates(op, groups, schema, engine); err != nil {
+			return err
+		}
+	}
+	s.saveProgress(op)
+	return nil
+}
+
+// loadDedupEntries 读取目标批次的全部记录（计入进度），其他批次按页扫描，只保留可能与目标批次相连的记录（见 expandDedupEntries）
+func (s *CleanerService) loadDedupEntries(op *model.BulkOperation, batchIDs []uint, cfg *DedupConfig) ([]dedupEntry, error) {
+	var entries []dedupEntry
+	err := s.scanDedupEntries(batchIDs[0], cfg.fields(), func(page []dedupEntry) {
+		entries = append(entries, page...)
+		op.Processed += len(page)
+		s.saveProgress(op)
+	})
+	if err != nil || len(batchIDs) == 1 {
+		return entries, err
+	}
+	return expandDedupEntries(entries, cfg, func(fn func(page []dedupEntry)) error {
+		for _, id := range batchIDs[1:] {
+			if err := s.scanDedupEntries(id, cfg.fields(), fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// expandDedupEntries 逐页扫描其他批次，保留与已保留记录在某个键上分块相同的记录，其余记录不会留在内存中。
+// 新保留的记录可能带来新的分块（通过其他键间接相连），因此重复扫描，直到不再出现新的分块
+func expandDedupEntries(entries []dedupEntry, cfg *DedupConfig, scan func(fn func(page []dedupEntry)) error) ([]dedupEntry, error) {
+	fieldIdx := cfg.fieldIndex()
+	blocks := make([]map[string]bool, len(cfg.Keys))
+	for k := range blocks {
+		blocks[k] = make(map[string]bool)
+	}
+	// addBlocks 记录记录所在的分块，返回是否出现了新的分块
+	addBlocks := func(e *dedupEntry) bool {
+		added := false
+		for k, key := range cfg.Keys {
+			if b, _, ok := key.values(e, fieldIdx); ok && !blocks[k][b] {
+				blocks[k][b] = true
+				added = true
+			}
+		}
+		return added
+	}
+	inBlocks := func(e *dedupEntry) bool {
+		for k, key := range cfg.Keys {
+			if b, _, ok := key.values(e, fieldIdx); ok && blocks[k][b] {
+				return true
+			}
+		}
+		return false
+	}
+	for i := range entries {
+		addBlocks(&entries[i])
+	}
+
+	kept := make(map[uint]bool)
+	for grown := true; grown; {
+		grown = false
+		err := scan(func(page []dedupEntry) {
+			for i := range page {
+				e := &page[i]
+				if kept[e.ID] || !inBlocks(e) {
+					continue
+				}
+				kept[e.ID] = true
+				entries = append(entries, *e)
+				if addBlocks(e) {
+					grown = true
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// scanDedupEntries 按行号分页读取批次记录的去重字段，每页调用一次 fn
+func (s *CleanerService) scanDedupEntries(batchID uint, fields []string, fn func(page []dedupEntry)) error {
+	_, _, schema, err := s.loadBatchSchema(batchID)
+	if err != nil {
+		return err
+	}
+	cols := make([]*model.BatchColumn, len(fields))
+	for i, f := range fields {
+		if col, ok := schema.resolveColumn(f); ok {
+			cols[i] = &col
+		}
+	}
+
+	lastRow := 0
+	for {
+		var recs []model.Record
+		if err := s.DB.Select("id, batch_id, row_index, name, phone, date, address, fields").
+			Where("batch_id = ? AND row_index > ?", batchID, lastRow).
+			Order("row_index asc").Limit(bulkPageSize).Find(&recs).Error; err != nil {
+			return err
+		}
+		if len(recs) == 0 {
+			return nil
+		}
+		lastRow = recs[len(recs)-1].RowIndex
+		page := make([]dedupEntry, len(recs))
+		for i := range recs {
+			page[i] = dedupEntry{ID: recs[i].ID, BatchID: batchID, RowIndex: recs[i].RowIndex, Values: make([]string, len(fields))}
+			for k, col := range cols {
+				if col != nil {
+					page[i].Values[k] = schema.valueOf(&recs[i], *col)
+				}
+			}
+		}
+		fn(page)
+	}
+}
+
+// clearDedupFlags 清除批次记录的去重标记
+func (s *CleanerService) clearDedupFlags(batchID uint) error {
+	return s.DB.Model(&model.Record{}).Where("batch_id = ? AND dup_group IS NOT NULL", batchID).
+		Updates(map[string]interface{}{"dup_group": nil, "dup_of": nil, "dup_match": ""}).Error
+}
+
+// writeDedupFlags 标记目标批次中的重复组成员，每页一个事务
+func (s *CleanerService) writeDedupFlags(op *model.BulkOperation, groups []dupGroup) error {
+	type flag struct {
+		id      uint
+		updates map[string]interface{}
+	}
+	var flags []flag
+	for _, g := range groups {
+		op.DupGroups++
+		for _, m := range g.Members {
+			if m.BatchID != op.BatchID {
+				continue
+			}
+			var dupOf *uint
+			if m.ID != g.Survivor {
+				dupOf = &g.Survivor
+				op.Duplicates++
+			}
+			flags = append(flags, flag{m.ID, map[string]interface{}{"dup_group": g.ID, "dup_of": dupOf, "dup_match": m.Match}})
+		}
+	}
+
+	for start := 0; start < len(flags); start += bulkPageSize {
+		page := flags[start:min(start+bulkPageSize, len(flags))]
+		err := s.DB.Transaction(func(tx *gorm.DB) error {
+			for _, f := range page {
+				if err := tx.Model(&model.Record{}).Where("id = ? AND batch_id = ?", f.id, op.BatchID).
+					Updates(f.updates).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeDuplicates 用组内其他记录补全保留记录的空白列并重新校验（补入的值已清洗过），变化写入共享操作 ID 的版本
+func (s *CleanerService) mergeDuplicates(op *model.BulkOperation, groups []dupGroup, schema *batchSchema, engine *RuleEngine) error {
+	reason := bulkReason(op)
+	for start := 0; start < len(groups); start += bulkPageSize {
+		page := groups[start:min(start+bulkPageSize, len(groups))]
+		err := s.DB.Transaction(func(tx *gorm.DB) error {
+			var versions []model.RecordVersion
+			for _, g := range page {
+				var survivor model.Record
+				if err := tx.First(&survivor, "id = ? AND batch_id = ?", g.Survivor, op.BatchID).Error; err != nil {
+					return err
+				}
+				others, err := loadGroupRecords(tx, g)
+				if err != nil {
+					return err
+				}
+				updates := mergeUpdates(schema, &survivor, others)
+				if len(updates) == 0 {
+					continue
+				}
+				next, err := schema.applyCleanedUpdates(&survivor, updates, engine)
+				if err != nil {
+					return err
+				}
+				if err := recordScope(tx, &survivor).Updates(recordUpdateMap(&next)).Error; err != nil {
+					return err
+				}
+				countTransition(op, survivor.Status, next.Status)
+				versions = append(versions, newBulkVersion(&survivor, &next, reason, op.ID))
+			}
+			op.Changed += len(versions)
+			if len(versions) == 0 {
+				return nil
+			}
+			return tx.CreateInBatches(versions, bulkPageSize).Error
+		})
+		if err != nil {
+			return err
+		}
+		s.saveProgress(op)
+	}
+	return nil
+}
+
+// loadGroupRecords 按组内顺序读取保留记录以外的成员
+func loadGroupRecords(tx *gorm.DB, g dupGroup) ([]model.Record, error) {
+	byBatch := make(map[uint][]uint)
+	for _, m := range g.Members {
+		if m.ID != g.Survivor {
+			byBatch[m.BatchID] = append(byBatch[m.BatchID], m.ID)
+		}
+	}
+	found := make(map[uint]model.Record)
+	for batchID, ids := range byBatch {
+		var recs []model.Record
+		if err := tx.Where("batch_id = ? AND id IN ?", batchID, ids).Find(&recs).Error; err != nil {
+			return nil, err
+		}
+		for _, r := range recs {
+			found[r.ID] = r
+		}
+	}
+	others := make([]model.Record, 0, len(found))
+	for _, m := range g.Members {
+		if r, ok := found[m.ID]; ok {
+			others = append(others, r)
+		}
+	}
+	return others, nil
+}
+
+// clearUndoneDedup 撤销 dedup 后清除批次的去重标记（补全的值由 undo 按版本恢复）
+func (s *CleanerService) clearUndoneDedup(opID uint) {
+	var orig model.BulkOperation
+	if err := s.DB.First(&orig, opID).Error; err != nil || orig.Type != OpDedup {
+		return
+	}
+	if err := s.clearDedupFlags(orig.BatchID); err != nil {
+		log.Printf("[Dedup] Failed to clear duplicate flags of batch %d: %v", orig.BatchID, err)
+	}
+}
+
+// DuplicateGroup 重复组，Records 包含本批次的成员，以及其他批次中被引用的保留记录与最早记录
+type DuplicateGroup struct {
+	GroupID    uint           `json:"group_id"`
+	SurvivorID uint           `json:"survivor_id"`
+	Records    []model.Record `json:"records"`
+}
+
+// GetDuplicates 按组分页返回批次的重复记录
+func (s *CleanerService) GetDuplicates(batchID uint, page, pageSize int) ([]DuplicateGroup, int64, error) {
+	base := s.DB.Model(&model.Record{}).Where("batch_id = ? AND dup_group IS NOT NULL", batchID)
+	var total int64
+	if err := base.Session(&gorm.Session{}).Distinct("dup_group").Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var ids []uint
+	if err := base.Session(&gorm.Session{}).Distinct().Order("dup_group asc").
+		Offset((page-1)*pageSize).Limit(pageSize).Pluck("dup_group", &ids).Error; err != nil {
+		return nil, 0, err
+	}
+	groups := []DuplicateGroup{}
+	if len(ids) == 0 {
+		return groups, total, nil
+	}
+
+	var recs []model.Record
+	if err := s.DB.Where("batch_id = ? AND dup_group IN ?", batchID, ids).Order("row_index asc").Find(&recs).Error; err != nil {
+		return nil, 0, err
+	}
+	byGroup := make(map[uint]*DuplicateGroup, len(ids))
+	for _, id := range ids {
+		groups = append(groups, DuplicateGroup{GroupID: id})
+	}
+	for i := range groups {
+		byGroup[groups[i].GroupID] = &groups[i]
+	}
+	inBatch := make(map[uint]bool, len(recs))
+	for _, r := range recs {
+		inBatch[r.ID] = true
+	}
+
+	// 其他批次中被引用的记录：保留的记录（dup_of）与组 ID 对应的最早记录
+	var external []uint
+	for _, r := range recs {
+		g := byGroup[*r.DupGroup]
+		g.Records = append(g.Records, r)
+		if r.DupOf != nil {
+			g.SurvivorID = *r.DupOf
+		} else if g.SurvivorID == 0 {
+			g.SurvivorID = r.ID
+		}
+		for _, id := range []uint{*r.DupGroup, g.SurvivorID} {
+			if !inBatch[id] && !slices.Contains(external, id) {
+				external = append(external, id)
+			}
+		}
+	}
+	if len(external) > 0 {
+		var ext []model.Record
+		if err := s.DB.Where("batch_id <> ? AND id IN ?", batchID, external).Find(&ext).Error; err != nil {
+			return nil, 0, err
+		}
+		for _, r := range ext {
+			for i := range groups {
+				if groups[i].GroupID == r.ID || groups[i].SurvivorID == r.ID {
+					groups[i].Records = append([]model.Record{r}, groups[i].Records...)
+				}
+			}
+		}
+	}
+	return groups, total, nil
+}
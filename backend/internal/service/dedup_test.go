@@ -0,0 +1,228 @@
+package service
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"etl-tool/internal/model"
+)
+
+func TestParseDedupConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string
+	}{
+		{"empty", "", ""},
+		{"defaults", `{}`, ""},
+		{"string fields", `{"keys": [{"fields": ["phone", "姓名"]}], "policy": "merge"}`, ""},
+		{"bad policy", `{"policy": "drop"}`, "unknown policy"},
+		{"bad scope", `{"scope": "all"}`, "unknown scope"},
+		{"batches without ids", `{"scope": "batches"}`, "batch_ids is required"},
+		{"no fields", `{"keys": [{"name": "k"}]}`, "keys[0].fields"},
+		{"bad match", `{"keys": [{"fields": [{"field": "name", "match": "soundex"}]}]}`, "keys[0].fields[0].match"},
+		{"edit only", `{"keys": [{"fields": [{"field": "name", "match": "edit"}]}]}`, "needs at least one"},
+		{"distance too large", `{"keys": [{"fields": [{"field": "name", "match": "edit", "max_distance": 5}, "date"]}]}`, "max_distance"},
+		{"invalid json", `{"keys": 1}`, "invalid dedup config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseDedupConfig(tt.raw)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ParseDedupConfig() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseDedupConfig() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	cfg, _ := ParseDedupConfig(`{"keys": [{"fields": ["phone", {"field": "name", "match": "edit"}, "date"]}]}`)
+	key := cfg.Keys[0]
+	if cfg.Policy != DedupKeepFirst || cfg.Scope != DedupScopeBatch || key.Name != "phone+name+date" {
+		t.Errorf("defaults = %s/%s/%s", cfg.Policy, cfg.Scope, key.Name)
+	}
+	if key.Fields[0].Match != MatchPhone || key.Fields[1].MaxDistance != 1 || key.Fields[2].Match != MatchExact {
+		t.Errorf("field defaults = %+v", key.Fields)
+	}
+	if cfg, _ := ParseDedupConfig(`{}`); len(cfg.Keys) != 2 {
+		t.Errorf("default keys = %+v", cfg.Keys)
+	}
+}
+
+func TestDedupNormalize(t *testing.T) {
+	tests := []struct {
+		match string
+		a, b  string
+		same  bool
+	}{
+		{MatchPhone, "138-0013-8000", "+86 13800138000", true},
+		{MatchPhone, "008613800138000", "13800138000", true},
+		{MatchPhone, "13800138000", "13800138001", false},
+		{MatchExact, "Zhang San", "zhangsan", true},
+		{MatchExact, "ＡＢＣ", "abc", true},
+		{MatchPinyin, "Zhāng Sān", "san zhang", true},
+		{MatchPinyin, "ZHANG-San", "Zhang San", true},
+		{MatchPinyin, "张三", "张 三", true},
+		{MatchPinyin, "Zhang San", "Zhang Shan", false},
+		{MatchPinyin, "张三", "章三", true},
+		{MatchPinyin, "张三", "Zhang San", true},
+		{MatchPinyin, "吕布", "Lǚ Bù", true},
+		{MatchPinyin, "张三", "张山", false},
+	}
+	for _, tt := range tests {
+		a, b := dedupNormalize(tt.match, tt.a), dedupNormalize(tt.match, tt.b)
+		if (a == b) != tt.same {
+			t.Errorf("%s: %q -> %q, %q -> %q, want same = %t", tt.match, tt.a, a, tt.b, b, tt.same)
+		}
+	}
+}
+
+func TestEditMatch(t *testing.T) {
+	tests := []struct {
+		a, b string
+		max  int
+		want bool
+	}{
+		{"欧阳娜娜", "欧阳娜那", 1, true},
+		{"王小明", "王晓明", 1, true},
+		{"王小明", "王晓名", 1, false},
+		{"王小明", "王晓名", 2, false}, // 超过一半的字不同
+		{"张三", "张叁", 1, false},   // 两个字的姓名只允许完全相同
+		{"alexander", "alexandre", 2, true},
+	}
+	for _, tt := range tests {
+		if got := editMatch([]rune(tt.a), []rune(tt.b), tt.max); got != tt.want {
+			t.Errorf("editMatch(%q, %q, %d) = %t, want %t (distance %d)", tt.a, tt.b, tt.max, got, tt.want, levenshtein([]rune(tt.a), []rune(tt.b)))
+		}
+	}
+}
+
+func TestGroupDuplicates(t *testing.T) {
+	cfg, err := ParseDedupConfig(`{"keys": [
+		{"name": "phone", "fields": ["phone"]},
+		{"name": "name_date", "fields": [{"field": "name", "match": "edit"}, "date"]}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fields(): phone, name, date
+	entries := []dedupEntry{
+		{ID: 1, BatchID: 1, RowIndex: 1, Values: []string{"13800138000", "王小明", "1990-01-01"}}, // 其他批次
+		{ID: 11, BatchID: 2, RowIndex: 1, Values: []string{"+86 138 0013 8000", "王明", "2000-01-01"}},
+		{ID: 12, BatchID: 2, RowIndex: 2, Values: []string{"", "王晓明", "1990-01-01"}},
+		{ID: 13, BatchID: 2, RowIndex: 3, Values: []string{"13900000000", "李四", "1990-01-01"}},
+		{ID: 14, BatchID: 2, RowIndex: 4, Values: []string{"13700000000", "赵六", ""}},
+		{ID: 15, BatchID: 2, RowIndex: 5, Values: []string{"13700000000", "赵六", ""}},
+		{ID: 2, BatchID: 1, RowIndex: 2, Values: []string{"13600000000", "钱七", ""}}, // 只有其他批次的记录
+		{ID: 3, BatchID: 1, RowIndex: 3, Values: []string{"13600000000", "钱七", ""}},
+	}
+
+	tests := []struct {
+		policy   string
+		survivor map[uint]uint // 组 ID -> 保留的记录
+	}{
+		{DedupKeepFirst, map[uint]uint{1: 1, 14: 14}},
+		{DedupKeepLast, map[uint]uint{1: 12, 14: 15}},
+		{DedupMerge, map[uint]uint{1: 11, 14: 14}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			cfg.Policy = tt.policy
+			groups := groupDuplicates(entries, cfg, 2)
+			got := map[uint]uint{}
+			for _, g := range groups {
+				got[g.ID] = g.Survivor
+			}
+			if !reflect.DeepEqual(got, tt.survivor) {
+				t.Errorf("survivors = %v, want %v", got, tt.survivor)
+			}
+		})
+	}
+
+	cfg.Policy = DedupKeepFirst
+	groups := groupDuplicates(entries, cfg, 2)
+	var ids []uint
+	matches := map[uint]string{}
+	for _, m := range groups[0].Members {
+		ids = append(ids, m.ID)
+		matches[m.ID] = m.Match
+	}
+	if !reflect.DeepEqual(ids, []uint{1, 11, 12}) {
+		t.Errorf("members = %v, want [1 11 12]", ids)
+	}
+	if matches[11] != "phone" || matches[12] != "name_date" || matches[1] != "phone" {
+		t.Errorf("matches = %v", matches)
+	}
+}
+
+func TestExpandDedupEntries(t *testing.T) {
+	cfg, err := ParseDedupConfig(`{"keys": [
+		{"name": "phone", "fields": ["phone"]},
+		{"name": "name_date", "fields": [{"field": "name", "match": "edit"}, "date"]}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := []dedupEntry{
+		{ID: 11, BatchID: 2, RowIndex: 1, Values: []string{"13800138000", "王明", "2000-01-01"}},
+	}
+	// 其他批次分两页；ID 2 只能通过 ID 3 间接相连，且先于 ID 3 被扫描，需要第二遍扫描
+	pages := [][]dedupEntry{
+		{
+			{ID: 1, BatchID: 1, RowIndex: 1, Values: []string{"13900000000", "李四", "1990-01-01"}}, // 无关
+			{ID: 2, BatchID: 1, RowIndex: 2, Values: []string{"13700000000", "赵六", ""}},
+		},
+		{
+			{ID: 3, BatchID: 1, RowIndex: 3, Values: []string{"13700000000", "王小明", "2000-01-01"}},
+			{ID: 4, BatchID: 1, RowIndex: 4, Values: []string{"", "孙八", "2000-01-01"}}, // 分块相同但不相近
+		},
+	}
+	scans := 0
+	entries, err := expandDedupEntries(slices.Clone(target), cfg, func(fn func(page []dedupEntry)) error {
+		scans++
+		for _, p := range pages {
+			fn(slices.Clone(p))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []uint
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	if !reflect.DeepEqual(ids, []uint{11, 3, 4, 2}) || scans != 2 {
+		t.Errorf("entries = %v after %d scans, want [11 3 4 2] after 2", ids, scans)
+	}
+
+	all := slices.Concat(target, pages[0], pages[1])
+	if got, want := groupDuplicates(entries, cfg, 2), groupDuplicates(all, cfg, 2); len(got) != 1 || len(got[0].Members) != len(want[0].Members) {
+		t.Errorf("groups = %+v, want %+v", got, want)
+	}
+}
+
+func TestMergeUpdates(t *testing.T) {
+	schema := buildSchema(model.BatchColumns{
+		{Name: "姓名", Index: 0, Field: FieldName},
+		{Name: "手机", Index: 1, Field: FieldPhone},
+		{Name: "邮箱", Index: 2},
+		{Name: "部门", Index: 3},
+	}, NewRuleEngine())
+	survivor := &model.Record{Name: "张三", Fields: model.JSONMap{"姓名": "张三", "手机": "", "邮箱": "", "部门": "研发"}}
+	others := []model.Record{
+		{Phone: "13800138000", Fields: model.JSONMap{"mobile": "13800138000", "邮箱": " "}}, // 其他批次，按逻辑字段取值
+		{Fields: model.JSONMap{"邮箱": "zs@example.com", "部门": "市场"}},
+		{Fields: model.JSONMap{"邮箱": "other@example.com"}},
+	}
+	want := map[string]interface{}{"手机": "13800138000", "邮箱": "zs@example.com"}
+	if got := mergeUpdates(schema, survivor, others); !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeUpdates() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,334 @@
+package service
+
+import (
+	"bufio"
+	_ "embed"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"etl-tool/internal/config"
+)
+
+// 行政区划表（GB/T 2260）：地址按 省 → 地级（市 / 自治州 / 地区 / 盟）→ 县级 逐级以最长前缀匹配，
+// 省与地级同时接受简称（广西 → 广西壮族自治区、延边 → 延边朝鲜族自治州），输出规范全称与最具体一级的代码。
+//   - 直辖市的地级与省级相同（北京市 / 北京市），省直辖的县级市（如仙桃市）作为地级
+//   - 地址省略省份时按地级全称反查省份，再省略地级时按县级全称反查（同名不唯一时不反查）
+//   - 下一级名称属于其他上级时（如 广东省成都市、北京市武侯区）返回 address_mismatch 错误；
+//     县级只在表中收录了该地级的县级时校验
+//   - 表中未收录的县级名称按 区 / 县 / 旗 / 市 后缀提取，不返回代码
+//
+// 内置表见 data/gb2260.txt（2023 年县级以上区划代码），可通过 address.divisions_file 配置替换为更新的版本。
+
+// ErrCodeAddressMismatch 地址中的下级行政区划不属于上级
+const ErrCodeAddressMismatch = "address_mismatch"
+
+//go:embed data/gb2260.txt
+var embeddedDivisions string
+
+// Division 行政区划节点，Level 1 为省级，2 为地级，3 为县级
+type Division struct {
+	Code     string
+	Name     string
+	Short    string // 简称，县级为空
+	Level    int
+	Parent   *Division
+	Children []*Division
+}
+
+// AddressParts 地址解析结果，Code 为匹配到的最具体一级的区划代码
+type AddressParts struct {
+	Province string
+	City     string
+	District string
+	Code     string
+}
+
+// divisionTable 按层级组织的区划表，全称索引用于省略上级时的反查与一致性校验
+type divisionTable struct {
+	provinces []*Division
+	cities    map[string][]*Division // 地级全称 -> 节点
+	districts map[string][]*Division // 县级全称 -> 节点
+	maxRunes  int                    // 最长名称的字符数，限制前缀查找的长度
+}
+
+var (
+	divisionsOnce sync.Once
+	divisions     *divisionTable
+
+	// regexDistrictSuffix 表中未收录的县级名称
+	regexDistrictSuffix = regexp.MustCompile(`^(.{1,10}?(?:新区|区|县|旗|市))`)
+
+	// 民族名称，用于从自治州 / 自治县 / 自治区的全称中截取简称
+	ethnicNames = []string{
+		"蒙古", "回", "藏", "维吾尔", "苗", "彝", "壮", "布依", "朝鲜", "满", "侗", "瑶", "白", "土家", "哈尼", "哈萨克",
+		"傣", "黎", "傈僳", "佤", "畲", "拉祜", "水", "东乡", "纳西", "景颇", "柯尔克孜", "土", "达斡尔", "仫佬", "羌",
+		"布朗", "撒拉", "毛南", "仡佬", "锡伯", "阿昌", "普米", "塔吉克", "怒", "鄂温克", "德昂", "保安", "裕固", "京",
+		"独龙", "鄂伦春", "赫哲", "门巴", "珞巴", "基诺",
+	}
+	divisionSuffixes = []string{"特别行政区", "自治区", "自治州", "自治县", "自治旗", "地区", "省", "市", "盟", "州"}
+)
+
+// loadDivisions 返回区划表：优先读取配置的文件，失败时使用内置表
+func loadDivisions() *divisionTable {
+	divisionsOnce.Do(func() {
+		if config.AppConfig != nil && config.AppConfig.Address.DivisionsFile != "" {
+			path := config.AppConfig.Address.DivisionsFile
+			f, err := os.Open(path)
+			if err == nil {
+				divisions = parseDivisions(f)
+				f.Close()
+				log.Printf("[Address] Loaded %d provinces from %s", len(divisions.provinces), path)
+				return
+			}
+			log.Printf("[Address] Failed to load %s, using embedded table: %v", path, err)
+		}
+		divisions = parseDivisions(strings.NewReader(embeddedDivisions))
+	})
+	return divisions
+}
+
+// parseDivisions 解析 "代码<TAB或空格>名称" 格式的区划表，# 开头的行为注释。
+// 地级的 市辖区 / 县 为直辖市的占位，x9xx00 为省直辖县级行政区划的占位
+func parseDivisions(r io.Reader) *divisionTable {
+	t := &divisionTable{cities: make(map[string][]*Division), districts: make(map[string][]*Division)}
+	provinces := make(map[string]*Division)
+	cities := make(map[string]*Division) // 地级代码前 4 位 -> 节点（直辖市的占位指向直辖市自身的地级节点）
+	direct := make(map[string]bool)      // 省直辖县级行政区划的占位
+	municipal := make(map[string]*Division)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields[0]) != 6 {
+			continue
+		}
+		code, name := fields[0], fields[1]
+		prov := provinces[code[:2]]
+		switch {
+		case code[2:] == "0000":
+			d := &Division{Code: code, Name: name, Short: divisionShort(name), Level: 1}
+			provinces[code[:2]] = d
+			t.provinces = append(t.provinces, d)
+		case prov == nil:
+			continue
+		case code[4:] == "00":
+			if code[2:4] == "90" {
+				direct[code[:4]] = true
+				continue
+			}
+			if name == "市辖区" || name == "县" {
+				// 直辖市：市辖区与县合并为与省级同名的地级
+				if municipal[code[:2]] == nil {
+					municipal[code[:2]] = t.addCity(prov, code, prov.Name, prov.Short)
+				}
+				cities[code[:4]] = municipal[code[:2]]
+				continue
+			}
+			cities[code[:4]] = t.addCity(prov, code, name, divisionShort(name))
+		case direct[code[:4]]:
+			t.addCity(prov, code, name, divisionShort(name))
+		default:
+			city := cities[code[:4]]
+			if city == nil {
+				continue
+			}
+			d := &Division{Code: code, Name: name, Level: 3, Parent: city}
+			city.Children = append(city.Children, d)
+			t.districts[name] = append(t.districts[name], d)
+			t.maxRunes = max(t.maxRunes, utf8.RuneCountInString(name))
+		}
+	}
+	return t
+}
+
+func (t *divisionTable) addCity(prov *Division, code, name, short string) *Division {
+	d := &Division{Code: code, Name: name, Short: short, Level: 2, Parent: prov}
+	prov.Children = append(prov.Children, d)
+	t.cities[name] = append(t.cities[name], d)
+	t.maxRunes = max(t.maxRunes, utf8.RuneCountInString(name))
+	return d
+}
+
+// divisionShort 简称：去掉通名后缀与民族名称（内蒙古自治区 → 内蒙古、恩施土家族苗族自治州 → 恩施），
+// 结果少于两个字时不使用简称
+func divisionShort(name string) string {
+	short := name
+	for _, suffix := range divisionSuffixes {
+		if strings.HasSuffix(short, suffix) {
+			short = strings.TrimSuffix(short, suffix)
+			break
+		}
+	}
+	if strings.HasSuffix(name, "自治区") || strings.HasSuffix(name, "自治州") ||
+		strings.HasSuffix(name, "自治县") || strings.HasSuffix(name, "自治旗") {
+		cut := len(short)
+		for _, ethnic := range ethnicNames {
+			if i := strings.Index(short, ethnic); i >= 0 && i < cut && utf8.RuneCountInString(short[:i]) >= 2 {
+				cut = i
+			}
+		}
+		short = short[:cut]
+	}
+	if utf8.RuneCountInString(short) < 2 || short == name {
+		return ""
+	}
+	return short
+}
+
+// matchChild 在候选节点中查找 s 的最长前缀（全称或简称）；简称之后紧跟的通名（如 "广西省" 中的 省）一并跳过
+func matchChild(s string, candidates []*Division) (*Division, string) {
+	var best *Division
+	bestLen := 0
+	for _, d := range candidates {
+		for _, name := range []string{d.Name, d.Short} {
+			if name != "" && len(name) > bestLen && strings.HasPrefix(s, name) {
+				best, bestLen = d, len(name)
+			}
+		}
+	}
+	if best == nil {
+		return nil, s
+	}
+	rest := s[bestLen:]
+	if bestLen == len(best.Short) && best.Short != best.Name {
+		for _, suffix := range divisionSuffixes {
+			if strings.HasPrefix(rest, suffix) {
+				rest = rest[len(suffix):]
+				break
+			}
+		}
+	}
+	return best, rest
+}
+
+// matchIndex 在全称索引中查找 s 的最长前缀，返回同名的全部节点
+func (t *divisionTable) matchIndex(s string, index map[string][]*Division) ([]*Division, string) {
+	end, n := 0, 0
+	var found []*Division
+	rest := s
+	for _, r := range s {
+		end += utf8.RuneLen(r)
+		if n++; n > t.maxRunes {
+			break
+		}
+		if ds, ok := index[s[:end]]; ok {
+			found, rest = ds, s[end:]
+		}
+	}
+	return found, rest
+}
+
+// withParent 返回上级为 parent 的节点；parent 为 nil 时要求唯一
+func withParent(ds []*Division, parent *Division) *Division {
+	if parent == nil {
+		if len(ds) == 1 {
+			return ds[0]
+		}
+		return nil
+	}
+	for _, d := range ds {
+		if d.Parent == parent {
+			return d
+		}
+	}
+	return nil
+}
+
+// ParseAddress 按行政区划表解析地址中的省、地级与县级；下级不属于上级时返回已解析的部分与 address_mismatch 错误
+func ParseAddress(addr string) (AddressParts, error) {
+	t := loadDivisions()
+	s := strings.TrimSpace(addr)
+	for _, prefix := range []string{"中华人民共和国", "中国"} {
+		s = strings.TrimPrefix(s, prefix)
+	}
+	if s == "" {
+		return AddressParts{}, nil
+	}
+
+	var prov, city, district *Division
+	var mismatch error
+	orig := s
+	prov, s = matchChild(s, t.provinces)
+
+	// 仅匹配到省份简称时，以该简称开头且更长的地级全称优先（海南藏族自治州 不是 海南省）
+	if prov != nil && !strings.HasPrefix(orig, prov.Name) {
+		if cs, rest := t.matchIndex(orig, t.cities); len(rest) < len(s) {
+			if c := withParent(cs, nil); c != nil {
+				prov, city, s = c.Parent, c, rest
+			}
+		}
+	}
+
+	// 地级：省份内按全称或简称匹配；省略省份时按全称反查
+	if city != nil {
+		// 已按地级全称确定
+	} else if prov != nil {
+		if c, rest := matchChild(s, prov.Children); c != nil {
+			city, s = c, rest
+			if city.Name == prov.Name {
+				s = strings.TrimPrefix(s, city.Name) // 北京市北京市朝阳区
+			}
+		} else if c, rest := matchChild(orig, prov.Children); c != nil {
+			city, s = c, rest // 地级与省份简称相同且省略了省份，如 吉林市船营区
+		} else if cs, _ := t.matchIndex(s, t.cities); len(cs) > 0 {
+			mismatch = ruleError(ErrCodeAddressMismatch, "%s does not belong to %s", cs[0].Name, prov.Name)
+		} else if len(prov.Children) == 1 && prov.Children[0].Name == prov.Name {
+			city = prov.Children[0] // 直辖市省略了重复的市名
+		}
+	} else if cs, rest := t.matchIndex(s, t.cities); withParent(cs, nil) != nil {
+		city, s = cs[0], rest
+		prov = city.Parent
+	}
+
+	// 县级：地级内按全称匹配；省略地级时在省内或全表按全称反查
+	if mismatch == nil {
+		ds, rest := t.matchIndex(s, t.districts)
+		switch {
+		case city != nil:
+			if d := withParent(ds, city); d != nil {
+				district, s = d, rest
+			} else if len(ds) > 0 && len(city.Children) > 0 {
+				// 只有表中收录了该地级的县级时才能判定不属于（不设区的地级市或自定义表中可能没有县级）
+				mismatch = ruleError(ErrCodeAddressMismatch, "%s does not belong to %s", ds[0].Name, city.Name)
+			}
+		case prov != nil:
+			for _, d := range ds {
+				if d.Parent.Parent == prov {
+					district, city, s = d, d.Parent, rest
+					break
+				}
+			}
+		default:
+			if d := withParent(ds, nil); d != nil {
+				district, s = d, rest
+				city, prov = d.Parent, d.Parent.Parent
+			}
+		}
+	}
+
+	var parts AddressParts
+	if prov != nil {
+		parts.Province, parts.Code = prov.Name, prov.Code
+	}
+	if city != nil {
+		parts.City, parts.Code = city.Name, city.Code
+	}
+	if district != nil {
+		parts.District, parts.Code = district.Name, district.Code
+	} else if city != nil && mismatch == nil {
+		// 表中未收录的县级只提取名称
+		if m := regexDistrictSuffix.FindStringSubmatch(s); m != nil {
+			parts.District = m[1]
+		}
+	}
+	return parts, mismatch
+}
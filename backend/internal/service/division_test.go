@@ -0,0 +1,122 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"etl-tool/internal/model"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		input    string
+		want     AddressParts
+		mismatch bool
+	}{
+		{"四川省成都市武侯区人民南路四段", AddressParts{"四川省", "成都市", "武侯区", "510107"}, false},
+		{"北京市朝阳区建国路", AddressParts{"北京市", "北京市", "朝阳区", "110105"}, false},
+		{"北京朝阳区", AddressParts{"北京市", "北京市", "朝阳区", "110105"}, false},
+		{"上海市浦东新区世纪大道", AddressParts{"上海市", "上海市", "浦东新区", "310115"}, false},
+		{"重庆市石柱土家族自治县", AddressParts{"重庆市", "重庆市", "石柱土家族自治县", "500240"}, false},
+		{"广西南宁市青秀区", AddressParts{"广西壮族自治区", "南宁市", "青秀区", "450103"}, false},
+		{"广西省南宁市", AddressParts{"广西壮族自治区", "南宁市", "", "450100"}, false},
+		{"内蒙古锡林郭勒盟锡林浩特市", AddressParts{"内蒙古自治区", "锡林郭勒盟", "锡林浩特市", "152502"}, false},
+		{"吉林省延边州延吉市", AddressParts{"吉林省", "延边朝鲜族自治州", "延吉市", "222401"}, false},
+		{"吉林市船营区", AddressParts{"吉林省", "吉林市", "船营区", "220204"}, false},
+		{"海南藏族自治州共和县", AddressParts{"青海省", "海南藏族自治州", "共和县", "632521"}, false},
+		{"新疆阿克苏地区库车市", AddressParts{"新疆维吾尔自治区", "阿克苏地区", "库车市", "652902"}, false},
+		{"湖北省仙桃市", AddressParts{"湖北省", "仙桃市", "", "429004"}, false},
+		{"中国深圳市南山区", AddressParts{"广东省", "深圳市", "南山区", "440305"}, false},
+		{"武侯区科华北路", AddressParts{"四川省", "成都市", "武侯区", "510107"}, false},
+		{"广东省成都市武侯区", AddressParts{"广东省", "", "", "440000"}, true},
+		{"北京市武侯区", AddressParts{"北京市", "北京市", "", "110100"}, true},
+		{"四川省成都市朝阳区", AddressParts{"四川省", "成都市", "", "510100"}, true},
+		{"吉林省长春市朝阳区", AddressParts{"吉林省", "长春市", "朝阳区", "220104"}, false},
+		{"河北省石家庄市长安区中山东路", AddressParts{"河北省", "石家庄市", "长安区", "130102"}, false},
+		{"山东青岛崂山区", AddressParts{"山东省", "青岛市", "崂山区", "370212"}, false},
+		{"历下区泉城路", AddressParts{"山东省", "济南市", "历下区", "370102"}, false},
+		{"山东省青岛市长安区", AddressParts{"山东省", "青岛市", "", "370200"}, true},
+		{"广东省东莞市长安镇", AddressParts{"广东省", "东莞市", "", "441900"}, false}, // 不设区的地级市没有县级
+		{"火星基地", AddressParts{}, false},
+		{"", AddressParts{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseAddress(tt.input)
+			if got != tt.want {
+				t.Errorf("ParseAddress() = %+v, want %+v", got, tt.want)
+			}
+			var re *RuleError
+			if tt.mismatch != (err != nil) || (err != nil && (!errors.As(err, &re) || re.Code != ErrCodeAddressMismatch)) {
+				t.Errorf("ParseAddress() error = %v, want mismatch %t", err, tt.mismatch)
+			}
+		})
+	}
+}
+
+func TestDivisionShort(t *testing.T) {
+	tests := map[string]string{
+		"广西壮族自治区":     "广西",
+		"内蒙古自治区":      "内蒙古",
+		"西藏自治区":       "西藏",
+		"新疆维吾尔自治区":    "新疆",
+		"香港特别行政区":     "香港",
+		"恩施土家族苗族自治州":  "恩施",
+		"克孜勒苏柯尔克孜自治州": "克孜勒苏",
+		"怒江傈僳族自治州":    "怒江",
+		"锡林郭勒盟":       "锡林郭勒",
+		"阿里地区":        "阿里",
+		"成都市":         "成都",
+		"忠县":          "",
+	}
+	for name, want := range tests {
+		if got := divisionShort(name); got != want {
+			t.Errorf("divisionShort(%s) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestParseDivisions(t *testing.T) {
+	table := parseDivisions(strings.NewReader(`# comment
+500000	重庆市
+500100	市辖区
+500101	万州区
+500200	县
+500229	城口县
+420000 湖北省
+429000 省直辖县级行政区划
+429004 仙桃市
+999999 无上级
+`))
+	if len(table.provinces) != 2 {
+		t.Fatalf("provinces = %d, want 2", len(table.provinces))
+	}
+	cq := table.provinces[0]
+	if len(cq.Children) != 1 || cq.Children[0].Name != "重庆市" || len(cq.Children[0].Children) != 2 {
+		t.Errorf("municipality city = %+v", cq.Children)
+	}
+	hb := table.provinces[1]
+	if len(hb.Children) != 1 || hb.Children[0].Name != "仙桃市" || hb.Children[0].Level != 2 {
+		t.Errorf("direct county = %+v", hb.Children)
+	}
+}
+
+func TestAddressMismatchRecordError(t *testing.T) {
+	engine := NewRuleEngine()
+	if err := engine.LoadConfig([]byte(`[
+		{"column": "address_province", "rules": [{"type": "address", "comp": "province"}]},
+		{"column": "address_city", "rules": [{"type": "address", "comp": "city"}]},
+		{"column": "address_district", "rules": [{"type": "address", "comp": "district"}]}
+	]`)); err != nil {
+		t.Fatal(err)
+	}
+	schema := buildSchema(model.BatchColumns{{Name: "地址", Index: 0, Field: FieldAddress}}, engine)
+	rec, errs := schema.cleanColumns(func(model.BatchColumn) string { return "广东省成都市武侯区" }, nil, engine)
+	if len(errs) != 1 || errs[0].Column != "地址" || errs[0].Code != ErrCodeAddressMismatch || errs[0].Rule != "address" {
+		t.Errorf("errors = %+v, want one address_mismatch on 地址", errs)
+	}
+	if rec.Province != "广东省" || rec.City != "" {
+		t.Errorf("location = %s/%s, want 广东省/", rec.Province, rec.City)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strings"
 
 	"etl-tool/internal/model"
 
@@ -20,16 +21,136 @@ func (s *CleanerService) GetBatchFilename(batchID string) (string, error) {
 	return batch.OriginalFilename, nil
 }
 
+// legacyExportHeaders 没有列目录的旧批次使用的固定表头
+var legacyExportHeaders = []string{"行号", "姓名", "手机号", "日期", "省份", "城市", "区县", "地址", "状态"}
+
+// errorExportHeaders 结构化错误的每个维度各占一列，多条错误按相同顺序以 "; " 连接
+var errorExportHeaders = []string{"错误列", "错误规则", "错误代码", "错误信息", "错误值"}
+
+// errorExportValues 展开记录的结构化错误；没有结构化错误的旧记录只输出 ErrorMessage
+func errorExportValues(r *model.Record) []string {
+	if len(r.Errors) == 0 {
+		return []string{"", "", "", r.ErrorMessage, ""}
+	}
+	dims := make([][]string, len(errorExportHeaders))
+	for _, e := range r.Errors {
+		for i, v := range []string{e.Column, e.Rule, e.Code, e.Message, e.Value} {
+			dims[i] = append(dims[i], v)
+		}
+	}
+	values := make([]string, len(dims))
+	for i, d := range dims {
+		values[i] = strings.Join(d, "; ")
+	}
+	return values
+}
+
+// exportLayout 描述导出文件的表头以及从 Record 生成一行的方式
+type exportLayout struct {
+	headers []string
+	row     func(r *model.Record) []string
+}
+
+// rawExportPrefix 原始列的表头前缀，便于与同名的清洗后列区分
+const rawExportPrefix = "原始_"
+
+// buildExportLayout 根据批次列目录生成导出布局：行号 + 源文件全部列（清洗后）+ 解析出的省市区 + 状态 + 错误各维度；
+// includeRaw 时追加源文件全部列的原始值（旧批次没有保存原始行时忽略）
+func (s *CleanerService) buildExportLayout(batchID string, includeRaw bool) (*exportLayout, error) {
+	var batch model.ImportBatch
+	if err := s.DB.Select("id", "columns", "source_header").First(&batch, "id = ?", batchID).Error; err != nil {
+		return nil, err
+	}
+	layout := newExportLayout(batch.Columns)
+	if includeRaw && len(batch.SourceHeader) > 0 {
+		layout = layout.withRawColumns(batch.SourceHeader)
+	}
+	return layout, nil
+}
+
+// withRawColumns 在布局末尾追加原始列，缺失的单元格留空
+func (l *exportLayout) withRawColumns(header []string) *exportLayout {
+	headers := make([]string, 0, len(l.headers)+len(header))
+	headers = append(headers, l.headers...)
+	for _, h := range header {
+		headers = append(headers, rawExportPrefix+h)
+	}
+	base := l.row
+	return &exportLayout{
+		headers: headers,
+		row: func(r *model.Record) []string {
+			values := base(r)
+			raw, _ := decodeRawRow(r.RawData)
+			for i := range header {
+				v := ""
+				if i < len(raw) {
+					v = raw[i]
+				}
+				values = append(values, v)
+			}
+			return values
+		},
+	}
+}
+
+func newExportLayout(columns model.BatchColumns) *exportLayout {
+	if len(columns) == 0 {
+		return &exportLayout{
+			headers: append(append([]string{}, legacyExportHeaders...), errorExportHeaders...),
+			row: func(r *model.Record) []string {
+				values := []string{
+					fmt.Sprintf("%d", r.RowIndex),
+					r.Name,
+					r.Phone,
+					r.Date,
+					r.Province,
+					r.City,
+					r.District,
+					r.Address,
+					string(r.Status),
+				}
+				return append(values, errorExportValues(r)...)
+			},
+		}
+	}
+
+	schema := &batchSchema{Columns: columns}
+	headers := make([]string, 0, len(columns)+5+len(errorExportHeaders))
+	headers = append(headers, "行号")
+	for _, col := range columns {
+		headers = append(headers, col.Name)
+	}
+	headers = append(headers, "省份", "城市", "区县", "状态")
+	headers = append(headers, errorExportHeaders...)
+
+	return &exportLayout{
+		headers: headers,
+		row: func(r *model.Record) []string {
+			values := make([]string, 0, len(headers))
+			values = append(values, fmt.Sprintf("%d", r.RowIndex))
+			for _, col := range columns {
+				values = append(values, schema.valueOf(r, col))
+			}
+			values = append(values, r.Province, r.City, r.District, string(r.Status))
+			return append(values, errorExportValues(r)...)
+		},
+	}
+}
+
 // ExportBatchStream 将批次数据以 CSV 格式流式输出到 writer
-func (s *CleanerService) ExportBatchStream(batchID string, filter string, w io.Writer) error {
+func (s *CleanerService) ExportBatchStream(batchID string, filter string, includeRaw bool, w io.Writer) error {
 	// 写入 BOM 标记 (Excel UTF-8 兼容性)
 	w.Write([]byte("\xEF\xBB\xBF"))
 
 	cw := csv.NewWriter(w)
 
+	layout, err := s.buildExportLayout(batchID, includeRaw)
+	if err != nil {
+		return err
+	}
+
 	// 写入表头
-	headers := []string{"行号", "姓名", "手机号", "日期", "省份", "城市", "区县", "地址", "状态", "错误信息"}
-	if err := cw.Write(headers); err != nil {
+	if err := cw.Write(layout.headers); err != nil {
 		return err
 	}
 	cw.Flush()
@@ -54,20 +175,7 @@ func (s *CleanerService) ExportBatchStream(batchID string, filter string, w io.W
 		var r model.Record
 		s.DB.ScanRows(rows, &r)
 
-		record := []string{
-			fmt.Sprintf("%d", r.RowIndex),
-			r.Name,
-			r.Phone,
-			r.Date,
-			r.Province,
-			r.City,
-			r.District,
-			r.Address,
-			string(r.Status),
-			r.ErrorMessage,
-		}
-
-		if err := cw.Write(record); err != nil {
+		if err := cw.Write(layout.row(&r)); err != nil {
 			return err
 		}
 	}
@@ -77,7 +185,7 @@ func (s *CleanerService) ExportBatchStream(batchID string, filter string, w io.W
 }
 
 // ExportBatchWithExcelStream 将批次数据以 Excel (xlsx) 格式流式输出
-func (s *CleanerService) ExportBatchWithExcelStream(batchID string, filter string, w io.Writer) error {
+func (s *CleanerService) ExportBatchWithExcelStream(batchID string, filter string, includeRaw bool, w io.Writer) error {
 	f := excelize.NewFile()
 	defer func() {
 		if err := f.Close(); err != nil {
@@ -91,8 +199,16 @@ func (s *CleanerService) ExportBatchWithExcelStream(batchID string, filter strin
 		return err
 	}
 
+	layout, err := s.buildExportLayout(batchID, includeRaw)
+	if err != nil {
+		return err
+	}
+
 	// 写入表头
-	headers := []interface{}{"行号", "姓名", "手机号", "日期", "省份", "城市", "区县", "地址", "状态", "错误信息"}
+	headers := make([]interface{}, len(layout.headers))
+	for i, h := range layout.headers {
+		headers[i] = h
+	}
 	if err := sw.SetRow("A1", headers); err != nil {
 		return err
 	}
@@ -117,18 +233,12 @@ func (s *CleanerService) ExportBatchWithExcelStream(batchID string, filter strin
 		var r model.Record
 		s.DB.ScanRows(rows, &r)
 
-		// 构建 Excel 行数据
-		values := []interface{}{
-			r.RowIndex,
-			r.Name,
-			r.Phone,
-			r.Date,
-			r.Province,
-			r.City,
-			r.District,
-			r.Address,
-			string(r.Status),
-			r.ErrorMessage,
+		// 构建 Excel 行数据（行号保持数值类型）
+		row := layout.row(&r)
+		values := make([]interface{}, len(row))
+		values[0] = r.RowIndex
+		for i := 1; i < len(row); i++ {
+			values[i] = row[i]
 		}
 
 		cell, _ := excelize.CoordinatesToCellName(1, currentRow)
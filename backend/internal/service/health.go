@@ -0,0 +1,43 @@
+package service
+
+import (
+	"log"
+
+	"etl-tool/internal/repository"
+)
+
+// HealthInfo 健康检查信息
+type HealthInfo struct {
+	Status     string                    `json:"status"`   // ok / degraded
+	Database   string                    `json:"database"` // ok / unavailable，具体错误只写入日志
+	Saver      string                    `json:"saver"`
+	Durability repository.DurabilityInfo `json:"durability"`
+}
+
+// Health 检查数据库连通性并报告当前生效的写入与持久化模式。
+// 接口无需登录，驱动错误可能包含主机、端口与用户名，因此只记录日志，不返回给调用方
+func (s *CleanerService) Health() HealthInfo {
+	info := HealthInfo{Status: "ok", Database: "ok", Saver: SaverGorm}
+	if _, ok := s.batchStore().(copyBatchStore); ok {
+		info.Saver = SaverCopy
+	}
+
+	sqlDB, err := s.DB.DB()
+	if err == nil {
+		err = sqlDB.Ping()
+	}
+	if err != nil {
+		log.Printf("[Health] Database unavailable: %v", err)
+		info.Status, info.Database = "degraded", "unavailable"
+		info.Durability.Mode = repository.DurabilityMode()
+		return info
+	}
+
+	durability, err := repository.GetDurabilityInfo()
+	if err != nil {
+		log.Printf("[Health] Failed to read durability info: %v", err)
+		info.Status = "degraded"
+	}
+	info.Durability = durability
+	return info
+}
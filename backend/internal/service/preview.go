@@ -0,0 +1,192 @@
+package service
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+
+	"etl-tool/internal/model"
+	"etl-tool/internal/utils"
+)
+
+// 规则预览：在正式导入前用提交的规则与列映射清洗文件的前 N 行（或随机抽样），不写入任何记录
+
+const (
+	previewDefaultLimit = 100
+	previewMaxLimit     = 1000
+	previewMaxScan      = 1000000 // 随机抽样最多扫描的行数，超大文件只从前 100 万行中抽样
+)
+
+// PreviewRequest 预览参数，rules / mapping 与上传接口的格式相同
+type PreviewRequest struct {
+	Rules   string
+	Mapping string
+	Limit   int  // 预览行数，默认 100，最多 1000
+	Sample  bool // 为 true 时随机抽样，否则取前 Limit 行
+}
+
+// PreviewRow 单行的清洗结果
+type PreviewRow struct {
+	RowIndex int               `json:"row_index"`
+	Raw      []string          `json:"raw"`
+	Fields   model.JSONMap     `json:"fields"`
+	Province string            `json:"province"`
+	City     string            `json:"city"`
+	District string            `json:"district"`
+	Status   string            `json:"status"`
+	Errors   model.FieldErrors `json:"errors"`
+}
+
+// PreviewColumn 单列的通过率
+type PreviewColumn struct {
+	Column   string  `json:"column"`
+	Field    string  `json:"field,omitempty"`
+	Type     string  `json:"type"`
+	Failed   int     `json:"failed"`
+	PassRate float64 `json:"pass_rate"`
+}
+
+// PreviewResult 预览结果：逐行清洗结果与汇总通过率
+type PreviewResult struct {
+	Header   []string           `json:"header"`
+	Columns  []PreviewColumn    `json:"columns"`
+	Rows     []PreviewRow       `json:"rows"`
+	Total    int                `json:"total"`   // 预览的行数
+	Scanned  int                `json:"scanned"` // 为抽样读取的行数
+	Clean    int                `json:"clean"`
+	Error    int                `json:"error"`
+	PassRate float64            `json:"pass_rate"`
+	Errors   []model.ErrorCount `json:"errors"` // 按列、规则、错误代码汇总
+}
+
+// PreviewFile 按上传时的方式解析表头与列映射，对选出的行执行规则
+func (s *CleanerService) PreviewFile(path string, req PreviewRequest) (*PreviewResult, error) {
+	if req.Limit <= 0 {
+		req.Limit = previewDefaultLimit
+	}
+	if req.Limit > previewMaxLimit {
+		req.Limit = previewMaxLimit
+	}
+	engine, err := loadRuleEngine(req.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules: %w", err)
+	}
+
+	iter, err := utils.NewRowIterator(path)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	header, err := s.readHeader(iter)
+	if err != nil {
+		return nil, err
+	}
+	indices, ignored, err := resolveColumns(header, req.Mapping)
+	if err != nil {
+		return nil, err
+	}
+	schema := newBatchSchema(header, indices, ignored, engine)
+
+	rows, scanned, err := selectPreviewRows(iter, req.Limit, req.Sample)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PreviewResult{
+		Header:  header,
+		Columns: make([]PreviewColumn, len(schema.Columns)),
+		Rows:    make([]PreviewRow, 0, len(rows)),
+		Total:   len(rows),
+		Scanned: scanned,
+	}
+	failed := make(map[string]int, len(schema.Columns))
+	errCounts := make(map[errorKey]int)
+	for _, r := range rows {
+		rec := s.createRecordFromRow(r.row, 0, r.idx, schema, engine)
+		result.Rows = append(result.Rows, PreviewRow{
+			RowIndex: r.idx,
+			Raw:      r.row,
+			Fields:   rec.Fields,
+			Province: rec.Province,
+			City:     rec.City,
+			District: rec.District,
+			Status:   rec.Status,
+			Errors:   rec.Errors,
+		})
+		if rec.Status == "Clean" {
+			result.Clean++
+		} else {
+			result.Error++
+		}
+
+		columns := make(map[string]bool, len(rec.Errors))
+		for _, e := range rec.Errors {
+			errCounts[errorKey{e.Column, e.Rule, e.Code}]++
+			if e.Rule != "row" && !columns[e.Column] {
+				columns[e.Column] = true
+				failed[e.Column]++
+			}
+		}
+	}
+
+	result.PassRate = passRate(result.Clean, result.Total)
+	for i, col := range schema.Columns {
+		result.Columns[i] = PreviewColumn{
+			Column:   col.Name,
+			Field:    col.Field,
+			Type:     col.Type,
+			Failed:   failed[col.Name],
+			PassRate: passRate(result.Total-failed[col.Name], result.Total),
+		}
+	}
+	result.Errors = make([]model.ErrorCount, 0, len(errCounts))
+	for k, n := range errCounts {
+		result.Errors = append(result.Errors, model.ErrorCount{Column: k.column, Rule: k.rule, Code: k.code, Count: n})
+	}
+	sort.Slice(result.Errors, func(i, j int) bool {
+		if result.Errors[i].Count != result.Errors[j].Count {
+			return result.Errors[i].Count > result.Errors[j].Count
+		}
+		return result.Errors[i].Column+result.Errors[i].Code < result.Errors[j].Column+result.Errors[j].Code
+	})
+	return result, nil
+}
+
+type previewRow struct {
+	idx int
+	row []string
+}
+
+// selectPreviewRows 取前 limit 行，或对前 previewMaxScan 行做蓄水池抽样（结果按行号排序）
+func selectPreviewRows(iter utils.RowIterator, limit int, sample bool) ([]previewRow, int, error) {
+	rows := make([]previewRow, 0, limit)
+	scanned := 0
+	for scanned < previewMaxScan && iter.Next() {
+		scanned++
+		row := append([]string(nil), iter.Row()...)
+
+		if len(rows) < limit {
+			rows = append(rows, previewRow{idx: scanned, row: row})
+			if !sample && len(rows) == limit {
+				break
+			}
+			continue
+		}
+		if j := rand.IntN(scanned); j < limit {
+			rows[j] = previewRow{idx: scanned, row: row}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, scanned, err
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].idx < rows[j].idx })
+	return rows, scanned, nil
+}
+
+func passRate(passed, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(passed) / float64(total)
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const previewRules = `[{"column": "phone", "rules": [{"type": "regex", "pattern": "^1[3-9]\\d{9}$"}]}]`
+
+func writePreviewCSV(t *testing.T, rows int) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("name,phone,部门\n")
+	for i := 1; i <= rows; i++ {
+		phone := "13800138000"
+		if i%4 == 0 {
+			phone = "123"
+		}
+		fmt.Fprintf(&b, "用户%d,%s,研发\n", i, phone)
+	}
+	path := filepath.Join(t.TempDir(), "preview.csv")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPreviewFile(t *testing.T) {
+	path := writePreviewCSV(t, 200)
+	s := &CleanerService{}
+
+	tests := []struct {
+		name        string
+		req         PreviewRequest
+		wantTotal   int
+		wantScanned int
+	}{
+		{"first rows", PreviewRequest{Rules: previewRules, Limit: 8}, 8, 8},
+		{"default limit", PreviewRequest{Rules: previewRules}, 100, 100},
+		{"random sample", PreviewRequest{Rules: previewRules, Limit: 20, Sample: true}, 20, 200},
+		{"limit beyond file", PreviewRequest{Rules: previewRules, Limit: 500}, 200, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.PreviewFile(path, tt.req)
+			if err != nil {
+				t.Fatalf("PreviewFile() error = %v", err)
+			}
+			if got.Total != tt.wantTotal || len(got.Rows) != tt.wantTotal || got.Scanned != tt.wantScanned {
+				t.Fatalf("Total = %d, Rows = %d, Scanned = %d", got.Total, len(got.Rows), got.Scanned)
+			}
+			for i := 1; i < len(got.Rows); i++ {
+				if got.Rows[i].RowIndex <= got.Rows[i-1].RowIndex {
+					t.Fatalf("rows not ordered by RowIndex: %d after %d", got.Rows[i].RowIndex, got.Rows[i-1].RowIndex)
+				}
+			}
+			failed := 0
+			for _, r := range got.Rows {
+				if wantErr := r.RowIndex%4 == 0; wantErr != (r.Status == "Error") {
+					t.Errorf("row %d Status = %s, Errors = %+v", r.RowIndex, r.Status, r.Errors)
+				}
+				if r.Status == "Error" {
+					failed++
+				}
+			}
+			if got.Clean+got.Error != got.Total || got.Error != failed {
+				t.Errorf("Clean = %d, Error = %d, want %d errors", got.Clean, got.Error, failed)
+			}
+			if phone := got.Columns[1]; phone.Column != "phone" || phone.Failed != failed {
+				t.Errorf("phone column = %+v, want %d failures", phone, failed)
+			}
+			if got.Columns[0].PassRate != 1 {
+				t.Errorf("name pass rate = %v, want 1", got.Columns[0].PassRate)
+			}
+		})
+	}
+}
+
+func TestPreviewFile_InvalidInput(t *testing.T) {
+	path := writePreviewCSV(t, 5)
+	s := &CleanerService{}
+	if _, err := s.PreviewFile(path, PreviewRequest{Rules: `[{"column": "phone", "rules": [{"type": "regex", "pattern": "("}]}]`}); err == nil {
+		t.Error("expected error for invalid rules")
+	}
+	if _, err := s.PreviewFile(path, PreviewRequest{Mapping: `{"不存在": "phone"}`}); err == nil {
+		t.Error("expected error for mapping to unknown header")
+	}
+}
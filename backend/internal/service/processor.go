@@ -2,17 +2,15 @@ package service
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"runtime"
 	"runtime/debug"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
-	"etl-tool/internal/config"
 	"etl-tool/internal/model"
 	"etl-tool/internal/repository"
 	"etl-tool/internal/utils"
@@ -29,10 +27,12 @@ import (
 // CleanerService 是核心服务，提供数据清洗和处理功能
 type CleanerService struct {
 	DB          *gorm.DB
-	batchSpeeds sync.Map      // 存储实时处理速度 (key: batchID, value: float64)
-	processSem  chan struct{} // 限制并发处理任务数，防止内存爆炸
-	Engine      *RuleEngine   // 规则引擎
-	Queue       *QueueService // 任务队列
+	batchSpeeds sync.Map        // 存储实时处理速度 (key: batchID, value: float64)
+	processSem  chan struct{}   // 限制并发处理任务数，防止内存爆炸
+	Engine      *RuleEngine     // 规则引擎
+	Queue       *QueueService   // 任务队列
+	Control     *ControlService // 暂停/取消信号
+	store       batchStore      // 行处理使用的存储，为空时使用 DB
 }
 
 // NewCleanerService 创建一个新的 CleanerService 实例
@@ -46,22 +46,30 @@ func NewCleanerService() *CleanerService {
 		limit = 8
 	}
 
-	engine := NewRuleEngine()
-	if config.AppConfig != nil && config.AppConfig.CleaningRules != nil {
-		jsonData, err := json.Marshal(config.AppConfig.CleaningRules)
-		if err == nil {
-			engine.LoadConfig(jsonData)
-		} else {
-			log.Printf("[RuleEngine] Error marshaling cleaning rules: %v", err)
-		}
+	engine, err := loadRuleEngine("")
+	if err != nil {
+		log.Printf("[RuleEngine] Error loading cleaning rules: %v", err)
 	}
 
-	return &CleanerService{
+	s := &CleanerService{
 		DB:         repository.DB,
 		processSem: make(chan struct{}, limit),
 		Engine:     engine,
 		Queue:      NewQueueService(),
+		Control:    NewControlService(),
 	}
+	s.Queue.OnDeadLetter = s.failDeadLetter
+	return s
+}
+
+// failDeadLetter 将超过最大重试次数的任务对应的批次标记为失败，并记录累计的错误原因
+func (s *CleanerService) failDeadLetter(task *FileTask) {
+	s.DB.Model(&model.ImportBatch{}).Where("id = ?", task.BatchID).
+		Updates(map[string]interface{}{
+			"status": model.BatchStatusFailed,
+			"error": fmt.Sprintf("task dead-lettered after %d attempts: %s",
+				task.Attempts, strings.Join(task.Errors, "; ")),
+		})
 }
 
 // ProcessFileAsync 将任务推入 Redis 队列
@@ -112,16 +120,40 @@ func (s *CleanerService) ProcessBatch(ctx context.Context, batchID uint, filePat
 		return
 	}
 
-	// 检查任务是否已经被取消
-	if batch.Status == model.BatchStatusCancelled {
-		log.Printf("[Worker] Batch %d was cancelled before start", batchID)
+	// 检查任务是否已经被取消或暂停（暂停的批次在 Resume 时会重新入队）
+	if batch.Status == model.BatchStatusCancelled || batch.Status == model.BatchStatusPaused {
+		log.Printf("[Worker] Batch %d was %s before start", batchID, strings.ToLower(string(batch.Status)))
 		return
 	}
 
-	err := s.processFileStream(ctx, batchID, filePath, batch.ProcessedRows, batch.Rules)
+	// 订阅暂停/取消信号：收到后立即取消 procCtx，流水线的每个阶段都会随之停止
+	procCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if stop, err := s.Control.Watch(procCtx, batchID, cancel); err != nil {
+		// Redis 不可用时退回到按断点间隔轮询批次状态，暂停/取消仍然生效（延迟最多一个间隔）
+		log.Printf("[Worker] Batch %d: control channel unavailable, polling batch status instead: %v", batchID, err)
+		go pollStatus(procCtx, checkpointInterval, func() (model.BatchStatus, error) {
+			var status model.BatchStatus
+			err := s.DB.Model(&model.ImportBatch{}).Select("status").Where("id = ?", batchID).Scan(&status).Error
+			return status, err
+		}, cancel)
+	} else {
+		defer stop()
+	}
+
+	err := s.processFileStream(procCtx, batchID, filePath, checkpointOf(&batch), batch.Rules, batch.Mapping)
+	if err == nil && batch.Dedup != "" {
+		// 导入完成后按上传时的配置去重
+		s.dedupAfterImport(&batch)
+	}
 	if err != nil {
-		// 如果是主动取消/暂停（Context Canceled 或者是从 DB 读到的状态变更），不要报错 failed
-		if err == context.Canceled {
+		// 如果是主动取消/暂停，不要报错 failed
+		if cause := context.Cause(procCtx); errors.Is(cause, ErrBatchPaused) || errors.Is(cause, ErrBatchCancelled) {
+			log.Printf("[Worker] Batch %d stopped: %v", batchID, cause)
+			return
+		}
+		// Worker 退出：任务会被交还队列，从断点继续
+		if ctx.Err() != nil {
 			log.Printf("[Worker] Batch %d processing interrupted by context", batchID)
 			return
 		}
@@ -143,11 +175,11 @@ func (s *CleanerService) ProcessBatch(ctx context.Context, batchID uint, filePat
 	}
 }
 
-// processFileStream 使用流式迭代器处理文件以节省内存
-func (s *CleanerService) processFileStream(ctx context.Context, batchID uint, filePath string, skipRows int, rules string) error {
+// processFileStream 使用流式迭代器处理文件以节省内存，从断点 cp 之后的行继续处理
+func (s *CleanerService) processFileStream(ctx context.Context, batchID uint, filePath string, cp batchCheckpoint, rules string, mapping string) error {
 	// 1. 估算总行数 (如果是重新开始)
 	var totalLines int
-	if skipRows == 0 {
+	if cp.Rows == 0 {
 		startCount := time.Now()
 		totalLines64, _ := utils.CountLines(filePath)
 		totalLines = int(totalLines64)
@@ -161,10 +193,12 @@ func (s *CleanerService) processFileStream(ctx context.Context, batchID uint, fi
 	updateMap := map[string]interface{}{
 		"status": model.BatchStatusProcessing,
 	}
-	if skipRows == 0 {
+	if cp.Rows == 0 {
 		updateMap["total_rows"] = totalLines
 	}
-	s.DB.Model(&model.ImportBatch{}).Where("id = ?", batchID).Updates(updateMap)
+	s.DB.Model(&model.ImportBatch{}).
+		Where("id = ? AND status NOT IN ?", batchID, []model.BatchStatus{model.BatchStatusPaused, model.BatchStatusCancelled}).
+		Updates(updateMap)
 
 	// 3. 打开文件流
 	iter, err := utils.NewRowIterator(filePath)
@@ -179,31 +213,36 @@ func (s *CleanerService) processFileStream(ctx context.Context, batchID uint, fi
 		return err
 	}
 
-	indices := utils.DetectHeaders(header)
-	if indices.Phone == -1 && indices.Name == -1 {
-		return fmt.Errorf("could not detect required columns (Name/Phone). Header was: %v", header)
+	indices, ignored, err := resolveColumns(header, mapping)
+	if err != nil {
+		return err
 	}
 
-	// 5. 初始化该批次特有的规则引擎
-	engine := NewRuleEngine()
-	if rules != "" {
-		if err := engine.LoadConfig([]byte(rules)); err != nil {
-			log.Printf("[RuleEngine] Warning: Failed to load custom rules for batch %d: %v. Falling back to defaults.", batchID, err)
-			// 如果前端提供的规则格式错误，在此处记录并继续（或返回错误）
-		}
-	} else if config.AppConfig != nil && config.AppConfig.CleaningRules != nil {
-		// 回退到全局默认规则
-		jsonData, _ := json.Marshal(config.AppConfig.CleaningRules)
-		engine.LoadConfig(jsonData)
+	// 5. 初始化该批次特有的规则引擎：规则无效时批次直接失败，绝不使用与提交内容不同的规则处理
+	engine, err := loadRuleEngine(rules)
+	if err != nil {
+		return fmt.Errorf("invalid cleaning rules: %w", err)
 	}
 
-	// 6. 极致性能：针对千万级数据，先卸载索引，写完后瞬间重建
-	repository.DropSearchIndexes()
-	stats, err := s.processRows(ctx, iter, header, batchID, indices, skipRows, engine)
+	// 6. 构建并保存列目录：源文件的每一列都会被持久化到 Record.Fields
+	schema := newBatchSchema(header, indices, ignored, engine)
+	s.DB.Model(&model.ImportBatch{}).Where("id = ?", batchID).Updates(map[string]interface{}{
+		"columns":       schema.Columns,
+		"source_header": model.StringList(header),
+	})
+
+	// 7. 极致性能：针对千万级数据，先卸载本批次分区的搜索索引，写完后瞬间重建（其他批次不受影响）
+	if err := repository.EnsureBatchPartition(batchID); err != nil {
+		return err
+	}
+	repository.DropBatchIndexes(batchID)
+	stats, err := s.processRows(ctx, iter, batchID, schema, cp, engine)
 
 	// 数据已全部入库，但在搜索生效前需要重建索引
+	// 状态条件保证不会覆盖处理期间被设置的 Paused/Cancelled
 	if err == nil {
-		s.DB.Model(&model.ImportBatch{}).Where("id = ?", batchID).Update("status", model.BatchStatusIndexing)
+		s.DB.Model(&model.ImportBatch{}).Where("id = ? AND status = ?", batchID, model.BatchStatusProcessing).
+			Update("status", model.BatchStatusIndexing)
 
 		// 关键：进入索引阶段后，从 activeTasks 移除，防止被错误中断 - 已移除 activeTasks 逻辑
 		// activeTasksMu.Lock()
@@ -212,31 +251,28 @@ func (s *CleanerService) processFileStream(ctx context.Context, batchID uint, fi
 	}
 
 	// 关键：无论成功还是中断（暂停/取消），都应尝试重建索引，以便用户在界面上能正常搜索已导入的数据
-	repository.RebuildSearchIndexes()
+	repository.BuildBatchIndexes(batchID)
 
+	// 中断时 processRows 已将提交水位保存为断点，Resume 会从该位置继续
 	if err != nil {
-		// 如果是主动中断，我们需要持久化当前的进度，以便后续 Resume
-		if ctx.Err() != nil {
-			s.DB.Model(&model.ImportBatch{}).Where("id = ?", batchID).
-				Updates(map[string]interface{}{
-					"processed_rows": stats.rowIdx,
-					"success_count":  stats.successRows,
-					"failure_count":  stats.failedRows,
-				})
-		}
 		return err
 	}
 
 	// 6. 更新批量状态为已完成
-	return s.DB.Model(&model.ImportBatch{}).Where("id = ?", batchID).
-		Updates(map[string]interface{}{
-			"status":         model.BatchStatusCompleted,
-			"processed_rows": stats.rowIdx,
-			"total_rows":     stats.rowIdx,
-			"success_count":  stats.successRows,
-			"failure_count":  stats.failedRows,
-			"completed_at":   time.Now(),
-		}).Error
+	completed := map[string]interface{}{
+		"status":         model.BatchStatusCompleted,
+		"processed_rows": stats.rowIdx,
+		"total_rows":     stats.rowIdx,
+		"success_count":  stats.successRows,
+		"failure_count":  stats.failedRows,
+		"completed_at":   time.Now(),
+		"analytics":      nil, // 恢复过的批次在首次查询时重新聚合
+	}
+	if stats.analytics != nil {
+		completed["analytics"] = stats.analytics
+	}
+	return s.DB.Model(&model.ImportBatch{}).Where("id = ? AND status = ?", batchID, model.BatchStatusIndexing).
+		Updates(completed).Error
 }
 
 // readHeader 从迭代器读取并验证表头行
@@ -257,11 +293,29 @@ func (s *CleanerService) readHeader(iter utils.RowIterator) ([]string, error) {
 	return header, nil
 }
 
-// processStats 文件处理期间的统计信息
+// resolveColumns 确定逻辑列位置：优先使用上传时提交的列映射，未提供时才回退到表头自动识别
+func resolveColumns(header []string, mapping string) (utils.ColIndices, map[int]bool, error) {
+	m, err := utils.ParseColumnMapping(mapping)
+	if err != nil {
+		return utils.ColIndices{}, nil, err
+	}
+	if m != nil {
+		return utils.ResolveMapping(header, m)
+	}
+
+	indices := utils.DetectHeaders(header)
+	if indices.Phone == -1 && indices.Name == -1 {
+		return indices, nil, fmt.Errorf("could not detect required columns (Name/Phone). Header was: %v", header)
+	}
+	return indices, nil, nil
+}
+
+// processStats 文件处理结束时的统计信息（均为已提交到数据库的行）
 type processStats struct {
 	rowIdx      int
 	successRows int
 	failedRows  int
+	analytics   *model.BatchAnalytics // 仅在从头处理完整个文件时生成
 }
 
 // getAdaptiveConfig 根据系统资源自动计算最优配置
@@ -314,14 +368,23 @@ func getAdaptiveConfig() (numWorkers int, numSavers int, bufferSize int, batchSi
 	return
 }
 
-// processRows 采用高度并发的 Worker Pool 模式处理数据
-func (s *CleanerService) processRows(ctx context.Context, iter utils.RowIterator, header []string, batchID uint, indices utils.ColIndices, skipRows int, engine *RuleEngine) (*processStats, error) {
+// processRows 采用高度并发的 Worker Pool 模式处理数据。
+// 进度以已提交行的连续水位为准：中断时保存的断点之前的行都已入库，之后的行在恢复时重新写入并由唯一索引去重。
+func (s *CleanerService) processRows(ctx context.Context, iter utils.RowIterator, batchID uint, schema *batchSchema, cp batchCheckpoint, engine *RuleEngine) (*processStats, error) {
 	// 自适应配置
 	numWorkers, numSavers, bufferSize, batchSize := getAdaptiveConfig()
 
-	stats := &processStats{rowIdx: 0}
-	if skipRows > 0 {
-		stats.rowIdx = skipRows
+	store := s.batchStore()
+	watermark := newRowWatermark(cp)
+	rowIdx := cp.Rows // 已读取的行号
+
+	// 从头处理时每个 Saver 对已提交的记录增量统计；恢复的批次缺少断点前的行，改为查询时聚合
+	var collectors []*analyticsCollector
+	if cp.Rows == 0 {
+		collectors = make([]*analyticsCollector, numSavers)
+		for i := range collectors {
+			collectors[i] = newAnalyticsCollector(schema)
+		}
 	}
 
 	// 定义内部任务结构
@@ -330,27 +393,12 @@ func (s *CleanerService) processRows(ctx context.Context, iter utils.RowIterator
 		idx int
 	}
 
-	// 准备列名映射，用于规则匹配
-	colNames := struct {
-		Name    string
-		Phone   string
-		Address string
-		Date    string
-	}{
-		Name:    getHeaderName(header, indices.Name, "name"),
-		Phone:   getHeaderName(header, indices.Phone, "phone"),
-		Address: getHeaderName(header, indices.Address, "address"),
-		Date:    getHeaderName(header, indices.Date, "date"),
-	}
-
 	// Channel 定义，根据可用内存自动调整缓冲区大小
 	taskChan := make(chan task, bufferSize)
 	resultChan := make(chan model.Record, bufferSize)
 	errChan := make(chan error, 1)
 
 	var wg sync.WaitGroup
-	var successCount int64
-	var failureCount int64
 
 	// 1. 启动 Worker 池进行并行清洗 (CPU 密集型)
 	for i := 0; i < numWorkers; i++ {
@@ -358,13 +406,10 @@ func (s *CleanerService) processRows(ctx context.Context, iter utils.RowIterator
 		go func() {
 			defer wg.Done()
 			for t := range taskChan {
-				rec := s.createRecordFromRow(t.row, batchID, t.idx, indices, colNames, engine)
-				if rec.Status == "Clean" {
-					atomic.AddInt64(&successCount, 1)
-				} else {
-					atomic.AddInt64(&failureCount, 1)
+				if ctx.Err() != nil {
+					continue // 已中断：丢弃剩余任务，未提交的行恢复时会重新处理
 				}
-				resultChan <- rec
+				resultChan <- s.createRecordFromRow(t.row, batchID, t.idx, schema, engine)
 			}
 		}()
 	}
@@ -374,25 +419,23 @@ func (s *CleanerService) processRows(ctx context.Context, iter utils.RowIterator
 	saveDone := make(chan struct{})
 
 	// 启动进度监控协程 (避免多个 Saver 竞争更新数据库)
+	// 仅在水位变化时写库，updated_at 因此可作为进度心跳供 Reaper 判断批次是否卡死
 	monitorDone := make(chan struct{})
 	go func() {
-		ticker := time.NewTicker(1 * time.Second)
+		ticker := time.NewTicker(checkpointInterval)
 		defer ticker.Stop()
 		defer close(monitorDone)
 
+		last := cp
 		for {
 			select {
 			case <-ticker.C:
-				sCount := atomic.LoadInt64(&successCount)
-				fCount := atomic.LoadInt64(&failureCount)
-				stats.rowIdx = int(sCount + fCount) // 估算当前总进度
-
-				s.DB.Model(&model.ImportBatch{}).Where("id = ?", batchID).
-					Updates(map[string]interface{}{
-						"processed_rows": stats.rowIdx,
-						"success_count":  int(sCount),
-						"failure_count":  int(fCount),
-					})
+				current := watermark.checkpoint()
+				if current == last {
+					continue
+				}
+				last = current
+				store.SaveCheckpoint(batchID, current)
 			case <-saveDone: // 所有 Saver 完成后退出
 				return
 			}
@@ -403,23 +446,48 @@ func (s *CleanerService) processRows(ctx context.Context, iter utils.RowIterator
 		saverWg.Add(1)
 		go func() {
 			defer saverWg.Done()
+			var collector *analyticsCollector
+			if collectors != nil {
+				collector = collectors[i]
+			}
 			// 预分配切片容量，减少扩容导致的内存内存抖动
 			batch := make([]model.Record, 0, batchSize)
+			failed := false
+
+			flush := func() {
+				// 重试与二分隔离后仍无法写入时通知生产者停止；未写入的行不会推进水位，恢复时从断点重新处理
+				saved, err := saveChunk(ctx, store, batch)
+				watermark.commit(saved)
+				if collector != nil {
+					for j := range saved {
+						collector.add(&saved[j])
+					}
+				}
+				if err != nil {
+					failed = true
+					if ctx.Err() != nil {
+						return // 中断导致的写入失败不属于存储错误
+					}
+					select {
+					case errChan <- fmt.Errorf("failed to store records: %w", err):
+					default:
+					}
+				}
+				// 彻底清空并重置切片，允许 GC 回收对象
+				batch = batch[:0]
+			}
 
 			for rec := range resultChan {
+				if failed || ctx.Err() != nil {
+					continue // 继续消费以免阻塞 Worker，直到生产者停止
+				}
 				batch = append(batch, rec)
-
 				if len(batch) >= batchSize {
-					// 直接使用 GORM 的 Struct 批量创建，框架内部已高度优化
-					if err := s.DB.CreateInBatches(batch, batchSize).Error; err != nil {
-						log.Printf("[Saver] Bulk insert failed: %v", err)
-					}
-					// 彻底清空并重置切片，允许 GC 回收对象
-					batch = batch[:0]
+					flush()
 				}
 			}
-			if len(batch) > 0 {
-				s.DB.CreateInBatches(batch, len(batch))
+			if len(batch) > 0 && !failed && ctx.Err() == nil {
+				flush()
 			}
 		}()
 	}
@@ -434,48 +502,32 @@ func (s *CleanerService) processRows(ctx context.Context, iter utils.RowIterator
 	startTime := time.Now()
 	lastLogTime := time.Now()
 
-	// 3.1 如果需要恢复进度，执行跳过逻辑
-	if skipRows > 0 {
-		for i := 0; i < skipRows; i++ {
+	// 3.1 如果需要恢复进度，跳过断点之前已提交的行
+	if cp.Rows > 0 {
+		for i := 0; i < cp.Rows; i++ {
 			if !iter.Next() {
 				break
 			}
 		}
-		log.Printf("[Info] Batch %d resumed, skipped %d rows", batchID, skipRows)
+		log.Printf("[Info] Batch %d resumed, skipped %d rows", batchID, cp.Rows)
 	}
 
 	var processErr error
 Loop:
 	for iter.Next() {
-		stats.rowIdx++
+		rowIdx++
 
 		// 每 10 万行更新一次实时吞吐量（适应不同数据量）
-		if stats.rowIdx%100000 == 0 && stats.rowIdx > 0 { // Ensure stats.rowIdx is not 0 for the first log
+		if rowIdx%100000 == 0 {
 			elapsed := time.Since(lastLogTime)
 			bps := float64(100000) / elapsed.Seconds()
-			if stats.rowIdx%1000000 == 0 {
-				log.Printf("[Performance] Processed %d rows, current speed: %.2f rows/sec", stats.rowIdx, bps)
+			if rowIdx%1000000 == 0 {
+				log.Printf("[Performance] Processed %d rows, current speed: %.2f rows/sec", rowIdx, bps)
 			}
 			s.batchSpeeds.Store(batchID, bps)
 			lastLogTime = time.Now()
 		}
 
-		// [Added for Async Worker] 定期检查数据库状态以支持暂停/取消
-		// 每 2000 行检查一次 (batchSize is usually 2000 so this fits)
-		if stats.rowIdx%2000 == 0 {
-			var currentStatus model.BatchStatus
-			if err := s.DB.Model(&model.ImportBatch{}).Select("status").Where("id = ?", batchID).Scan(&currentStatus).Error; err == nil {
-				if currentStatus == model.BatchStatusPaused {
-					processErr = fmt.Errorf("batch paused by user")
-					break Loop
-				}
-				if currentStatus == model.BatchStatusCancelled {
-					processErr = fmt.Errorf("batch cancelled by user")
-					break Loop
-				}
-			}
-		}
-
 		select {
 		case <-ctx.Done():
 			// 关键点：当 Context 被取消时（暂停或取消），停止生产
@@ -491,14 +543,20 @@ Loop:
 		row := iter.Row()
 		// 关键优化：不再只是拷贝 slice header，而是克隆每一个单元格的字符串。
 		// 这不仅是为了并发安全，更是为了切断对读取器底层大缓冲区的引用。
+		// 单元格保持原样（原始行会被完整保存），去除空白在清洗时进行
 		rowClone := make([]string, len(row))
 		for i, v := range row {
-			rowClone[i] = strings.Clone(strings.TrimSpace(v))
+			rowClone[i] = strings.Clone(v)
 		}
 
-		taskChan <- task{
-			row: rowClone,
-			idx: stats.rowIdx,
+		select {
+		case taskChan <- task{row: rowClone, idx: rowIdx}:
+		case <-ctx.Done():
+			processErr = ctx.Err()
+			break Loop
+		case err := <-errChan:
+			processErr = err
+			break Loop
 		}
 	}
 
@@ -506,27 +564,42 @@ Loop:
 	wg.Wait()         // 等待 Worker 完成计算
 	close(resultChan) // 通知 Saver 停止
 	<-saveDone        // 等待数据库写入完成
+	<-monitorDone
 
-	// 在函数返回前执行一次最终的状态同步 (确保即使不是 10000 的倍数也能精准更新)
-	sCount := atomic.LoadInt64(&successCount)
-	fCount := atomic.LoadInt64(&failureCount)
-	s.DB.Model(&model.ImportBatch{}).Where("id = ?", batchID).
-		Updates(map[string]interface{}{
-			"processed_rows": stats.rowIdx,
-			"success_count":  int(sCount),
-			"failure_count":  int(fCount),
-		})
+	// 在函数返回前保存最终的提交水位，作为 Resume 的断点
+	final := watermark.checkpoint()
+	store.SaveCheckpoint(batchID, final)
 
 	totalElapsed := time.Since(startTime)
 	log.Printf("[Performance] Total processing time (excluding CountLines): %v, Avg speed: %.2f rows/sec",
-		totalElapsed, float64(stats.rowIdx)/totalElapsed.Seconds())
+		totalElapsed, float64(rowIdx-cp.Rows)/totalElapsed.Seconds())
 
 	if processErr == nil {
 		processErr = iter.Err()
 	}
+	// 生产者已读完但最后一批写入失败时，错误只会出现在 errChan 中
+	if processErr == nil {
+		select {
+		case processErr = <-errChan:
+		default:
+		}
+	}
+	// 生产者已读完后才被中断时，Worker/Saver 丢弃的行同样未提交
+	if processErr == nil && ctx.Err() != nil {
+		processErr = ctx.Err()
+	}
+	if processErr == nil && final.Rows != rowIdx {
+		processErr = fmt.Errorf("only %d of %d rows were committed", final.Rows, rowIdx)
+	}
 
-	stats.successRows = int(successCount)
-	stats.failedRows = int(failureCount)
+	stats := &processStats{
+		rowIdx:      final.Rows,
+		successRows: final.Success,
+		failedRows:  final.Failure,
+	}
+	if processErr == nil && collectors != nil {
+		stats.analytics = mergeCollectors(collectors).result(analyticsSourceRun)
+	}
 
 	// 显式从 sync.Map 中删除 batchID
 	s.batchSpeeds.Delete(batchID)
@@ -548,73 +621,23 @@ Loop:
 	return stats, processErr
 }
 
-// createRecordFromRow 从原始行数据创建 Record
-func (s *CleanerService) createRecordFromRow(row []string, batchID uint, rowIdx int, indices utils.ColIndices, colNames struct {
-	Name    string
-	Phone   string
-	Address string
-	Date    string
-}, engine *RuleEngine) model.Record {
-	getCol := func(idx int) string {
-		if idx >= 0 && idx < len(row) {
-			return row[idx]
+// createRecordFromRow 从原始行数据创建 Record，源文件的每一列都会按列目录清洗并保存，原始行完整保存在 RawData
+func (s *CleanerService) createRecordFromRow(row []string, batchID uint, rowIdx int, schema *batchSchema, engine *RuleEngine) model.Record {
+	rec := schema.buildRecord(func(col model.BatchColumn) string {
+		if col.Index >= 0 && col.Index < len(row) {
+			return strings.TrimSpace(row[col.Index])
 		}
 		return ""
-	}
-	rawName := getCol(indices.Name)
-	rawPhone := getCol(indices.Phone)
-	rawAddress := getCol(indices.Address)
-	rawDate := getCol(indices.Date)
-
-	rec := model.Record{
-		BatchID:  batchID,
-		RowIndex: rowIdx,
-		Address:  utils.Truncate(rawAddress, 255),
-	}
-
-	var errors []string
-
-	// 动态清洗
-	cleanName, err := engine.Execute(colNames.Name, rawName)
-	if err != nil {
-		errors = append(errors, fmt.Sprintf("Name: %v", err))
-	}
-	rec.Name = utils.Truncate(cleanName, 255)
-
-	cleanPhone, err := engine.Execute(colNames.Phone, rawPhone)
-	if err != nil {
-		errors = append(errors, fmt.Sprintf("Phone: %v", err))
-	}
-	rec.Phone = utils.Truncate(cleanPhone, 50)
-
-	cleanDate, err := engine.Execute(colNames.Date, rawDate)
-	if err != nil {
-		errors = append(errors, fmt.Sprintf("Date: %v", err))
-	}
-	rec.Date = utils.Truncate(cleanDate, 50)
-
-	// 地址解析 (动态)
-	p, _ := engine.Execute("address_province", rawAddress)
-	c, _ := engine.Execute("address_city", rawAddress)
-	d, _ := engine.Execute("address_district", rawAddress)
-	rec.Province = utils.Truncate(p, 100)
-	rec.City = utils.Truncate(c, 100)
-	rec.District = utils.Truncate(d, 100)
-
-	// 状态判断
-	if len(errors) > 0 {
-		rec.Status = "Error"
-		rec.ErrorMessage = fmt.Sprintf("%v", errors)
-	} else {
-		rec.Status = "Clean"
-	}
-
+	}, engine)
+	rec.BatchID = batchID
+	rec.RowIndex = rowIdx
+	rec.RawData = encodeRawRow(row)
 	return rec
 }
 
 // PauseBatch 暂停正在运行的任务
 func (s *CleanerService) PauseBatch(batchID uint) error {
-	// Worker 模式下，直接修改数据库状态即可。Worker 轮询会检测到并停止。
+	// Worker 模式下，修改数据库状态并推送暂停信号，正在处理的 Worker 收到后立即停止
 	var batch model.ImportBatch
 	if err := s.DB.First(&batch, batchID).Error; err != nil {
 		return fmt.Errorf("batch not found: %w", err)
@@ -630,8 +653,12 @@ func (s *CleanerService) PauseBatch(batchID uint) error {
 		return nil // 已经是暂停状态
 	}
 	// 如果是 Processing 或 Pending，都可以暂停
-	return s.DB.Model(&model.ImportBatch{}).Where("id = ?", batchID).
-		Update("status", model.BatchStatusPaused).Error
+	if err := s.DB.Model(&model.ImportBatch{}).Where("id = ?", batchID).
+		Update("status", model.BatchStatusPaused).Error; err != nil {
+		return err
+	}
+	s.publishControl(batchID, ControlPause)
+	return nil
 }
 
 // ResumeBatch 恢复暂停的任务
@@ -645,12 +672,31 @@ func (s *CleanerService) ResumeBatch(batchID uint) error {
 		return fmt.Errorf("only paused batches can be resumed")
 	}
 
-	// 重新拉起异步处理 (Re-enqueue)
-	// 注意：Resume 时不需要改变 status 为 processing，Worker 取到任务后会改成 processing
-	// 但为了 UI 响应即时性，可以先改一下，或者让 Worker 改
+	// 清除暂停信号，避免恢复后被立即中断
+	if err := s.Control.Clear(context.Background(), batchID); err != nil {
+		return err
+	}
 
-	// 重新推入队列
-	return s.Queue.EnqueueTask(batchID, batch.FilePath)
+	// 先把状态改回 Pending，否则 Worker 取到任务后会因 Paused 直接跳过并确认任务。
+	// 条件更新保证并发的取消/恢复请求不会被覆盖
+	res := s.DB.Model(&model.ImportBatch{}).
+		Where("id = ? AND status = ?", batchID, model.BatchStatusPaused).
+		Update("status", model.BatchStatusPending)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("only paused batches can be resumed")
+	}
+
+	// 重新推入队列，失败时恢复为 Paused 以便再次 Resume
+	if err := s.Queue.EnqueueTask(batchID, batch.FilePath); err != nil {
+		s.DB.Model(&model.ImportBatch{}).
+			Where("id = ? AND status = ?", batchID, model.BatchStatusPending).
+			Update("status", model.BatchStatusPaused)
+		return err
+	}
+	return nil
 }
 
 // CancelBatch 取消任务
@@ -670,8 +716,20 @@ func (s *CleanerService) CancelBatch(batchID uint) error {
 		return fmt.Errorf("batch is in indexing phase, please wait")
 	}
 
-	return s.DB.Model(&model.ImportBatch{}).Where("id = ?", batchID).
-		Update("status", model.BatchStatusCancelled).Error
+	if err := s.DB.Model(&model.ImportBatch{}).Where("id = ?", batchID).
+		Update("status", model.BatchStatusCancelled).Error; err != nil {
+		return err
+	}
+	s.publishControl(batchID, ControlCancel)
+	return nil
+}
+
+// publishControl 通知正在处理该批次的 Worker 立即停止。
+// 状态已写入数据库：即使通知失败，Worker 结束时的条件更新也不会覆盖 Paused/Cancelled
+func (s *CleanerService) publishControl(batchID uint, action string) {
+	if err := s.Control.Publish(context.Background(), batchID, action); err != nil {
+		log.Printf("[Control] Failed to publish %s for batch %d: %v", action, batchID, err)
+	}
 }
 
 // GetBatchSpeed 获取指定批次当前的实时处理速度
@@ -681,10 +739,3 @@ func (s *CleanerService) GetBatchSpeed(batchID uint) float64 {
 	}
 	return 0
 }
-
-func getHeaderName(header []string, idx int, fallback string) string {
-	if idx >= 0 && idx < len(header) {
-		return header[idx]
-	}
-	return fallback
-}
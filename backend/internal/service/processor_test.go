@@ -1,7 +1,20 @@
 package service
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"etl-tool/internal/model"
+	"etl-tool/internal/repository"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	gormPostgres "gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 func TestSmartUnmarshal(t *testing.T) {
@@ -135,7 +148,7 @@ func TestBuildRollbackUpdates(t *testing.T) {
 				"status":        "Clean",
 				"error_message": "",
 			},
-			wantKeys: 8,
+			wantKeys: 9, // errors is restored alongside status
 		},
 		{
 			name: "Partial data with nils",
@@ -156,3 +169,76 @@ func TestBuildRollbackUpdates(t *testing.T) {
 		})
 	}
 }
+
+// openTestDB 连接已迁移的测试数据库，未设置 ETL_TEST_DSN 时跳过：
+//
+//	ETL_TEST_DSN="host=localhost user=postgres password=123456 dbname=csv_cleaner port=5436 sslmode=disable" \
+//	go test ./internal/service -run ResumeBatch
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("ETL_TEST_DSN")
+	if dsn == "" {
+		t.Skip("ETL_TEST_DSN not set")
+	}
+	db, err := gorm.Open(gormPostgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	repository.DB = db
+	return db
+}
+
+func TestResumeBatch_ProcessesPausedBatch(t *testing.T) {
+	db := openTestDB(t)
+
+	mr := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	path := filepath.Join(t.TempDir(), "resume.csv")
+	content := "姓名,电话\n张三,13812345678\n李四,13987654321\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	batch := model.ImportBatch{OriginalFilename: "resume.csv", FilePath: path, Status: model.BatchStatusPending}
+	if err := db.Create(&batch).Error; err != nil {
+		t.Fatalf("Create batch error = %v", err)
+	}
+	t.Cleanup(func() {
+		repository.DropBatchPartition(db, batch.ID)
+		db.Unscoped().Delete(&model.ImportBatch{}, batch.ID)
+	})
+
+	s := &CleanerService{
+		DB:         db,
+		processSem: make(chan struct{}, 1),
+		Engine:     NewRuleEngine(),
+		Queue:      NewQueueServiceWithClient(client),
+		Control:    NewControlServiceWithClient(client),
+	}
+
+	if err := s.PauseBatch(batch.ID); err != nil {
+		t.Fatalf("PauseBatch() error = %v", err)
+	}
+	if err := s.ResumeBatch(batch.ID); err != nil {
+		t.Fatalf("ResumeBatch() error = %v", err)
+	}
+	if err := s.ResumeBatch(batch.ID); err == nil {
+		t.Error("Resuming a batch that is no longer paused should fail")
+	}
+
+	task, err := s.Queue.DequeueTask(time.Second)
+	if err != nil || task == nil || task.BatchID != batch.ID {
+		t.Fatalf("Resumed batch was not re-enqueued: task=%+v err=%v", task, err)
+	}
+	s.ProcessBatch(context.Background(), task.BatchID, task.FilePath)
+
+	var got model.ImportBatch
+	if err := db.First(&got, batch.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != model.BatchStatusCompleted || got.ProcessedRows != 2 {
+		t.Errorf("Resumed batch ended %s with %d rows, want Completed with 2", got.Status, got.ProcessedRows)
+	}
+}
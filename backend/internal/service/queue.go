@@ -4,28 +4,98 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"etl-tool/internal/config"
 	"etl-tool/internal/infrastructure/redis"
 	"fmt"
+	"log"
+	"os"
 	"time"
+
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
 )
 
-const QueueKey = "tasks:file_processing"
+const (
+	// QueueKey 待处理任务队列
+	QueueKey = "tasks:file_processing"
+	// ProcessingKeyPrefix 每个 Worker 独占的处理中列表，任务在 Ack 之前一直保存在这里
+	ProcessingKeyPrefix = "tasks:processing:"
+	// DeadLetterKey 超过最大重试次数的任务
+	DeadLetterKey = "tasks:dead_letter"
+	// WorkersKey 已注册的 Worker 集合
+	WorkersKey = "workers:active"
+	// HeartbeatKeyPrefix Worker 心跳 Key，过期即视为 Worker 已停止
+	HeartbeatKeyPrefix = "workers:heartbeat:"
+)
 
 type FileTask struct {
-	BatchID  uint   `json:"batch_id"`
-	FilePath string `json:"file_path"`
+	BatchID  uint     `json:"batch_id"`
+	FilePath string   `json:"file_path"`
+	Attempts int      `json:"attempts,omitempty"` // 因 Worker 失联被重新投递的次数
+	Errors   []string `json:"errors,omitempty"`   // 每次重新投递的原因
+
+	raw string // 出队时的原始 payload，Ack 时据此从处理中列表移除
 }
 
-type QueueService struct{}
+// QueueService 基于 Redis List 的可靠队列：
+// BLMOVE 出队到 Worker 自己的处理中列表，处理完成后显式 Ack；
+// Worker 心跳过期后，其处理中列表里的任务会被其他 Worker 回收并重新投递，
+// 超过 MaxRetries 次后进入死信队列并触发 OnDeadLetter。
+type QueueService struct {
+	client *goredis.Client
+
+	WorkerID          string
+	VisibilityTimeout time.Duration // 心跳有效期
+	MaxRetries        int
+	OnDeadLetter      func(task *FileTask)
+}
 
 func NewQueueService() *QueueService {
-	return &QueueService{}
+	return NewQueueServiceWithClient(nil)
+}
+
+// NewQueueServiceWithClient 使用指定的 Redis 客户端创建队列（为 nil 时使用全局客户端）
+func NewQueueServiceWithClient(client *goredis.Client) *QueueService {
+	visibility := 30 * time.Second
+	maxRetries := 3
+	if config.AppConfig != nil {
+		if config.AppConfig.Queue.VisibilityTimeout > 0 {
+			visibility = time.Duration(config.AppConfig.Queue.VisibilityTimeout) * time.Second
+		}
+		if config.AppConfig.Queue.MaxRetries > 0 {
+			maxRetries = config.AppConfig.Queue.MaxRetries
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	return &QueueService{
+		client:            client,
+		WorkerID:          fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.New().String()[:8]),
+		VisibilityTimeout: visibility,
+		MaxRetries:        maxRetries,
+	}
+}
+
+// rdb 返回当前可用的 Redis 客户端
+func (s *QueueService) rdb() (*goredis.Client, error) {
+	if s.client != nil {
+		return s.client, nil
+	}
+	if redis.Client == nil {
+		return nil, fmt.Errorf("redis client not initialized")
+	}
+	return redis.Client, nil
+}
+
+func (s *QueueService) processingKey(workerID string) string {
+	return ProcessingKeyPrefix + workerID
 }
 
 // EnqueueTask adds a file processing task to the redis list
 func (s *QueueService) EnqueueTask(batchID uint, filePath string) error {
-	if redis.Client == nil {
-		return fmt.Errorf("redis client not initialized")
+	client, err := s.rdb()
+	if err != nil {
+		return err
 	}
 
 	task := FileTask{
@@ -36,28 +106,269 @@ func (s *QueueService) EnqueueTask(batchID uint, filePath string) error {
 	if err != nil {
 		return err
 	}
-	return redis.Client.RPush(context.Background(), QueueKey, data).Err()
+	return client.RPush(context.Background(), QueueKey, data).Err()
 }
 
-// DequeueTask waits for a task from the redis list (blocking)
+// DequeueTask waits for a task (blocking) and atomically moves it into this worker's processing list.
+// 超时返回 goredis.Nil。取到的任务必须在处理完成后调用 AckTask 或 RequeueTask。
 func (s *QueueService) DequeueTask(timeout time.Duration) (*FileTask, error) {
-	if redis.Client == nil {
-		return nil, fmt.Errorf("redis client not initialized")
+	client, err := s.rdb()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	// 出队前先刷新心跳，保证处理中列表始终处于心跳保护之下
+	if err := s.Heartbeat(ctx); err != nil {
+		return nil, err
+	}
+
+	raw, err := client.BLMove(ctx, QueueKey, s.processingKey(s.WorkerID), "LEFT", "RIGHT", timeout).Result()
+	if err != nil {
+		return nil, err
 	}
 
-	// BLPOP returns: [key, value]
-	result, err := redis.Client.BLPop(context.Background(), timeout, QueueKey).Result()
+	task, err := decodeTask(raw)
 	if err != nil {
+		// 无法解析的任务直接进入死信队列，避免阻塞处理中列表
+		client.LRem(ctx, s.processingKey(s.WorkerID), 1, raw)
+		client.LPush(ctx, DeadLetterKey, raw)
 		return nil, err
 	}
+	return task, nil
+}
+
+// AckTask 确认任务已处理完成，将其从处理中列表移除
+func (s *QueueService) AckTask(task *FileTask) error {
+	client, err := s.rdb()
+	if err != nil {
+		return err
+	}
+	return client.LRem(context.Background(), s.processingKey(s.WorkerID), 1, task.raw).Err()
+}
+
+// RequeueTask 将任务放回队列头部（不计入重试次数），用于 Worker 正常退出时交还未完成的任务
+func (s *QueueService) RequeueTask(task *FileTask) error {
+	client, err := s.rdb()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	pipe := client.TxPipeline()
+	pipe.LRem(ctx, s.processingKey(s.WorkerID), 1, task.raw)
+	pipe.LPush(ctx, QueueKey, task.raw)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Heartbeat 注册 Worker 并刷新心跳
+func (s *QueueService) Heartbeat(ctx context.Context) error {
+	client, err := s.rdb()
+	if err != nil {
+		return err
+	}
+	pipe := client.TxPipeline()
+	pipe.SAdd(ctx, WorkersKey, s.WorkerID)
+	pipe.Set(ctx, HeartbeatKeyPrefix+s.WorkerID, time.Now().Unix(), s.VisibilityTimeout)
+	_, err = pipe.Exec(ctx)
+	return err
+}
 
-	if len(result) < 2 {
-		return nil, fmt.Errorf("invalid redis response")
+// StartHeartbeat 在后台周期性刷新心跳，直到 ctx 结束
+func (s *QueueService) StartHeartbeat(ctx context.Context) {
+	interval := s.VisibilityTimeout / 3
+	if interval <= 0 {
+		interval = time.Second
 	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Heartbeat(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("[Queue] Heartbeat failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// StartReclaimer 在后台周期性回收失联 Worker 的任务，直到 ctx 结束
+func (s *QueueService) StartReclaimer(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := s.ReclaimStale(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("[Queue] Reclaim failed: %v", err)
+				} else if n > 0 {
+					log.Printf("[Queue] Reclaimed %d task(s) from stopped workers", n)
+				}
+			}
+		}
+	}()
+}
+
+// ReclaimStale 扫描所有心跳已过期的 Worker，将其处理中的任务重新投递或移入死信队列。
+// 返回回收的任务数。
+func (s *QueueService) ReclaimStale(ctx context.Context) (int, error) {
+	client, err := s.rdb()
+	if err != nil {
+		return 0, err
+	}
+
+	workers, err := client.SMembers(ctx, WorkersKey).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	reclaimed := 0
+	for _, worker := range workers {
+		if worker == s.WorkerID {
+			continue
+		}
+		alive, err := client.Exists(ctx, HeartbeatKeyPrefix+worker).Result()
+		if err != nil {
+			return reclaimed, err
+		}
+		if alive > 0 {
+			continue
+		}
+
+		for {
+			// 先原子地转移到自己的处理中列表：即使本 Worker 在此期间崩溃，任务也不会丢失
+			raw, err := client.LMove(ctx, s.processingKey(worker), s.processingKey(s.WorkerID), "LEFT", "RIGHT").Result()
+			if err == goredis.Nil {
+				break
+			}
+			if err != nil {
+				return reclaimed, err
+			}
+			if err := s.redeliver(ctx, client, raw, fmt.Sprintf("worker %s stopped heartbeating at %s", worker, time.Now().Format(time.RFC3339))); err != nil {
+				return reclaimed, err
+			}
+			reclaimed++
+		}
+
+		client.SRem(ctx, WorkersKey, worker)
+	}
+	return reclaimed, nil
+}
+
+// redeliver 记录失败原因并增加重试计数，超过上限则进入死信队列
+func (s *QueueService) redeliver(ctx context.Context, client *goredis.Client, raw string, reason string) error {
+	task, err := decodeTask(raw)
+	if err != nil {
+		pipe := client.TxPipeline()
+		pipe.LRem(ctx, s.processingKey(s.WorkerID), 1, raw)
+		pipe.LPush(ctx, DeadLetterKey, raw)
+		_, err = pipe.Exec(ctx)
+		return err
+	}
+
+	task.Attempts++
+	task.Errors = append(task.Errors, reason)
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+
+	dead := task.Attempts > s.MaxRetries
+	target := QueueKey
+	if dead {
+		target = DeadLetterKey
+	}
+
+	pipe := client.TxPipeline()
+	pipe.LRem(ctx, s.processingKey(s.WorkerID), 1, raw)
+	pipe.LPush(ctx, target, data) // 重新投递的任务放在队首优先处理
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	if dead {
+		log.Printf("[Queue] Batch %d moved to dead letter after %d attempts", task.BatchID, task.Attempts)
+		if s.OnDeadLetter != nil {
+			s.OnDeadLetter(task)
+		}
+	} else {
+		log.Printf("[Queue] Batch %d re-queued (attempt %d/%d): %s", task.BatchID, task.Attempts, s.MaxRetries, reason)
+	}
+	return nil
+}
+
+// TaskLocation 描述某个批次的任务当前在 Redis 中的位置
+type TaskLocation struct {
+	Queued bool   // 在待处理队列中
+	Worker string // 持有该任务的 Worker，为空表示不在任何处理中列表里
+	Alive  bool   // 持有者心跳是否有效
+}
+
+// Found 任务是否仍在队列或某个处理中列表里
+func (l TaskLocation) Found() bool {
+	return l.Queued || l.Worker != ""
+}
+
+// LocateTask 查找批次对应的任务：先查待处理队列，再查所有已注册 Worker 的处理中列表
+func (s *QueueService) LocateTask(ctx context.Context, batchID uint) (TaskLocation, error) {
+	var loc TaskLocation
+	client, err := s.rdb()
+	if err != nil {
+		return loc, err
+	}
+
+	contains := func(key string) (bool, error) {
+		items, err := client.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return false, err
+		}
+		for _, raw := range items {
+			if task, err := decodeTask(raw); err == nil && task.BatchID == batchID {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if loc.Queued, err = contains(QueueKey); err != nil || loc.Queued {
+		return loc, err
+	}
+
+	workers, err := client.SMembers(ctx, WorkersKey).Result()
+	if err != nil {
+		return loc, err
+	}
+	for _, worker := range workers {
+		held, err := contains(s.processingKey(worker))
+		if err != nil {
+			return loc, err
+		}
+		if !held {
+			continue
+		}
+		alive, err := client.Exists(ctx, HeartbeatKeyPrefix+worker).Result()
+		if err != nil {
+			return loc, err
+		}
+		loc.Worker = worker
+		loc.Alive = alive > 0
+		return loc, nil
+	}
+	return loc, nil
+}
 
+func decodeTask(raw string) (*FileTask, error) {
 	var task FileTask
-	if err := json.Unmarshal([]byte(result[1]), &task); err != nil {
+	if err := json.Unmarshal([]byte(raw), &task); err != nil {
 		return nil, err
 	}
+	task.raw = raw
 	return &task, nil
 }
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func newTestQueues(t *testing.T) (*miniredis.Miniredis, *QueueService, *QueueService) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	a := NewQueueServiceWithClient(client)
+	a.WorkerID = "worker-a"
+	a.VisibilityTimeout = 10 * time.Second
+	a.MaxRetries = 2
+
+	b := NewQueueServiceWithClient(client)
+	b.WorkerID = "worker-b"
+	b.VisibilityTimeout = 10 * time.Second
+	b.MaxRetries = 2
+	return mr, a, b
+}
+
+func TestQueue_DequeueAndAck(t *testing.T) {
+	mr, a, _ := newTestQueues(t)
+
+	if err := a.EnqueueTask(1, "uploads/a.csv"); err != nil {
+		t.Fatalf("EnqueueTask() error = %v", err)
+	}
+
+	task, err := a.DequeueTask(time.Second)
+	if err != nil {
+		t.Fatalf("DequeueTask() error = %v", err)
+	}
+	if task.BatchID != 1 || task.FilePath != "uploads/a.csv" {
+		t.Errorf("Unexpected task: %+v", task)
+	}
+
+	// 出队后任务保存在 Worker 的处理中列表里，直到 Ack
+	processing, _ := mr.List(ProcessingKeyPrefix + "worker-a")
+	if len(processing) != 1 {
+		t.Fatalf("Expected 1 task in processing list, got %d", len(processing))
+	}
+
+	if err := a.AckTask(task); err != nil {
+		t.Fatalf("AckTask() error = %v", err)
+	}
+	if mr.Exists(ProcessingKeyPrefix + "worker-a") {
+		t.Error("Processing list should be empty after ack")
+	}
+
+	// 队列为空时超时返回 redis.Nil
+	if _, err := a.DequeueTask(time.Second); err != goredis.Nil {
+		t.Errorf("Expected redis.Nil on empty queue, got %v", err)
+	}
+}
+
+func TestQueue_ReclaimFromStoppedWorker(t *testing.T) {
+	mr, a, b := newTestQueues(t)
+	ctx := context.Background()
+
+	a.EnqueueTask(7, "uploads/b.csv")
+	if _, err := a.DequeueTask(time.Second); err != nil {
+		t.Fatalf("DequeueTask() error = %v", err)
+	}
+
+	// Worker A 仍有心跳时不回收
+	b.Heartbeat(ctx)
+	if n, _ := b.ReclaimStale(ctx); n != 0 {
+		t.Fatalf("Should not reclaim from a live worker, reclaimed %d", n)
+	}
+
+	// 模拟 Worker A 崩溃：心跳过期
+	mr.FastForward(11 * time.Second)
+	b.Heartbeat(ctx)
+
+	n, err := b.ReclaimStale(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("ReclaimStale() = %d, %v; want 1, nil", n, err)
+	}
+
+	task, err := b.DequeueTask(time.Second)
+	if err != nil {
+		t.Fatalf("DequeueTask() after reclaim error = %v", err)
+	}
+	if task.BatchID != 7 || task.Attempts != 1 || len(task.Errors) != 1 {
+		t.Errorf("Reclaimed task not annotated: %+v", task)
+	}
+	if ok, _ := mr.SIsMember(WorkersKey, "worker-a"); ok {
+		t.Error("Stopped worker should be unregistered after reclaim")
+	}
+}
+
+func TestQueue_DeadLetterAfterMaxRetries(t *testing.T) {
+	mr, a, b := newTestQueues(t)
+	ctx := context.Background()
+
+	var dead *FileTask
+	b.OnDeadLetter = func(task *FileTask) { dead = task }
+	a.OnDeadLetter = b.OnDeadLetter
+
+	a.EnqueueTask(9, "uploads/c.csv")
+
+	// 两个 Worker 轮流崩溃，每次回收都增加一次重试计数
+	workers := []*QueueService{a, b}
+	for attempt := 0; attempt <= a.MaxRetries; attempt++ {
+		victim := workers[attempt%2]
+		rescuer := workers[(attempt+1)%2]
+
+		if _, err := victim.DequeueTask(time.Second); err != nil {
+			t.Fatalf("attempt %d: DequeueTask() error = %v", attempt, err)
+		}
+		mr.FastForward(11 * time.Second)
+		rescuer.Heartbeat(ctx)
+		if _, err := rescuer.ReclaimStale(ctx); err != nil {
+			t.Fatalf("attempt %d: ReclaimStale() error = %v", attempt, err)
+		}
+	}
+
+	if dead == nil {
+		t.Fatal("OnDeadLetter was not called")
+	}
+	if dead.BatchID != 9 || dead.Attempts != a.MaxRetries+1 || len(dead.Errors) != a.MaxRetries+1 {
+		t.Errorf("Unexpected dead-lettered task: %+v", dead)
+	}
+
+	letters, _ := mr.List(DeadLetterKey)
+	if len(letters) != 1 {
+		t.Errorf("Expected 1 dead letter, got %d", len(letters))
+	}
+	if queued, _ := mr.List(QueueKey); len(queued) != 0 {
+		t.Errorf("Dead-lettered task should not be re-queued, queue = %v", queued)
+	}
+}
+
+func TestQueue_RequeueKeepsAttempts(t *testing.T) {
+	mr, a, _ := newTestQueues(t)
+
+	a.EnqueueTask(3, "uploads/d.csv")
+	task, _ := a.DequeueTask(time.Second)
+
+	if err := a.RequeueTask(task); err != nil {
+		t.Fatalf("RequeueTask() error = %v", err)
+	}
+	if mr.Exists(ProcessingKeyPrefix + "worker-a") {
+		t.Error("Requeued task should leave the processing list")
+	}
+
+	again, err := a.DequeueTask(time.Second)
+	if err != nil {
+		t.Fatalf("DequeueTask() error = %v", err)
+	}
+	if again.BatchID != 3 || again.Attempts != 0 {
+		t.Errorf("Requeue should not count as a retry: %+v", again)
+	}
+}
+
+func TestQueue_LocateTask(t *testing.T) {
+	mr, a, b := newTestQueues(t)
+	ctx := context.Background()
+
+	a.EnqueueTask(1, "uploads/a.csv")
+	a.EnqueueTask(2, "uploads/b.csv")
+
+	if loc, _ := b.LocateTask(ctx, 1); !loc.Queued {
+		t.Errorf("Batch 1 should be queued, got %+v", loc)
+	}
+
+	a.DequeueTask(time.Second)
+	loc, err := b.LocateTask(ctx, 1)
+	if err != nil || loc.Queued || loc.Worker != "worker-a" || !loc.Alive {
+		t.Errorf("Batch 1 should be held by live worker-a, got %+v (%v)", loc, err)
+	}
+
+	mr.FastForward(11 * time.Second)
+	if loc, _ := b.LocateTask(ctx, 1); loc.Worker != "worker-a" || loc.Alive {
+		t.Errorf("worker-a should be reported as stopped, got %+v", loc)
+	}
+
+	if loc, _ := b.LocateTask(ctx, 3); loc.Found() {
+		t.Errorf("Batch 3 should not be found, got %+v", loc)
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"etl-tool/internal/model"
+)
+
+// Record.RawData 保存源文件中未经任何处理的整行（含被忽略的列），格式为 JSON 字符串数组；
+// 超过 rawCompressThreshold 字节时 gzip 压缩并以 rawGzipPrefix + base64 保存。
+
+const (
+	rawCompressThreshold = 512
+	rawGzipPrefix        = "gz:"
+)
+
+// encodeRawRow 编码原始行
+func encodeRawRow(row []string) string {
+	b, _ := json.Marshal(row)
+	if len(b) <= rawCompressThreshold {
+		return string(b)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	return rawGzipPrefix + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// decodeRawRow 解码原始行；旧记录没有原始行时返回 nil
+func decodeRawRow(raw string) ([]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	data := []byte(raw)
+	if strings.HasPrefix(raw, rawGzipPrefix) {
+		compressed, err := base64.StdEncoding.DecodeString(raw[len(rawGzipPrefix):])
+		if err != nil {
+			return nil, fmt.Errorf("invalid raw data: %w", err)
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, fmt.Errorf("invalid raw data: %w", err)
+		}
+		defer zr.Close()
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("invalid raw data: %w", err)
+		}
+	}
+	var row []string
+	if err := json.Unmarshal(data, &row); err != nil {
+		return nil, fmt.Errorf("invalid raw data: %w", err)
+	}
+	return row, nil
+}
+
+// rawCells 将原始行与源表头配对；表头缺失或行比表头长时以 column_N 命名
+func rawCells(header []string, raw string) ([]model.RawCell, error) {
+	row, err := decodeRawRow(raw)
+	if err != nil || row == nil {
+		return nil, err
+	}
+	n := len(row)
+	if len(header) > n {
+		n = len(header)
+	}
+	cells := make([]model.RawCell, n)
+	for i := range cells {
+		if i < len(header) {
+			cells[i].Header = header[i]
+		} else {
+			cells[i].Header = fmt.Sprintf("column_%d", i+1)
+		}
+		if i < len(row) {
+			cells[i].Value = row[i]
+		}
+	}
+	return cells, nil
+}
+
+// GetRecord 返回记录详情，附带与源表头配对的原始行
+func (s *CleanerService) GetRecord(id string) (*model.Record, error) {
+	var record model.Record
+	if err := s.DB.First(&record, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	raw, err := s.recordRawCells(&record)
+	if err != nil {
+		return nil, err
+	}
+	record.Raw = raw
+	return &record, nil
+}
+
+// recordRawCells 读取批次的源表头并解码记录的原始行
+func (s *CleanerService) recordRawCells(record *model.Record) ([]model.RawCell, error) {
+	if record.RawData == "" {
+		return nil, nil
+	}
+	var batch model.ImportBatch
+	if err := s.DB.Select("id", "source_header").First(&batch, record.BatchID).Error; err != nil {
+		return nil, err
+	}
+	return rawCells(batch.SourceHeader, record.RawData)
+}
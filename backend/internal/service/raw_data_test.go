@@ -0,0 +1,90 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"etl-tool/internal/model"
+)
+
+func TestRawRow_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		row        []string
+		compressed bool
+	}{
+		{"short row", []string{" 张三 ", "13800138000", ""}, false},
+		{"long row", []string{"李四", strings.Repeat("北京市朝阳区建国路88号", 50)}, true},
+		{"quotes and commas", []string{`a,"b"`, "line1\nline2"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeRawRow(tt.row)
+			if got := strings.HasPrefix(encoded, rawGzipPrefix); got != tt.compressed {
+				t.Errorf("compressed = %v, want %v", got, tt.compressed)
+			}
+			decoded, err := decodeRawRow(encoded)
+			if err != nil {
+				t.Fatalf("decodeRawRow() error = %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tt.row) {
+				t.Errorf("decodeRawRow() = %q, want %q", decoded, tt.row)
+			}
+		})
+	}
+
+	if row, err := decodeRawRow(""); row != nil || err != nil {
+		t.Errorf("decodeRawRow(\"\") = %v, %v, want nil, nil", row, err)
+	}
+	if _, err := decodeRawRow("gz:not-base64!"); err == nil {
+		t.Error("expected error for corrupted raw data")
+	}
+}
+
+func TestRawCells(t *testing.T) {
+	raw := encodeRawRow([]string{"张三", "13800138000", "extra"})
+	got, err := rawCells([]string{"姓名", "手机", "备注", "部门"}, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []model.RawCell{
+		{Header: "姓名", Value: "张三"},
+		{Header: "手机", Value: "13800138000"},
+		{Header: "备注", Value: "extra"},
+		{Header: "部门"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rawCells() = %v, want %v", got, want)
+	}
+
+	// 旧批次没有源表头
+	got, _ = rawCells(nil, raw)
+	if got[2].Header != "column_3" {
+		t.Errorf("rawCells() without header = %v", got)
+	}
+}
+
+func TestCreateRecordFromRow_KeepsRawRow(t *testing.T) {
+	header := []string{"name", "phone", "address"}
+	engine := NewRuleEngine()
+	schema := buildSchema(model.BatchColumns{
+		{Name: "name", Index: 0, Field: FieldName},
+		{Name: "phone", Index: 1, Field: FieldPhone},
+		{Name: "address", Index: 2, Field: FieldAddress},
+	}, engine)
+	longAddress := strings.Repeat("浙江省杭州市西湖区文三路", 30)
+	row := []string{" 张三 ", "13800138000", longAddress}
+
+	rec := (&CleanerService{}).createRecordFromRow(row, 1, 1, schema, engine)
+	if rec.Name != "张三" {
+		t.Errorf("Name = %q, want trimmed value", rec.Name)
+	}
+	if rec.Address != longAddress {
+		t.Errorf("Address truncated to %d runes", len([]rune(rec.Address)))
+	}
+	cells, err := rawCells(header, rec.RawData)
+	if err != nil || cells[0].Value != " 张三 " || cells[2].Value != longAddress {
+		t.Errorf("raw cells = %v, %v", cells, err)
+	}
+}
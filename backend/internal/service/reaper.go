@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"etl-tool/internal/config"
+	"etl-tool/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// Reaper 处理策略
+const (
+	ReaperPolicyRequeue = "requeue" // 从最近的断点（processed_rows）重新入队
+	ReaperPolicyFail    = "fail"    // 直接标记为失败
+)
+
+// reaperConfig 卡死批次检测的阈值与策略
+type reaperConfig struct {
+	Interval           time.Duration
+	StaleAfter         time.Duration
+	IndexingStaleAfter time.Duration
+	Policy             string
+	MaxRecoveries      int
+}
+
+func loadReaperConfig() reaperConfig {
+	cfg := reaperConfig{
+		Interval:           30 * time.Second,
+		StaleAfter:         5 * time.Minute,
+		IndexingStaleAfter: 30 * time.Minute,
+		Policy:             ReaperPolicyRequeue,
+		MaxRecoveries:      3,
+	}
+	if config.AppConfig == nil {
+		return cfg
+	}
+	r := config.AppConfig.Reaper
+	if r.Interval > 0 {
+		cfg.Interval = time.Duration(r.Interval) * time.Second
+	}
+	if r.StaleAfter > 0 {
+		cfg.StaleAfter = time.Duration(r.StaleAfter) * time.Second
+	}
+	if r.IndexingStaleAfter > 0 {
+		cfg.IndexingStaleAfter = time.Duration(r.IndexingStaleAfter) * time.Second
+	}
+	if r.Policy == ReaperPolicyFail {
+		cfg.Policy = ReaperPolicyFail
+	}
+	if r.MaxRecoveries >= 0 {
+		cfg.MaxRecoveries = r.MaxRecoveries
+	}
+	return cfg
+}
+
+type reapAction int
+
+const (
+	reapSkip reapAction = iota
+	reapRequeue
+	reapFail
+)
+
+// decideRecovery 根据任务在队列中的位置与配置的策略决定如何处理卡死的批次，返回动作与诊断信息
+func decideRecovery(batch *model.ImportBatch, loc TaskLocation, cfg reaperConfig, idle time.Duration) (reapAction, string) {
+	// 任务仍在队列中，或持有者心跳已过期（由队列回收器重新投递），无需干预
+	if loc.Queued || (loc.Worker != "" && !loc.Alive) {
+		return reapSkip, ""
+	}
+
+	stalled := fmt.Sprintf("batch stalled in %s for %s at row %d", batch.Status, idle.Round(time.Second), batch.ProcessedRows)
+
+	// Worker 仍在心跳但进度不再前进：重新入队会导致同一批次被并发处理，只能标记失败
+	if loc.Worker != "" {
+		return reapFail, fmt.Sprintf("%s: worker %s is alive but made no progress", stalled, loc.Worker)
+	}
+
+	if cfg.Policy == ReaperPolicyFail {
+		return reapFail, fmt.Sprintf("%s: task lost from queue", stalled)
+	}
+	if batch.RecoveryCount >= cfg.MaxRecoveries {
+		return reapFail, fmt.Sprintf("%s: giving up after %d recoveries", stalled, batch.RecoveryCount)
+	}
+	return reapRequeue, fmt.Sprintf("%s: task lost from queue, re-enqueued (recovery %d/%d)", stalled, batch.RecoveryCount+1, cfg.MaxRecoveries)
+}
+
+// reapUpdates 处理动作对应的批次更新；重新入队时同样记录原因，便于排查批次为何被重启
+func reapUpdates(action reapAction, reason string) map[string]interface{} {
+	if action == reapRequeue {
+		return map[string]interface{}{
+			"status":         model.BatchStatusPending,
+			"error":          reason,
+			"recovery_count": gorm.Expr("recovery_count + 1"),
+		}
+	}
+	return map[string]interface{}{
+		"status": model.BatchStatusFailed,
+		"error":  reason,
+	}
+}
+
+// StartReaper 在后台周期性检查卡死的批次，直到 ctx 结束
+func (s *CleanerService) StartReaper(ctx context.Context) {
+	cfg := loadReaperConfig()
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := s.ReapStaleBatches(ctx, cfg); err != nil && ctx.Err() == nil {
+					log.Printf("[Reaper] Scan failed: %v", err)
+				} else if n > 0 {
+					log.Printf("[Reaper] Recovered %d stalled batch(es)", n)
+				}
+				// 已退出的实例遗留的批量操作
+				s.RecoverBulkOperations()
+			}
+		}
+	}()
+}
+
+// ReapStaleBatches 查找 updated_at 长时间未变化的 Processing/Indexing 批次并按策略恢复，返回处理的批次数。
+// 进度监控仅在 processed_rows 变化时写库，因此 updated_at 停止移动即意味着没有进展。
+// 多个实例可同时运行：每个批次通过带 updated_at 条件的 UPDATE 认领，只有一个实例会成功。
+func (s *CleanerService) ReapStaleBatches(ctx context.Context, cfg reaperConfig) (int, error) {
+	now := time.Now()
+	var batches []model.ImportBatch
+	err := s.DB.Where("(status = ? AND updated_at < ?) OR (status = ? AND updated_at < ?)",
+		model.BatchStatusProcessing, now.Add(-cfg.StaleAfter),
+		model.BatchStatusIndexing, now.Add(-cfg.IndexingStaleAfter)).
+		Find(&batches).Error
+	if err != nil {
+		return 0, err
+	}
+
+	reaped := 0
+	for i := range batches {
+		batch := &batches[i]
+		loc, err := s.Queue.LocateTask(ctx, batch.ID)
+		if err != nil {
+			// 无法确认任务位置时不做任何处理，避免重复入队
+			return reaped, err
+		}
+
+		action, reason := decideRecovery(batch, loc, cfg, now.Sub(batch.UpdatedAt))
+		if action == reapSkip {
+			continue
+		}
+
+		res := s.DB.Model(&model.ImportBatch{}).
+			Where("id = ? AND status = ? AND updated_at = ?", batch.ID, batch.Status, batch.UpdatedAt).
+			Updates(reapUpdates(action, reason))
+		if res.Error != nil {
+			return reaped, res.Error
+		}
+		if res.RowsAffected == 0 {
+			continue // 已被其他实例认领，或批次恢复了进度
+		}
+		reaped++
+		log.Printf("[Reaper] Batch %d: %s", batch.ID, reason)
+
+		if action == reapRequeue {
+			if err := s.Queue.EnqueueTask(batch.ID, batch.FilePath); err != nil {
+				s.DB.Model(&model.ImportBatch{}).Where("id = ?", batch.ID).
+					Updates(map[string]interface{}{
+						"status": model.BatchStatusFailed,
+						"error":  fmt.Sprintf("%s; re-enqueue failed: %v", reason, err),
+					})
+			}
+		}
+	}
+	return reaped, nil
+}
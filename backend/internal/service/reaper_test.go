@@ -0,0 +1,59 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"etl-tool/internal/model"
+)
+
+func TestDecideRecovery(t *testing.T) {
+	cfg := reaperConfig{Policy: ReaperPolicyRequeue, MaxRecoveries: 2}
+	failCfg := reaperConfig{Policy: ReaperPolicyFail, MaxRecoveries: 2}
+
+	tests := []struct {
+		name     string
+		recovery int
+		loc      TaskLocation
+		cfg      reaperConfig
+		want     reapAction
+	}{
+		{"任务仍在队列中", 0, TaskLocation{Queued: true}, cfg, reapSkip},
+		{"持有者已失联，交给队列回收", 0, TaskLocation{Worker: "w1", Alive: false}, cfg, reapSkip},
+		{"持有者存活但无进展", 0, TaskLocation{Worker: "w1", Alive: true}, cfg, reapFail},
+		{"任务丢失，重新入队", 0, TaskLocation{}, cfg, reapRequeue},
+		{"超过最大恢复次数", 2, TaskLocation{}, cfg, reapFail},
+		{"fail 策略", 0, TaskLocation{}, failCfg, reapFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batch := &model.ImportBatch{ID: 1, Status: model.BatchStatusProcessing, ProcessedRows: 500, RecoveryCount: tt.recovery}
+			got, reason := decideRecovery(batch, tt.loc, tt.cfg, 10*time.Minute)
+			if got != tt.want {
+				t.Fatalf("decideRecovery() = %v (%s), want %v", got, reason, tt.want)
+			}
+			if got == reapSkip {
+				return
+			}
+			if reason == "" {
+				t.Error("Expected a diagnostic reason")
+			}
+			updates := reapUpdates(got, reason)
+			if updates["error"] != reason {
+				t.Errorf("reapUpdates() error = %v, want %q", updates["error"], reason)
+			}
+			wantStatus := model.BatchStatusFailed
+			if got == reapRequeue {
+				wantStatus = model.BatchStatusPending
+				if !strings.Contains(reason, "re-enqueued (recovery 1/2)") {
+					t.Errorf("reason = %q", reason)
+				}
+			}
+			if updates["status"] != wantStatus {
+				t.Errorf("reapUpdates() status = %v, want %s", updates["status"], wantStatus)
+			}
+		})
+	}
+}
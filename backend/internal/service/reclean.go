@@ -0,0 +1,278 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+
+	"etl-tool/internal/model"
+	"etl-tool/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// 重新清洗：规则有误时以修订后的规则集在原批次上重新执行 RuleEngine，记录原地更新，无需重新上传。
+// 未被修改过的记录从原始行（RawData，旧记录回退到源文件）重新清洗；手动修改过（单条编辑或批量修正）的记录默认保留当前值，只按新规则重新校验，
+// override_manual 时同样从源文件重新清洗。变化的记录写入共享操作 ID 的版本，可通过 undo 整体撤销（同时恢复批次规则）。
+
+// valueEditOps 会修改记录值的批量操作，这些操作产生的版本视为手动修改
+var valueEditOps = []string{OpFindReplace, OpRegexReplace, OpSetValue}
+
+// RecleanRequest 重新清洗请求：提交修订后的规则 JSON，或引用规则集的某个版本（默认最新）
+type RecleanRequest struct {
+	Rules          string `json:"rules"`
+	RuleSetID      uint   `json:"rule_set_id"`
+	RuleSetVersion int    `json:"rule_set_version"`
+	OverrideManual bool   `json:"override_manual"` // 为 true 时手动修改也会被源数据覆盖
+	Reason         string `json:"reason"`
+}
+
+// RecleanBatch 校验新规则并创建后台重新清洗操作，批次规则立即切换为新规则
+func (s *CleanerService) RecleanBatch(batchID uint, req RecleanRequest, username string) (*model.BulkOperation, error) {
+	if req.Rules == "" && req.RuleSetID == 0 {
+		return nil, fmt.Errorf("rules or rule_set_id is required")
+	}
+	src, err := s.ResolveRuleSource(req.Rules, req.RuleSetID, req.RuleSetVersion, username)
+	if err != nil {
+		return nil, err
+	}
+	engine, err := loadRuleEngine(src.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules: %w", err)
+	}
+
+	var batch model.ImportBatch
+	if err := s.DB.First(&batch, batchID).Error; err != nil {
+		return nil, err
+	}
+	if err := s.checkBulkAllowed(&batch); err != nil {
+		return nil, err
+	}
+	// 旧记录没有保存原始行，需要从源文件读取
+	var missingRaw int64
+	s.DB.Model(&model.Record{}).Where("batch_id = ? AND (raw_data IS NULL OR raw_data = '')", batchID).Limit(1).Count(&missingRaw)
+	if missingRaw > 0 {
+		if _, err := os.Stat(batch.FilePath); err != nil {
+			return nil, fmt.Errorf("original file is no longer available: %w", err)
+		}
+	}
+
+	previous := batchRuleSource(&batch)
+	params, _ := json.Marshal(BulkParams{RuleSource: src, OverrideManual: req.OverrideManual, Previous: &previous})
+	op := &model.BulkOperation{
+		BatchID:   batchID,
+		Type:      OpReclean,
+		Params:    string(params),
+		Filter:    "{}",
+		Reason:    utils.Truncate(req.Reason, 255),
+		Status:    model.OperationStatusPending,
+		CreatedBy: username,
+	}
+	var total int64
+	s.DB.Model(&model.Record{}).Where("batch_id = ?", batchID).Count(&total)
+	op.Total = int(total)
+
+	err = s.createBulkOperation(op, func(tx *gorm.DB) error {
+		updates := src.batchUpdates()
+		updates["columns"] = schemaFromBatch(&batch, engine).Columns
+		return tx.Model(&batch).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	go s.runBulkOperation(op.ID)
+	return op, nil
+}
+
+// runReclean 按 row_index 顺序分页读取记录；没有 RawData 的记录从源文件顺序读取，两者按行号对齐
+func (s *CleanerService) runReclean(op *model.BulkOperation) error {
+	var params BulkParams
+	if err := json.Unmarshal([]byte(op.Params), &params); err != nil {
+		return err
+	}
+	// 批次原有的规则可能正是需要被替换的无效规则，这里只读取批次本身
+	var batch model.ImportBatch
+	if err := s.DB.First(&batch, op.BatchID).Error; err != nil {
+		return err
+	}
+	engine, err := loadRuleEngine(params.Rules)
+	if err != nil {
+		return err
+	}
+	schema := schemaFromBatch(&batch, engine)
+
+	source, err := s.openRawRowReader(batch.FilePath)
+	if err != nil {
+		return err
+	}
+	defer source.close()
+
+	reason := bulkReason(op)
+	lastRow := 0
+	for {
+		var recs []model.Record
+		if err := s.DB.Where("batch_id = ? AND row_index > ?", op.BatchID, lastRow).
+			Order("row_index asc").Limit(bulkPageSize).Find(&recs).Error; err != nil {
+			return err
+		}
+		if len(recs) == 0 {
+			return source.err()
+		}
+		lastRow = recs[len(recs)-1].RowIndex
+
+		edited := map[uint]bool{}
+		if !params.OverrideManual {
+			if edited, err = s.editedRecords(recs); err != nil {
+				return err
+			}
+		}
+
+		changed := 0
+		err := s.DB.Transaction(func(tx *gorm.DB) error {
+			versions := make([]model.RecordVersion, 0, len(recs))
+			for i := range recs {
+				rec := &recs[i]
+				var next model.Record
+				row, ok := source.row(rec)
+				if edited[rec.ID] || !ok {
+					// 保留当前值（手动修改或源文件中已缺失的行），只按新规则重新校验
+					if edited[rec.ID] {
+						op.Preserved++
+					}
+					var err error
+					if next, err = schema.applyUpdates(rec, nil, engine); err != nil {
+						return err
+					}
+				} else {
+					next = s.createRecordFromRow(row, rec.BatchID, rec.RowIndex, schema, engine)
+					next.ID = rec.ID
+				}
+
+				if reflect.DeepEqual(recordUpdateMap(rec), recordUpdateMap(&next)) {
+					continue
+				}
+				if err := recordScope(tx, rec).Updates(recordUpdateMap(&next)).Error; err != nil {
+					return err
+				}
+				countTransition(op, rec.Status, next.Status)
+				versions = append(versions, newBulkVersion(rec, &next, reason, op.ID))
+			}
+			changed = len(versions)
+			if len(versions) == 0 {
+				return nil
+			}
+			return tx.CreateInBatches(versions, bulkPageSize).Error
+		})
+		if err != nil {
+			return err
+		}
+
+		op.Processed += len(recs)
+		op.Changed += changed
+		s.saveProgress(op)
+	}
+}
+
+// editedRecords 返回一页记录中被手动修改过的记录：存在单条编辑版本，或被修改值的批量操作改动过
+func (s *CleanerService) editedRecords(recs []model.Record) (map[uint]bool, error) {
+	ids := make([]uint, len(recs))
+	for i := range recs {
+		ids[i] = recs[i].ID
+	}
+	var editedIDs []uint
+	err := s.DB.Table("record_versions AS v").
+		Joins("LEFT JOIN bulk_operations AS o ON o.id = v.operation_id").
+		Where("v.record_id IN ? AND (v.operation_id IS NULL OR o.type IN ?)", ids, valueEditOps).
+		Distinct().Pluck("v.record_id", &editedIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	edited := make(map[uint]bool, len(editedIDs))
+	for _, id := range editedIDs {
+		edited[id] = true
+	}
+	return edited, nil
+}
+
+// restoreRecleanRules 撤销 reclean 后将批次规则恢复为重新清洗前的规则
+func (s *CleanerService) restoreRecleanRules(opID uint) {
+	var orig model.BulkOperation
+	if err := s.DB.First(&orig, opID).Error; err != nil || orig.Type != OpReclean {
+		return
+	}
+	var params BulkParams
+	if err := json.Unmarshal([]byte(orig.Params), &params); err != nil || params.Previous == nil {
+		log.Printf("[Bulk] Failed to restore rules of operation %d: %v", opID, err)
+		return
+	}
+	var batch model.ImportBatch
+	if err := s.DB.First(&batch, orig.BatchID).Error; err != nil {
+		return
+	}
+	engine, _ := loadRuleEngine(params.Previous.Rules)
+	updates := params.Previous.batchUpdates()
+	updates["columns"] = schemaFromBatch(&batch, engine).Columns
+	s.DB.Model(&batch).Updates(updates)
+}
+
+// rawRowReader 提供记录的原始行：优先解码 RawData，否则顺序读取源文件，
+// 行号与导入时的 RowIndex 一致（从 1 开始，不含表头）
+type rawRowReader struct {
+	iter utils.RowIterator // 源文件不存在时为 nil
+	pos  int
+	done bool
+}
+
+// openRawRowReader 打开源文件并跳过表头；文件已不存在时只能使用 RawData
+func (s *CleanerService) openRawRowReader(path string) (*rawRowReader, error) {
+	if _, err := os.Stat(path); err != nil {
+		return &rawRowReader{done: true}, nil
+	}
+	iter, err := utils.NewRowIterator(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.readHeader(iter); err != nil {
+		iter.Close()
+		return nil, err
+	}
+	return &rawRowReader{iter: iter}, nil
+}
+
+// row 返回记录的原始行；记录须按 RowIndex 递增的顺序访问
+func (r *rawRowReader) row(rec *model.Record) ([]string, bool) {
+	if row, err := decodeRawRow(rec.RawData); err == nil && row != nil {
+		return row, true
+	}
+	return r.fileRow(rec.RowIndex)
+}
+
+// fileRow 前进到源文件的第 idx 行并返回该行；idx 只能递增
+func (r *rawRowReader) fileRow(idx int) ([]string, bool) {
+	for !r.done && r.pos < idx {
+		if !r.iter.Next() {
+			r.done = true
+			break
+		}
+		r.pos++
+	}
+	if r.pos != idx {
+		return nil, false
+	}
+	return append([]string(nil), r.iter.Row()...), true
+}
+
+func (r *rawRowReader) err() error {
+	if r.iter == nil {
+		return nil
+	}
+	return r.iter.Err()
+}
+
+func (r *rawRowReader) close() {
+	if r.iter != nil {
+		r.iter.Close()
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"etl-tool/internal/model"
+)
+
+func TestRawRowReader_MissingFile(t *testing.T) {
+	r, err := (&CleanerService{}).openRawRowReader(filepath.Join(t.TempDir(), "gone.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.row(&model.Record{RowIndex: 1}); ok {
+		t.Error("row() without RawData and source file should not be found")
+	}
+	if got, ok := r.row(&model.Record{RowIndex: 2, RawData: `["a","b"]`}); !ok || len(got) != 2 {
+		t.Errorf("row() = %v, %v, want RawData", got, ok)
+	}
+}
+
+func TestRawRowReader_AlignsWithRowIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "source.csv")
+	content := "name,phone\n张三, 13800138000 \n李四,123\n王五,13900139000\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := (&CleanerService{}).openRawRowReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.close()
+
+	tests := []struct {
+		idx    int
+		want   []string
+		wantOK bool
+	}{
+		{1, []string{"张三", " 13800138000 "}, true},
+		{3, []string{"王五", "13900139000"}, true}, // 第 2 行的记录带有 RawData，不读取文件
+		{5, nil, false},
+	}
+	stored := &model.Record{RowIndex: 2, RawData: encodeRawRow([]string{"李四", "13700137000"})}
+	if got, ok := r.row(stored); !ok || got[1] != "13700137000" {
+		t.Errorf("row() with RawData = %v, %v", got, ok)
+	}
+	for _, tt := range tests {
+		got, ok := r.row(&model.Record{RowIndex: tt.idx})
+		if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("row(%d) = %v, %v, want %v, %v", tt.idx, got, ok, tt.want, tt.wantOK)
+		}
+	}
+	if err := r.err(); err != nil {
+		t.Errorf("err() = %v", err)
+	}
+}
+
+func TestCountTransition(t *testing.T) {
+	op := &model.BulkOperation{}
+	for _, tr := range [][2]string{
+		{"Error", "Clean"},
+		{"Error", "Clean"},
+		{"Clean", "Error"},
+		{"Clean", "Clean"},
+		{"Error", "Error"},
+	} {
+		countTransition(op, tr[0], tr[1])
+	}
+	if op.ToClean != 2 || op.ToError != 1 {
+		t.Errorf("ToClean = %d, ToError = %d, want 2, 1", op.ToClean, op.ToError)
+	}
+}
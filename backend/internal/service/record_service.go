@@ -2,26 +2,63 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
-	"etl-tool/internal/config"
 	"etl-tool/internal/model"
 
 	"gorm.io/gorm"
 )
 
-// GetRecords 获取批次下的记录，支持过滤、搜索和分页
-func (s *CleanerService) GetRecords(batchID string, filter string, search string, page, pageSize int) ([]model.Record, int64, error) {
-	var records []model.Record
-	search = strings.TrimSpace(search)
+// ErrorFilter 按结构化错误过滤记录，字段为空表示不限制
+type ErrorFilter struct {
+	Code   string `json:"error_code,omitempty"`   // 错误代码，如 required / pattern_mismatch，行级规则为规则名
+	Column string `json:"error_column,omitempty"` // 出错的列
+}
+
+func (f ErrorFilter) empty() bool { return f.Code == "" && f.Column == "" }
+
+// RecordFilter 选择记录的条件，记录列表与批量操作共用
+type RecordFilter struct {
+	Status string `json:"filter,omitempty"` // all / clean / error
+	Search string `json:"search,omitempty"`
+	Column string `json:"column,omitempty"` // 不为空时仅在该列中搜索
+	ErrorFilter
+	Duplicates string `json:"duplicates,omitempty"` // only：仅重复组成员；exclude：排除被判定为重复的记录
+}
 
+// filterRecords 构建批次内符合条件的记录查询
+func (s *CleanerService) filterRecords(batchID interface{}, f RecordFilter) *gorm.DB {
+	search := strings.TrimSpace(f.Search)
 	query := s.DB.Model(&model.Record{}).Where("batch_id = ?", batchID)
-	query = s.applyStatusFilter(query, filter)
-	query = s.applySearchFilter(query, search)
+	query = s.applyStatusFilter(query, f.Status)
+	query = s.applyErrorFilter(query, f.ErrorFilter)
+	switch f.Duplicates {
+	case "only":
+		query = query.Where("dup_group IS NOT NULL")
+	case "exclude":
+		query = query.Where("dup_of IS NULL")
+	}
+	if f.Column != "" && search != "" {
+		return s.applyColumnSearchFilter(query, f.Column, search)
+	}
+	return s.applySearchFilter(query, search)
+}
+
+// GetRecords 获取批次下的记录，支持过滤、搜索和分页
+func (s *CleanerService) GetRecords(batchID string, f RecordFilter, page, pageSize int) ([]model.Record, int64, error) {
+	var records []model.Record
+	query := s.filterRecords(batchID, f)
 
-	total := s.countRecords(query, batchID, filter, search)
+	var total int64
+	if f.ErrorFilter.empty() && f.Duplicates == "" {
+		total = s.countRecords(query, batchID, f.Status, strings.TrimSpace(f.Search))
+	} else {
+		query.Count(&total)
+	}
 
 	offset := (page - 1) * pageSize
 	err := query.Offset(offset).Limit(pageSize).Order("row_index asc").Find(&records).Error
@@ -41,6 +78,22 @@ func (s *CleanerService) applyStatusFilter(query *gorm.DB, filter string) *gorm.
 	}
 }
 
+// applyErrorFilter 按错误代码/列过滤：code 与 column 需出现在同一条错误中（使用分区上的 GIN 索引）
+func (s *CleanerService) applyErrorFilter(query *gorm.DB, f ErrorFilter) *gorm.DB {
+	if f.empty() {
+		return query
+	}
+	cond := map[string]string{}
+	if f.Code != "" {
+		cond["code"] = f.Code
+	}
+	if f.Column != "" {
+		cond["column"] = f.Column
+	}
+	b, _ := json.Marshal([]map[string]string{cond})
+	return query.Where("errors @> ?::jsonb", string(b))
+}
+
 // applySearchFilter 应用搜索条件
 func (s *CleanerService) applySearchFilter(query *gorm.DB, search string) *gorm.DB {
 	if search == "" {
@@ -58,6 +111,11 @@ func (s *CleanerService) applySearchFilter(query *gorm.DB, search string) *gorm.
 	)
 }
 
+// applyColumnSearchFilter 在任意源列（Record.Fields）中按前缀搜索
+func (s *CleanerService) applyColumnSearchFilter(query *gorm.DB, column string, search string) *gorm.DB {
+	return query.Where("fields ->> ? LIKE ?", column, search+"%")
+}
+
 // isNumericSearch 判断是否为纯数字搜索（用于手机号）
 func (s *CleanerService) isNumericSearch(search string) bool {
 	if len(search) < 3 {
@@ -87,6 +145,20 @@ func (s *CleanerService) countRecords(query *gorm.DB, batchID, filter, search st
 	return total
 }
 
+// loadBatchSchema 加载记录所属批次的规则引擎与列结构。
+// 批次保存的规则无效时返回 RuleConfigErrors，绝不退回到空规则重新校验
+func (s *CleanerService) loadBatchSchema(batchID uint) (*model.ImportBatch, *RuleEngine, *batchSchema, error) {
+	var batch model.ImportBatch
+	if err := s.DB.First(&batch, batchID).Error; err != nil {
+		return nil, nil, nil, err
+	}
+	engine, err := loadRuleEngine(batch.Rules)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid cleaning rules for batch %d: %w", batchID, err)
+	}
+	return &batch, engine, schemaFromBatch(&batch, engine), nil
+}
+
 // ValidateRecordUpdate 预先验证更新结果，回显状态变化
 func (s *CleanerService) ValidateRecordUpdate(id string, updates map[string]interface{}) (map[string]interface{}, error) {
 	var record model.Record
@@ -95,64 +167,34 @@ func (s *CleanerService) ValidateRecordUpdate(id string, updates map[string]inte
 	}
 
 	// 获取对应批次的规则
-	var batch model.ImportBatch
-	if err := s.DB.First(&batch, record.BatchID).Error; err != nil {
+	_, engine, schema, err := s.loadBatchSchema(record.BatchID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, fmt.Errorf("could not find batch for validation")
 	}
-
-	engine := NewRuleEngine()
-	if batch.Rules != "" {
-		engine.LoadConfig([]byte(batch.Rules))
-	} else if config.AppConfig != nil && config.AppConfig.CleaningRules != nil {
-		jsonData, _ := json.Marshal(config.AppConfig.CleaningRules)
-		engine.LoadConfig(jsonData)
-	}
-
-	// 准备合并后的数据进行验证
-	newPhone := record.Phone
-	if v, ok := updates["phone"].(string); ok {
-		newPhone = v
-	}
-	newDate := record.Date
-	if v, ok := updates["date"].(string); ok {
-		newDate = v
-	}
-	newName := record.Name
-	if v, ok := updates["name"].(string); ok {
-		newName = v
-	}
-
-	var errors []string
-	cleanName, err := engine.Execute("name", newName)
 	if err != nil {
-		errors = append(errors, fmt.Sprintf("Name: %v", err))
-	}
-	cleanPhone, err := engine.Execute("phone", newPhone)
-	if err != nil {
-		errors = append(errors, fmt.Sprintf("Phone: %v", err))
+		return nil, err
 	}
-	cleanDate, err := engine.Execute("date", newDate)
+
+	// 修改的列执行全部规则，其余列只重新校验
+	next, err := schema.applyUpdates(&record, updates, engine)
 	if err != nil {
-		errors = append(errors, fmt.Sprintf("Date: %v", err))
+		return nil, err
 	}
 
-	newStatus := "Clean"
-	newError := ""
-	if len(errors) > 0 {
-		newStatus = "Error"
-		newError = fmt.Sprintf("%v", errors)
+	cleanedValues := make(map[string]string, len(next.Fields)+3)
+	for k, v := range next.Fields {
+		cleanedValues[k] = v
 	}
+	cleanedValues["name"] = next.Name
+	cleanedValues["phone"] = next.Phone
+	cleanedValues["date"] = next.Date
 
 	return map[string]interface{}{
 		"current_status": record.Status,
-		"new_status":     newStatus,
-		"new_error":      newError,
+		"new_status":     next.Status,
+		"new_error":      next.ErrorMessage,
 		"has_changes":    s.hasChanges(&record, updates),
-		"cleaned_values": map[string]string{
-			"name":  cleanName,
-			"phone": cleanPhone,
-			"date":  cleanDate,
-		},
+		"cleaned_values": cleanedValues,
 	}, nil
 }
 
@@ -172,69 +214,25 @@ func (s *CleanerService) UpdateRecord(id string, updates map[string]interface{},
 	beforeBytes, _ := json.Marshal(record)
 	beforeJSON := string(beforeBytes)
 
-	// 提取并清洗数据，准备同步状态
-	phone := record.Phone
-	if v, ok := updates["phone"].(string); ok {
-		phone = v
-	}
-	date := record.Date
-	if v, ok := updates["date"].(string); ok {
-		date = v
-	}
-	name := record.Name
-	if v, ok := updates["name"].(string); ok {
-		name = v
-	}
-
 	// 获取对应批次的规则
-	var batch model.ImportBatch
-	if err := s.DB.First(&batch, record.BatchID).Error; err != nil {
+	_, engine, schema, err := s.loadBatchSchema(record.BatchID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, fmt.Errorf("could not find batch for rule validation")
 	}
-
-	engine := NewRuleEngine()
-	if batch.Rules != "" {
-		engine.LoadConfig([]byte(batch.Rules))
-	} else if config.AppConfig != nil && config.AppConfig.CleaningRules != nil {
-		jsonData, _ := json.Marshal(config.AppConfig.CleaningRules)
-		engine.LoadConfig(jsonData)
-	}
-
-	// 尝试清洗数据以持久化更好的格式
-	cleanedPhone, phoneErr := engine.Execute("phone", phone)
-	cleanedDate, dateErr := engine.Execute("date", date)
-	cleanedName, nameErr := engine.Execute("name", name)
-
-	// 计算新状态
-	var errors []string
-	if nameErr != nil {
-		errors = append(errors, fmt.Sprintf("Name: %v", nameErr))
-	}
-	if phoneErr != nil {
-		errors = append(errors, fmt.Sprintf("Phone: %v", phoneErr))
-	}
-	if dateErr != nil {
-		errors = append(errors, fmt.Sprintf("Date: %v", dateErr))
+	if err != nil {
+		return nil, err
 	}
 
-	newStatus := "Clean"
-	newError := ""
-	if len(errors) > 0 {
-		newStatus = "Error"
-		newError = fmt.Sprintf("%v", errors)
+	// 合并修改并清洗整行，持久化清洗后的格式与新状态
+	next, err := schema.applyUpdates(&record, updates, engine)
+	if err != nil {
+		return nil, err
 	}
 
-	// 如果清洗成功，使用清洗后的值更新 map 以便存入数据库
-	updates["phone"] = cleanedPhone
-	updates["date"] = cleanedDate
-	updates["name"] = cleanedName
-	updates["status"] = newStatus
-	updates["error_message"] = newError
-
-	// 应用所有更新（包括状态字段）
-	if err := s.DB.Model(&record).Updates(updates).Error; err != nil {
+	if err := s.DB.Model(&record).Updates(recordUpdateMap(&next)).Error; err != nil {
 		return nil, err
 	}
+	s.invalidateAnalytics(record.BatchID)
 
 	// 重新获取更新后的完整记录（包括 ID 和行索引等，以及 GORM 更新后的字段）
 	s.DB.First(&record, "id = ?", id)
@@ -254,6 +252,28 @@ func (s *CleanerService) UpdateRecord(id string, updates map[string]interface{},
 	return &record, nil
 }
 
+// invalidateAnalytics 记录的状态或错误被修改后清除批次的分析缓存，下次查询时重新聚合
+func (s *CleanerService) invalidateAnalytics(batchID uint) {
+	s.DB.Model(&model.ImportBatch{}).Where("id = ?", batchID).Update("analytics", nil)
+}
+
+// recordUpdateMap 生成持久化一条重新清洗后的记录所需的字段
+func recordUpdateMap(rec *model.Record) map[string]interface{} {
+	return map[string]interface{}{
+		"name":          rec.Name,
+		"phone":         rec.Phone,
+		"date":          rec.Date,
+		"address":       rec.Address,
+		"province":      rec.Province,
+		"city":          rec.City,
+		"district":      rec.District,
+		"fields":        rec.Fields,
+		"status":        rec.Status,
+		"error_message": rec.ErrorMessage,
+		"errors":        rec.Errors,
+	}
+}
+
 // hasChanges 检查更新是否会实际修改记录
 func (s *CleanerService) hasChanges(record *model.Record, updates map[string]interface{}) bool {
 	for k, v := range updates {
@@ -283,7 +303,8 @@ func (s *CleanerService) getRecordFieldValue(record *model.Record, field string)
 	case "address":
 		return record.Address
 	default:
-		return ""
+		// 其他列从动态字段中读取
+		return record.Fields[field]
 	}
 }
 
@@ -324,6 +345,7 @@ func (s *CleanerService) RollbackRecord(recordID, versionID string) (*model.Reco
 	if err := s.DB.Model(&record).Updates(updates).Error; err != nil {
 		return nil, err
 	}
+	s.invalidateAnalytics(record.BatchID)
 
 	// 确认更新
 	s.DB.First(&record, "id = ?", recordID)
@@ -365,11 +387,30 @@ func (s *CleanerService) buildRollbackUpdates(targetData map[string]interface{})
 		"province":      targetData["province"],
 		"city":          targetData["city"],
 		"district":      targetData["district"],
+		"address":       targetData["address"],
 		"status":        targetData["status"],
 		"error_message": targetData["error_message"],
 	}
 
-	// 清理空值
+	// 动态字段需转换回 JSONMap 才能写入 JSONB 列
+	if fields, ok := targetData["fields"].(map[string]interface{}); ok {
+		m := make(model.JSONMap, len(fields))
+		for k, v := range fields {
+			m[k] = fmt.Sprintf("%v", v)
+		}
+		updates["fields"] = m
+	}
+
+	// 结构化错误随状态一起恢复；旧版本快照没有 errors 时置空，仅保留 error_message
+	if _, ok := targetData["status"]; ok {
+		var errs model.FieldErrors
+		if raw, err := json.Marshal(targetData["errors"]); err == nil {
+			json.Unmarshal(raw, &errs)
+		}
+		updates["errors"] = errs
+	}
+
+	// 清理空值（errors 为带类型的 nil，会保留下来并写入 NULL）
 	for k, v := range updates {
 		if v == nil {
 			delete(updates, k)
@@ -378,11 +419,29 @@ func (s *CleanerService) buildRollbackUpdates(targetData map[string]interface{})
 	return updates
 }
 
-// GetRecordHistory 获取记录的版本历史
+// GetRecordHistory 获取记录的版本历史，每个版本附带记录的原始行
 func (s *CleanerService) GetRecordHistory(recordID string) ([]model.RecordVersion, error) {
 	var versions []model.RecordVersion
-	err := s.DB.Where("record_id = ?", recordID).Order("changed_at desc").Find(&versions).Error
-	return versions, err
+	if err := s.DB.Where("record_id = ?", recordID).Order("changed_at desc").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return versions, nil
+	}
+
+	var record model.Record
+	if err := s.DB.Select("id", "batch_id", "raw_data").First(&record, "id = ?", recordID).Error; err != nil {
+		return versions, nil // 记录已随批次删除时仍返回历史
+	}
+	raw, err := s.recordRawCells(&record)
+	if err != nil {
+		log.Printf("[History] Failed to decode raw data of record %s: %v", recordID, err)
+		return versions, nil
+	}
+	for i := range versions {
+		versions[i].Raw = raw
+	}
+	return versions, nil
 }
 
 // smartUnmarshal 处理 JSON 和旧版 Go 结构体格式的数据
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"etl-tool/internal/model"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+)
+
+// 行级规则使用 expr 表达式语言（https://expr-lang.org）：只读、无副作用、保证终止，无法访问文件或网络。
+// 表达式中可用的变量：
+//   - 每个源列以表头名出现（如 department）；表头含空格或中文时用 row["入职日期"] 访问
+//   - 逻辑字段 name / phone / date / address 以及解析得到的 province / city / district
+//   - today() 返回 YYYY-MM-DD 格式的当天日期；empty(x) 判断值缺失或仅含空白；age(x) 返回日期 x 至今的周岁
+//
+// 所有值都是清洗后的字符串，引用本批次不存在的列时得到空字符串。示例：
+//
+//	date <= today()
+//	province != "北京市" || city == province
+//	!empty(phone) || !empty(row["email"])
+
+// rowRuleMaxNodes 限制表达式规模，防止配置中出现过大的表达式
+const rowRuleMaxNodes = 500
+
+var rowRuleFunctions = []expr.Option{
+	expr.Function("today", func(params ...any) (any, error) {
+		return time.Now().Format("2006-01-02"), nil
+	}, new(func() string)),
+	expr.Function("empty", func(params ...any) (any, error) {
+		if params[0] == nil {
+			return true, nil
+		}
+		return strings.TrimSpace(fmt.Sprint(params[0])) == "", nil
+	}, new(func(any) bool)),
+	expr.Function("age", func(params ...any) (any, error) {
+		d, err := CleanDate(fmt.Sprint(params[0]))
+		if err != nil {
+			return nil, fmt.Errorf("age: %w", err)
+		}
+		birth, _ := time.Parse("2006-01-02", d)
+		now := time.Now()
+		years := now.Year() - birth.Year()
+		if now.Month() < birth.Month() || (now.Month() == birth.Month() && now.Day() < birth.Day()) {
+			years--
+		}
+		return years, nil
+	}, new(func(any) int)),
+}
+
+// rowRuleParams 行级规则（type: row）的参数
+type rowRuleParams struct {
+	Name    string `json:"name" desc:"规则名，失败时作为错误代码" required:"true"`
+	Expr    string `json:"expr" desc:"返回布尔值的 expr 表达式" required:"true"`
+	Message string `json:"message" desc:"失败时的错误描述"`
+}
+
+// RowRule 行级规则，表达式结果为 false 时该行标记为错误
+type RowRule struct {
+	Name    string
+	Column  string // 规则所在配置项的列名，仅用于展示
+	Expr    string
+	Message string
+	program *vm.Program
+	idents  []string // 表达式引用的变量名
+}
+
+// NewRowRule 编译行级规则，表达式必须返回布尔值
+func NewRowRule(name, column, expression, message string) (*RowRule, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("row rule requires a name")
+	}
+	if strings.TrimSpace(expression) == "" {
+		return nil, fmt.Errorf("row rule %s: expr is required", name)
+	}
+
+	opts := append([]expr.Option{
+		expr.AsBool(),
+		expr.AllowUndefinedVariables(),
+		expr.MaxNodes(rowRuleMaxNodes),
+		expr.DisableBuiltin("date"), // 让 date 指向日期列而不是内置函数
+	}, rowRuleFunctions...)
+	program, err := expr.Compile(expression, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("row rule %s: %w", name, err)
+	}
+
+	return &RowRule{Name: name, Column: column, Expr: expression, Message: message, program: program, idents: exprIdents(program)}, nil
+}
+
+// exprIdents 返回表达式引用的变量名，求值前为缺失的变量补空字符串
+func exprIdents(program *vm.Program) []string {
+	var idents []string
+	ast.Find(program.Node(), func(node ast.Node) bool {
+		if id, ok := node.(*ast.IdentifierNode); ok {
+			idents = append(idents, id.Value)
+		}
+		return false
+	})
+	return idents
+}
+
+// Check 对一行数据求值，不满足时返回以规则名为错误代码的 RuleError
+func (r *RowRule) Check(env map[string]any) *RuleError {
+	for _, id := range r.idents {
+		if _, ok := env[id]; !ok {
+			env[id] = ""
+		}
+	}
+	out, err := expr.Run(r.program, env)
+	if err != nil {
+		return &RuleError{Rule: "row", Code: ErrCodeRowRuleError, Message: fmt.Sprintf("evaluation failed: %v", err)}
+	}
+	if ok, _ := out.(bool); ok {
+		return nil
+	}
+	if r.Message != "" {
+		return &RuleError{Rule: "row", Code: r.Name, Message: r.Message}
+	}
+	return &RuleError{Rule: "row", Code: r.Name, Message: fmt.Sprintf("violated (%s)", r.Expr)}
+}
+
+// ExecuteRowRules 依次执行全部行级规则，返回所有失败的结构化错误
+func (e *RuleEngine) ExecuteRowRules(env map[string]any) model.FieldErrors {
+	var failures model.FieldErrors
+	for _, rule := range e.RowRules {
+		re := rule.Check(env)
+		if re == nil {
+			continue
+		}
+		fe := model.FieldError{Column: rule.Column, Rule: re.Rule, Code: re.Code, Message: re.Message}
+		if v, ok := env[rule.Column].(string); ok {
+			fe.Value = v
+		}
+		// 求值失败时代码不是规则名，在描述中保留规则名以便定位
+		if re.Code == ErrCodeRowRuleError {
+			fe.Message = rule.Name + ": " + fe.Message
+		}
+		failures = append(failures, fe)
+	}
+	return failures
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"etl-tool/internal/utils"
+)
+
+const testRowRules = `[
+	{"column": "date", "rules": [
+		{"type": "date"},
+		{"type": "row", "name": "date_not_future", "expr": "date <= today()", "message": "must not be later than today"}
+	]},
+	{"column": "city", "rules": [
+		{"type": "row", "name": "municipality_city", "expr": "province != \"北京市\" || city == province"}
+	]},
+	{"column": "phone", "rules": [
+		{"type": "row", "name": "phone_or_email", "expr": "!empty(phone) || !empty(row[\"电子邮箱\"])"}
+	]},
+	{"column": "address_province", "rules": [{"type": "address", "comp": "province"}]},
+	{"column": "address_city", "rules": [{"type": "address", "comp": "city"}]}
+]`
+
+func TestRowRules_CreateRecordFromRow(t *testing.T) {
+	header := []string{"name", "phone", "电子邮箱", "join_date", "address"}
+	engine := NewRuleEngine()
+	if err := engine.LoadConfig([]byte(testRowRules)); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	schema := newBatchSchema(header, utils.DetectHeaders(header), nil, engine)
+	s := &CleanerService{}
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+
+	tests := []struct {
+		name     string
+		row      []string
+		wantErrs []string
+	}{
+		{"clean", []string{"张三", "13800138000", "", "2023-01-01", "上海市浦东新区"}, nil},
+		{"future date", []string{"张三", "13800138000", "", tomorrow, "上海市浦东新区"},
+			[]string{"date_not_future: must not be later than today"}},
+		{"email instead of phone", []string{"张三", "", "a@b.com", "2023-01-01", "上海市浦东新区"}, nil},
+		{"no phone nor email", []string{"张三", " ", "", "2023-01-01", "上海市浦东新区"},
+			[]string{"phone_or_email: violated"}},
+		{"municipality ok", []string{"张三", "13800138000", "", "2023-01-01", "北京市朝阳区"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.createRecordFromRow(tt.row, 1, 1, schema, engine)
+			if len(tt.wantErrs) == 0 {
+				if rec.Status != "Clean" {
+					t.Fatalf("Status = %s, ErrorMessage = %s, want Clean", rec.Status, rec.ErrorMessage)
+				}
+				return
+			}
+			if rec.Status != "Error" {
+				t.Fatalf("Status = %s, want Error", rec.Status)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(rec.ErrorMessage, want) {
+					t.Errorf("ErrorMessage = %s, want it to contain %q", rec.ErrorMessage, want)
+				}
+			}
+			if len(rec.Errors) != len(tt.wantErrs) || rec.Errors[0].Rule != "row" {
+				t.Errorf("Errors = %+v, want %d row rule errors", rec.Errors, len(tt.wantErrs))
+			}
+		})
+	}
+}
+
+func TestRowRules_ApplyUpdatesSeesManualLocation(t *testing.T) {
+	header := []string{"name", "phone", "address"}
+	engine := NewRuleEngine()
+	if err := engine.LoadConfig([]byte(testRowRules)); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	schema := newBatchSchema(header, utils.DetectHeaders(header), nil, engine)
+	s := &CleanerService{}
+
+	rec := s.createRecordFromRow([]string{"张三", "13800138000", "北京市朝阳区"}, 1, 1, schema, engine)
+	if rec.Status != "Clean" {
+		t.Fatalf("Expected Clean, got %s: %s", rec.Status, rec.ErrorMessage)
+	}
+
+	next, err := schema.applyUpdates(&rec, map[string]interface{}{"city": "朝阳市"}, engine)
+	if err != nil {
+		t.Fatalf("applyUpdates() error = %v", err)
+	}
+	if next.Status != "Error" || !strings.Contains(next.ErrorMessage, "municipality_city") {
+		t.Errorf("Expected municipality_city failure, got %s: %s", next.Status, next.ErrorMessage)
+	}
+}
+
+func TestRowRules_LoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"missing name", `[{"column": "date", "rules": [{"type": "row", "expr": "true"}]}]`},
+		{"missing expr", `[{"column": "date", "rules": [{"type": "row", "name": "r"}]}]`},
+		{"syntax error", `[{"column": "date", "rules": [{"type": "row", "name": "r", "expr": "date <="}]}]`},
+		{"not boolean", `[{"column": "date", "rules": [{"type": "row", "name": "r", "expr": "1 + 2"}]}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewRuleEngine().LoadConfig([]byte(tt.config)); err == nil {
+				t.Error("LoadConfig() expected error")
+			}
+		})
+	}
+}
@@ -2,9 +2,12 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
+
+	"etl-tool/internal/config"
 )
 
 // DefaultRuleConfigs 定义了系统内置的默认规则。
@@ -12,92 +15,69 @@ import (
 var DefaultRuleConfigs = []RuleConfig{
 	{
 		Column: "phone",
-		Rules: []struct {
-			Type    string      `json:"type"`
-			Pattern string      `json:"pattern,omitempty"`
-			Min     int         `json:"min,omitempty"`
-			Max     int         `json:"max,omitempty"`
-			Old     interface{} `json:"old,omitempty"`
-			New     interface{} `json:"new,omitempty"`
-			Comp    string      `json:"comp,omitempty"`
-		}{
-			{Type: "replace", Old: " ", New: ""},
-			{Type: "regex", Pattern: `^1[3-9]\d{9}$`},
+		Rules: []RuleSpec{
+			ruleSpec("replace", `{"old": " ", "new": ""}`),
+			ruleSpec("regex", `{"pattern": "^1[3-9]\\d{9}$"}`),
 		},
 	},
 	{
 		Column: "name",
-		Rules: []struct {
-			Type    string      `json:"type"`
-			Pattern string      `json:"pattern,omitempty"`
-			Min     int         `json:"min,omitempty"`
-			Max     int         `json:"max,omitempty"`
-			Old     interface{} `json:"old,omitempty"`
-			New     interface{} `json:"new,omitempty"`
-			Comp    string      `json:"comp,omitempty"`
-		}{
-			{Type: "required"},
-			{Type: "length", Min: 2, Max: 20},
+		Rules: []RuleSpec{
+			ruleSpec("required", ""),
+			ruleSpec("length", `{"min": 2, "max": 20}`),
 		},
 	},
 	{
 		Column: "date",
-		Rules: []struct {
-			Type    string      `json:"type"`
-			Pattern string      `json:"pattern,omitempty"`
-			Min     int         `json:"min,omitempty"`
-			Max     int         `json:"max,omitempty"`
-			Old     interface{} `json:"old,omitempty"`
-			New     interface{} `json:"new,omitempty"`
-			Comp    string      `json:"comp,omitempty"`
-		}{
-			{Type: "date"},
+		Rules: []RuleSpec{
+			ruleSpec("date", ""),
 		},
 	},
 	{
 		Column: "address_province",
-		Rules: []struct {
-			Type    string      `json:"type"`
-			Pattern string      `json:"pattern,omitempty"`
-			Min     int         `json:"min,omitempty"`
-			Max     int         `json:"max,omitempty"`
-			Old     interface{} `json:"old,omitempty"`
-			New     interface{} `json:"new,omitempty"`
-			Comp    string      `json:"comp,omitempty"`
-		}{
-			{Type: "address", Comp: "province"},
+		Rules: []RuleSpec{
+			ruleSpec("address", `{"comp": "province"}`),
 		},
 	},
 	{
 		Column: "address_city",
-		Rules: []struct {
-			Type    string      `json:"type"`
-			Pattern string      `json:"pattern,omitempty"`
-			Min     int         `json:"min,omitempty"`
-			Max     int         `json:"max,omitempty"`
-			Old     interface{} `json:"old,omitempty"`
-			New     interface{} `json:"new,omitempty"`
-			Comp    string      `json:"comp,omitempty"`
-		}{
-			{Type: "address", Comp: "city"},
+		Rules: []RuleSpec{
+			ruleSpec("address", `{"comp": "city"}`),
 		},
 	},
 	{
 		Column: "address_district",
-		Rules: []struct {
-			Type    string      `json:"type"`
-			Pattern string      `json:"pattern,omitempty"`
-			Min     int         `json:"min,omitempty"`
-			Max     int         `json:"max,omitempty"`
-			Old     interface{} `json:"old,omitempty"`
-			New     interface{} `json:"new,omitempty"`
-			Comp    string      `json:"comp,omitempty"`
-		}{
-			{Type: "address", Comp: "district"},
+		Rules: []RuleSpec{
+			ruleSpec("address", `{"comp": "district"}`),
 		},
 	},
 }
 
+// 错误代码：写入 Record.Errors，供过滤与前端本地化使用，发布后不应再修改
+const (
+	ErrCodeRequired     = "required"
+	ErrCodePattern      = "pattern_mismatch"
+	ErrCodeTooShort     = "too_short"
+	ErrCodeTooLong      = "too_long"
+	ErrCodeInvalidDate  = "invalid_date"
+	ErrCodeRowRuleError = "row_rule_error" // 行级规则求值失败（规则本身未通过时代码为规则名）
+	ErrCodeDBRejected   = "db_rejected"
+	ErrCodeInvalid      = "invalid" // 未分类的策略错误
+)
+
+// RuleError 策略校验失败的结构化描述。Error() 只返回描述，保持原有错误信息的格式
+type RuleError struct {
+	Rule    string // 策略类型，由 RuleEngine 在执行时填充
+	Code    string
+	Message string
+}
+
+func (e *RuleError) Error() string { return e.Message }
+
+func ruleError(code, format string, args ...interface{}) *RuleError {
+	return &RuleError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
 // CleaningStrategy 定义了数据清洗和校验的通用接口
 type CleaningStrategy interface {
 	// Clean 执行清洗/校验逻辑。返回清洗后的字符串或错误。
@@ -106,6 +86,17 @@ type CleaningStrategy interface {
 	GetType() string
 }
 
+// IdempotentStrategy 可选接口：Idempotent 为 false 的策略再次作用于已清洗的值时结果会变化（如 script），
+// Revalidate 跳过这些策略。未实现该接口的策略视为幂等
+type IdempotentStrategy interface {
+	Idempotent() bool
+}
+
+func isIdempotent(s CleaningStrategy) bool {
+	is, ok := s.(IdempotentStrategy)
+	return !ok || is.Idempotent()
+}
+
 // RegexStrategy 基于正则表达式的清洗策略
 type RegexStrategy struct {
 	Pattern string
@@ -122,7 +113,7 @@ func NewRegexStrategy(pattern string) (*RegexStrategy, error) {
 
 func (s *RegexStrategy) Clean(input string) (string, error) {
 	if !s.regex.MatchString(input) {
-		return input, fmt.Errorf("does not match pattern: %s", s.Pattern)
+		return input, ruleError(ErrCodePattern, "does not match pattern: %s", s.Pattern)
 	}
 	return input, nil
 }
@@ -138,10 +129,10 @@ type LengthStrategy struct {
 func (s *LengthStrategy) Clean(input string) (string, error) {
 	l := len(input)
 	if s.Min > 0 && l < s.Min {
-		return input, fmt.Errorf("too short: min %d", s.Min)
+		return input, ruleError(ErrCodeTooShort, "too short: min %d", s.Min)
 	}
 	if s.Max > 0 && l > s.Max {
-		return input, fmt.Errorf("too long: max %d", s.Max)
+		return input, ruleError(ErrCodeTooLong, "too long: max %d", s.Max)
 	}
 	return input, nil
 }
@@ -153,7 +144,7 @@ type RequiredStrategy struct{}
 
 func (s *RequiredStrategy) Clean(input string) (string, error) {
 	if input == "" {
-		return "", fmt.Errorf("is required")
+		return "", ruleError(ErrCodeRequired, "is required")
 	}
 	return input, nil
 }
@@ -172,31 +163,27 @@ func (s *ReplaceStrategy) Clean(input string) (string, error) {
 
 func (s *ReplaceStrategy) GetType() string { return "replace" }
 
-// DateStrategy 日期规范化策略
-type DateStrategy struct{}
+// Idempotent 替换结果中仍含有 Old 时再次替换会继续变化
+func (s *ReplaceStrategy) Idempotent() bool { return !strings.Contains(s.New, s.Old) }
 
-func (s *DateStrategy) Clean(input string) (string, error) {
-	return CleanDate(input) // 复用现有的高性能 CleanDate 逻辑
-}
-
-func (s *DateStrategy) GetType() string { return "date" }
-
-// AddressStrategy 地址解析策略
+// AddressStrategy 地址解析策略：按行政区划表提取省 / 市 / 区或区划代码，省市区不一致时返回 address_mismatch
 type AddressStrategy struct {
-	Component string // "province", "city", or "district"
+	Component string // "province", "city", "district" or "code"
 }
 
 func (s *AddressStrategy) Clean(input string) (string, error) {
-	p, c, d := ExtractAddress(input)
+	parts, err := ParseAddress(input)
 	switch s.Component {
 	case "province":
-		return p, nil
+		return parts.Province, err
 	case "city":
-		return c, nil
+		return parts.City, err
 	case "district":
-		return d, nil
+		return parts.District, err
+	case "code":
+		return parts.Code, err
 	default:
-		return input, nil
+		return input, err
 	}
 }
 
@@ -205,6 +192,9 @@ func (s *AddressStrategy) GetType() string { return "address" }
 // RuleEngine 规则引擎，管理一组策略并执行
 type RuleEngine struct {
 	ColumnRules map[string][]CleaningStrategy
+	RowRules    []*RowRule // 行级规则，在所有列清洗完成后按配置顺序执行
+
+	RowStrategies []ColumnRowStrategy // 行作用域的列策略，在列规则之后、行级规则之前按配置顺序执行
 }
 
 func NewRuleEngine() *RuleEngine {
@@ -215,61 +205,237 @@ func NewRuleEngine() *RuleEngine {
 
 // RuleConfig 定义了 JSON 配置文件中的单条规则结构
 type RuleConfig struct {
-	Column string `json:"column"`
-	Rules  []struct {
-		Type    string      `json:"type"`
-		Pattern string      `json:"pattern,omitempty"`
-		Min     int         `json:"min,omitempty"`
-		Max     int         `json:"max,omitempty"`
-		Old     interface{} `json:"old,omitempty"`
-		New     interface{} `json:"new,omitempty"`
-		Comp    string      `json:"comp,omitempty"`
-	} `json:"rules"`
-}
-
-// LoadConfig 从 JSON 数据加载规则
+	Column string     `json:"column"`
+	Rules  []RuleSpec `json:"rules"`
+}
+
+// RuleSpec 单个策略的配置：type 选择注册表中的策略，其余参数保留为原始 JSON，由策略自行解码。
+// type 为 row 时是行级规则，使用 name/expr/message，可引用同一行的其他列
+type RuleSpec struct {
+	Type   string
+	Params json.RawMessage // 完整的规则对象（含 type）
+}
+
+// ruleSpec 以 JSON 字面量构造规则，用于内置默认规则
+func ruleSpec(typ, params string) RuleSpec {
+	return RuleSpec{Type: typ, Params: json.RawMessage(params)}
+}
+
+func (r *RuleSpec) UnmarshalJSON(data []byte) error {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return err
+	}
+	r.Type = head.Type
+	r.Params = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+func (r RuleSpec) MarshalJSON() ([]byte, error) {
+	params := map[string]json.RawMessage{}
+	if len(r.Params) > 0 {
+		if err := json.Unmarshal(r.Params, &params); err != nil {
+			return nil, err
+		}
+	}
+	params["type"], _ = json.Marshal(r.Type)
+	return json.Marshal(params)
+}
+
+// RuleConfigError 规则文档中的一处错误，Path 定位到出错的参数（如 $[0].rules[1].pattern）
+type RuleConfigError struct {
+	Path    string `json:"path"`
+	Column  string `json:"column,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Field   string `json:"field,omitempty"` // 出错的参数，如 column/type/pattern/min/name/expr
+	Message string `json:"message"`
+}
+
+func (e RuleConfigError) Error() string { return e.Path + ": " + e.Message }
+
+// RuleConfigErrors 规则文档中的全部错误
+type RuleConfigErrors []RuleConfigError
+
+func (e RuleConfigErrors) Error() string {
+	parts := make([]string, len(e))
+	for i, err := range e {
+		parts[i] = err.Error()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// 内置策略的参数
+type (
+	regexParams struct {
+		Pattern string `json:"pattern" desc:"正则表达式（RE2 语法），值必须匹配" required:"true"`
+	}
+	lengthParams struct {
+		Min int `json:"min" desc:"最小长度（字节），0 表示不限"`
+		Max int `json:"max" desc:"最大长度（字节），0 表示不限"`
+	}
+	replaceParams struct {
+		Old interface{} `json:"old" desc:"要替换的文本" required:"true"`
+		New interface{} `json:"new" desc:"替换为的文本，默认删除"`
+	}
+	addressParams struct {
+		Comp string `json:"comp" desc:"提取的地址部分（code 为最具体一级的行政区划代码）" enum:"province,city,district,code" required:"true"`
+	}
+	noParams struct{}
+)
+
+func init() {
+	RegisterStrategy("required", "非空校验", func(noParams) (CleaningStrategy, error) {
+		return &RequiredStrategy{}, nil
+	})
+	RegisterStrategy("regex", "正则表达式校验", func(p regexParams) (CleaningStrategy, error) {
+		s, err := NewRegexStrategy(p.Pattern)
+		if err != nil {
+			return nil, NewParamError("pattern", "invalid regular expression: %v", err)
+		}
+		return s, nil
+	})
+	RegisterStrategy("length", "长度校验", func(p lengthParams) (CleaningStrategy, error) {
+		switch {
+		case p.Min < 0:
+			return nil, NewParamError("min", "min must not be negative")
+		case p.Max < 0:
+			return nil, NewParamError("max", "max must not be negative")
+		case p.Max > 0 && p.Min > p.Max:
+			return nil, NewParamError("min", "min (%d) must not be greater than max (%d)", p.Min, p.Max)
+		}
+		return &LengthStrategy{Min: p.Min, Max: p.Max}, nil
+	})
+	RegisterStrategy("replace", "文本替换", func(p replaceParams) (CleaningStrategy, error) {
+		if fmt.Sprintf("%v", p.Old) == "" {
+			return nil, NewParamError("old", "old is required")
+		}
+		s := &ReplaceStrategy{Old: fmt.Sprintf("%v", p.Old)}
+		if p.New != nil {
+			s.New = fmt.Sprintf("%v", p.New)
+		}
+		return s, nil
+	})
+	RegisterStrategy("address", "从地址中提取省 / 市 / 区或行政区划代码", func(p addressParams) (CleaningStrategy, error) {
+		return &AddressStrategy{Component: p.Comp}, nil
+	})
+}
+
+// LoadConfig 从 JSON 数据加载规则。文档中的全部错误以 RuleConfigErrors 返回，有错误时引擎保持不变
 func (e *RuleEngine) LoadConfig(jsonData []byte) error {
 	var configs []RuleConfig
 	if err := json.Unmarshal(jsonData, &configs); err != nil {
-		return err
+		return RuleConfigErrors{{Path: "$", Message: fmt.Sprintf("invalid rules JSON: %v", err)}}
 	}
 
-	for _, cfg := range configs {
+	columnRules := make(map[string][]CleaningStrategy, len(configs))
+	var rowRules []*RowRule
+	var rowStrategies []ColumnRowStrategy
+	var errs RuleConfigErrors
+	for i, cfg := range configs {
+		if strings.TrimSpace(cfg.Column) == "" {
+			errs = append(errs, RuleConfigError{Path: fmt.Sprintf("$[%d].column", i), Field: "column", Message: "column is required"})
+			continue
+		}
+
 		var strategies []CleaningStrategy
-		for _, r := range cfg.Rules {
-			var s CleaningStrategy
-			var err error
-
-			switch r.Type {
-			case "required":
-				s = &RequiredStrategy{}
-			case "regex":
-				s, err = NewRegexStrategy(r.Pattern)
-			case "length":
-				s = &LengthStrategy{Min: r.Min, Max: r.Max}
-			case "replace":
-				s = &ReplaceStrategy{
-					Old: fmt.Sprintf("%v", r.Old),
-					New: fmt.Sprintf("%v", r.New),
+		rowRuleCount := 0
+		for j, r := range cfg.Rules {
+			fail := func(field, message string) {
+				path := fmt.Sprintf("$[%d].rules[%d]", i, j)
+				if field != "" {
+					path += "." + field
 				}
-			case "date":
-				s = &DateStrategy{}
-			case "address":
-				s = &AddressStrategy{Component: r.Comp}
-			default:
-				return fmt.Errorf("unknown strategy type: %s", r.Type)
+				errs = append(errs, RuleConfigError{
+					Path:    path,
+					Column:  cfg.Column,
+					Type:    r.Type,
+					Field:   field,
+					Message: message,
+				})
 			}
 
+			if r.Type == "row" {
+				var p rowRuleParams
+				if err := decodeParams(r.Params, &p); err != nil {
+					var pe *ParamError
+					if errors.As(err, &pe) {
+						fail(pe.Field, pe.Message)
+					} else {
+						fail("", err.Error())
+					}
+					continue
+				}
+				rule, err := NewRowRule(p.Name, cfg.Column, p.Expr, p.Message)
+				if err != nil {
+					fail("expr", err.Error())
+					continue
+				}
+				rowRules = append(rowRules, rule)
+				rowRuleCount++
+				continue
+			}
+
+			s, err := newStrategy(r)
 			if err != nil {
-				return err
+				var pe *ParamError
+				if errors.As(err, &pe) {
+					fail(pe.Field, pe.Message)
+				} else {
+					fail("", err.Error())
+				}
+				continue
+			}
+			if rs, ok := s.(RowStrategy); ok {
+				rowStrategies = append(rowStrategies, ColumnRowStrategy{Column: cfg.Column, Strategy: rs})
+				rowRuleCount++
+				continue
 			}
 			strategies = append(strategies, s)
 		}
-		e.ColumnRules[strings.ToLower(cfg.Column)] = strategies
+		// 只含行级规则（或行作用域策略）的配置不注册列策略，避免遮蔽逻辑字段的回退规则
+		if rowRuleCount > 0 && len(strategies) == 0 {
+			continue
+		}
+		columnRules[strings.ToLower(cfg.Column)] = strategies
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	for col, strategies := range columnRules {
+		e.ColumnRules[col] = strategies
 	}
+	e.RowRules = append(e.RowRules, rowRules...)
+	e.RowStrategies = append(e.RowStrategies, rowStrategies...)
 	return nil
 }
 
+// ValidateRules 校验提交的规则文档，空文档表示使用默认规则
+func ValidateRules(rules string) error {
+	if strings.TrimSpace(rules) == "" {
+		return nil
+	}
+	return NewRuleEngine().LoadConfig([]byte(rules))
+}
+
+// loadRuleEngine 根据批次规则创建引擎；未提供规则时回退到全局默认规则
+func loadRuleEngine(rules string) (*RuleEngine, error) {
+	engine := NewRuleEngine()
+	if rules != "" {
+		return engine, engine.LoadConfig([]byte(rules))
+	}
+	if config.AppConfig != nil && config.AppConfig.CleaningRules != nil {
+		jsonData, err := json.Marshal(config.AppConfig.CleaningRules)
+		if err != nil {
+			return engine, err
+		}
+		return engine, engine.LoadConfig(jsonData)
+	}
+	return engine, nil
+}
+
 // GetSuggestedRules 根据提供的 headers 返回建议的规则。
 func GetSuggestedRules(headers []string) []RuleConfig {
 	var suggestions []RuleConfig
@@ -326,8 +492,34 @@ func GetSuggestedRules(headers []string) []RuleConfig {
 	return suggestions
 }
 
+// HasRules 判断指定列是否配置了规则
+func (e *RuleEngine) HasRules(columnName string) bool {
+	_, ok := e.ColumnRules[strings.ToLower(columnName)]
+	return ok
+}
+
+// TypesFor 返回指定列配置的策略类型列表
+func (e *RuleEngine) TypesFor(columnName string) []string {
+	strategies := e.ColumnRules[strings.ToLower(columnName)]
+	types := make([]string, 0, len(strategies))
+	for _, st := range strategies {
+		types = append(types, st.GetType())
+	}
+	return types
+}
+
 // Execute 对指定列的数据运行所有定义的策略
 func (e *RuleEngine) Execute(columnName string, input string) (string, error) {
+	return e.execute(columnName, input, false)
+}
+
+// Revalidate 对已清洗的值重新运行列策略，跳过非幂等的策略（见 IdempotentStrategy），
+// 用于修改、合并记录时未经用户输入的列，避免脚本等转换重复生效
+func (e *RuleEngine) Revalidate(columnName string, input string) (string, error) {
+	return e.execute(columnName, input, true)
+}
+
+func (e *RuleEngine) execute(columnName string, input string, cleaned bool) (string, error) {
 	strategies, ok := e.ColumnRules[strings.ToLower(columnName)]
 	if !ok {
 		// log.Printf("[RuleEngine] No rules for column: %s", columnName)
@@ -336,12 +528,25 @@ func (e *RuleEngine) Execute(columnName string, input string) (string, error) {
 
 	currentValue := input
 	for _, strategy := range strategies {
+		if cleaned && !isIdempotent(strategy) {
+			continue
+		}
 		var err error
 		currentValue, err = strategy.Clean(currentValue)
 		if err != nil {
-			return currentValue, err
+			return currentValue, asRuleError(strategy.GetType(), err)
 		}
 	}
 
 	return currentValue, nil
 }
+
+// asRuleError 为策略错误补充策略类型，非 RuleError 的错误归为 ErrCodeInvalid
+func asRuleError(rule string, err error) *RuleError {
+	re := &RuleError{Rule: rule, Code: ErrCodeInvalid, Message: err.Error()}
+	var src *RuleError
+	if errors.As(err, &src) {
+		re.Code = src.Code
+	}
+	return re
+}
@@ -1,7 +1,10 @@
 package service
 
 import (
+	"errors"
 	"testing"
+
+	"etl-tool/internal/utils"
 )
 
 func TestRuleEngine_Execute(t *testing.T) {
@@ -83,3 +86,286 @@ func TestRuleEngine_AddressStrategy(t *testing.T) {
 		t.Errorf("Expected 上海市 (for municipality), got %s", city)
 	}
 }
+
+func TestRuleEngine_LoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		wantPath  string
+		wantField string
+	}{
+		{"invalid json", `[{"column": "phone"`, "$", ""},
+		{"missing column", `[{"rules": [{"type": "required"}]}]`, "$[0].column", "column"},
+		{"unknown type", `[{"column": "phone", "rules": [{"type": "regexp", "pattern": "^1"}]}]`, "$[0].rules[0].type", "type"},
+		{"missing type", `[{"column": "phone", "rules": [{"pattern": "^1"}]}]`, "$[0].rules[0].type", "type"},
+		{"bad regex", `[{"column": "phone", "rules": [{"type": "required"}, {"type": "regex", "pattern": "^1[3-9"}]}]`, "$[0].rules[1].pattern", "pattern"},
+		{"min greater than max", `[{"column": "name", "rules": [{"type": "length", "min": 10, "max": 2}]}]`, "$[0].rules[0].min", "min"},
+		{"negative max", `[{"column": "name", "rules": [{"type": "length", "max": -1}]}]`, "$[0].rules[0].max", "max"},
+		{"unknown address comp", `[{"column": "addr", "rules": [{"type": "address", "comp": "street"}]}]`, "$[0].rules[0].comp", "comp"},
+		{"replace without old", `[{"column": "phone", "rules": [{"type": "replace", "new": "-"}]}]`, "$[0].rules[0].old", "old"},
+		{"unknown case", `[{"column": "code", "rules": [{"type": "case", "case": "title"}]}]`, "$[0].rules[0].case", "case"},
+		{"empty enum", `[{"column": "dept", "rules": [{"type": "enum"}]}]`, "$[0].rules[0].values", "values"},
+		{"number min greater than max", `[{"column": "age", "rules": [{"type": "number", "min": 65, "max": 16}]}]`, "$[0].rules[0].min", "min"},
+		{"fractional length", `[{"column": "name", "rules": [{"type": "length", "min": 1.5}]}]`, "$[0].rules[0].min", "min"},
+		{"unknown idcard extract", `[{"column": "id", "rules": [{"type": "idcard", "extract": "age"}]}]`, "$[0].rules[0].extract", "extract"},
+		{"idcard extract without source", `[{"column": "birthdate", "rules": [{"type": "idcard", "extract": "birthdate"}]}]`, "$[0].rules[0].source", "source"},
+		{"row rule without expr", `[{"column": "phone", "rules": [{"type": "row", "name": "check"}]}]`, "$[0].rules[0].expr", "expr"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRules(tt.config)
+			var errs RuleConfigErrors
+			if !errors.As(err, &errs) || len(errs) != 1 {
+				t.Fatalf("ValidateRules() error = %v, want one RuleConfigError", err)
+			}
+			if errs[0].Path != tt.wantPath || errs[0].Field != tt.wantField {
+				t.Errorf("got path %q field %q, want %q %q", errs[0].Path, errs[0].Field, tt.wantPath, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestRuleEngine_LoadConfigAllOrNothing(t *testing.T) {
+	config := `[
+		{"column": "phone", "rules": [{"type": "regex", "pattern": "^1\\d{10}$"}]},
+		{"column": "name", "rules": [{"type": "length", "min": 5, "max": 1}]},
+		{"column": "city", "rules": [{"type": "address", "comp": "town"}]}
+	]`
+
+	engine := NewRuleEngine()
+	err := engine.LoadConfig([]byte(config))
+	var errs RuleConfigErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("LoadConfig() error = %v, want 2 errors", err)
+	}
+	if len(engine.ColumnRules) != 0 || len(engine.RowRules) != 0 {
+		t.Errorf("engine changed after failed load: %d column rules, %d row rules", len(engine.ColumnRules), len(engine.RowRules))
+	}
+
+	if err := ValidateRules(""); err != nil {
+		t.Errorf("ValidateRules(\"\") = %v, want nil", err)
+	}
+}
+
+func TestRuleEngine_TextStrategies(t *testing.T) {
+	config := `[
+		{"column": "code", "rules": [{"type": "halfwidth"}, {"type": "trim"}, {"type": "case", "case": "upper"}]},
+		{"column": "title", "rules": [{"type": "nfkc"}, {"type": "case"}]},
+		{"column": "name", "rules": [{"type": "trim"}, {"type": "required"}]}
+	]`
+
+	engine := NewRuleEngine()
+	if err := engine.LoadConfig([]byte(config)); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	tests := []struct {
+		column   string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"code", "　ａｂ－１２３　", "AB-123", false},
+		{"code", "张三ＡＢ", "张三AB", false},
+		{"title", "Ｍａｎａｇｅｒ①", "manager1", false},
+		{"title", "㎏", "kg", false},
+		{"name", " \u200b张三　", "张三", false},
+		{"name", "　　", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := engine.Execute(tt.column, tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Execute(%s, %q) error = %v, wantErr %v", tt.column, tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("Execute(%s, %q) = %q, want %q", tt.column, tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestRuleEngine_ValidationStrategies(t *testing.T) {
+	config := `[
+		{"column": "gender", "rules": [{"type": "enum", "values": ["男", "女"], "map": {"M": "男", "F": "女"}, "ignore_case": true}]},
+		{"column": "dept", "rules": [{"type": "enum", "values": ["HR", "IT"]}]},
+		{"column": "age", "rules": [{"type": "number", "min": 16, "max": 65}]},
+		{"column": "salary", "rules": [{"type": "number", "min": 0}]},
+		{"column": "email", "rules": [{"type": "trim"}, {"type": "email"}]}
+	]`
+
+	engine := NewRuleEngine()
+	if err := engine.LoadConfig([]byte(config)); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	tests := []struct {
+		column   string
+		input    string
+		expected string
+		wantCode string // 空表示通过
+	}{
+		{"gender", "女", "女", ""},
+		{"gender", "m", "男", ""},
+		{"gender", "未知", "未知", ErrCodeNotInEnum},
+		{"gender", "", "", ""},
+		{"dept", "it", "it", ErrCodeNotInEnum},
+		{"dept", "IT", "IT", ""},
+		{"age", "30", "30", ""},
+		{"age", "15", "15", ErrCodeTooSmall},
+		{"age", "65.5", "65.5", ErrCodeTooLarge},
+		{"age", "三十", "三十", ErrCodeNotNumber},
+		{"salary", "12,500.50", "12500.5", ""},
+		{"salary", "-1", "-1", ErrCodeTooSmall},
+		{"salary", "NaN", "NaN", ErrCodeNotNumber},
+		{"email", " Zhang.San@Example.COM ", "Zhang.San@example.com", ""},
+		{"email", "zhangsan@localhost", "zhangsan@localhost", ErrCodeInvalidEmail},
+		{"email", "Zhang San <zs@example.com>", "Zhang San <zs@example.com>", ErrCodeInvalidEmail},
+		{"email", "zs.example.com", "zs.example.com", ErrCodeInvalidEmail},
+	}
+
+	for _, tt := range tests {
+		got, err := engine.Execute(tt.column, tt.input)
+		code := ""
+		var re *RuleError
+		if errors.As(err, &re) {
+			code = re.Code
+		}
+		if code != tt.wantCode {
+			t.Errorf("Execute(%s, %q) code = %q, want %q (err %v)", tt.column, tt.input, code, tt.wantCode, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("Execute(%s, %q) = %q, want %q", tt.column, tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestParseIDCard(t *testing.T) {
+	tests := []struct {
+		input     string
+		number    string
+		birthdate string
+		gender    string
+		wantCode  string
+	}{
+		{"11010519491231002X", "11010519491231002X", "1949-12-31", "女", ""},
+		{"11010519491231002x", "11010519491231002X", "1949-12-31", "女", ""},
+		{"440524188001010014", "440524188001010014", "", "", ErrCodeInvalidIDCard}, // 1900 年以前
+		{"110105194912310021", "", "", "", ErrCodeIDChecksum},
+		{"110105194902300027", "", "", "", ErrCodeInvalidIDCard}, // 2 月 30 日
+		{"11010519491231002", "", "", "", ErrCodeInvalidIDCard},
+		{"1101051949123100AX", "", "", "", ErrCodeInvalidIDCard},
+		{"11010519491231002Y", "", "", "", ErrCodeInvalidIDCard},
+	}
+
+	for _, tt := range tests {
+		info, err := ParseIDCard(tt.input)
+		code := ""
+		var re *RuleError
+		if errors.As(err, &re) {
+			code = re.Code
+		}
+		if code != tt.wantCode {
+			t.Errorf("ParseIDCard(%s) code = %q, want %q (err %v)", tt.input, code, tt.wantCode, err)
+			continue
+		}
+		if tt.wantCode == "" && (info.Number != tt.number || info.Birthdate != tt.birthdate || info.Gender != tt.gender) {
+			t.Errorf("ParseIDCard(%s) = %+v", tt.input, info)
+		}
+	}
+}
+
+func TestRuleEngine_IDCardStrategy(t *testing.T) {
+	config := `[
+		{"column": "id", "rules": [{"type": "halfwidth"}, {"type": "idcard"}]}
+	]`
+
+	engine := NewRuleEngine()
+	if err := engine.LoadConfig([]byte(config)); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"１１０１０５１９４９１２３１００２ｘ", "11010519491231002X", false},
+		{"110105194912310021", "110105194912310021", true},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		got, err := engine.Execute("id", tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Execute(id, %s) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("Execute(id, %s) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestRuleEngine_IDCardExtractDerivedColumns(t *testing.T) {
+	engine := NewRuleEngine()
+	if err := engine.LoadConfig([]byte(`[
+		{"column": "身份证号", "rules": [{"type": "halfwidth"}, {"type": "idcard"}]},
+		{"column": "birthdate", "rules": [{"type": "idcard", "source": "身份证号", "extract": "birthdate"}]},
+		{"column": "性别", "rules": [{"type": "idcard", "source": "身份证号", "extract": "gender"}]}
+	]`)); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	header := []string{"姓名", "身份证号", "性别"}
+	schema := newBatchSchema(header, utils.DetectHeaders(header), nil, engine)
+
+	// 源文件中没有 birthdate 列，作为派生列追加；已有的 性别 列直接写入
+	last := schema.Columns[len(schema.Columns)-1]
+	if len(schema.Columns) != 4 || last.Name != "birthdate" || last.Index != -1 || last.Type != "date" {
+		t.Fatalf("Columns = %+v, want derived birthdate column", schema.Columns)
+	}
+
+	s := &CleanerService{}
+	rec := s.createRecordFromRow([]string{"张三", "１１０１０５１９４９１２３１００２ｘ", ""}, 1, 1, schema, engine)
+	want := map[string]string{"身份证号": "11010519491231002X", "birthdate": "1949-12-31", "性别": "女"}
+	for col, v := range want {
+		if rec.Fields[col] != v {
+			t.Errorf("Fields[%s] = %q, want %q", col, rec.Fields[col], v)
+		}
+	}
+	if rec.Status != "Clean" {
+		t.Errorf("Status = %s (%s), want Clean", rec.Status, rec.ErrorMessage)
+	}
+
+	rec = s.createRecordFromRow([]string{"李四", "110105194912310021", ""}, 1, 2, schema, engine)
+	if rec.Fields["身份证号"] != "110105194912310021" || rec.Fields["birthdate"] != "" || rec.Status != "Error" {
+		t.Errorf("invalid ID: Fields = %v, Status = %s", rec.Fields, rec.Status)
+	}
+}
+
+func TestIsIdempotent(t *testing.T) {
+	tests := []struct {
+		typ, params string
+		want        bool
+	}{
+		{"regex", `{"pattern": "^a$"}`, true},
+		{"replace", `{"old": " ", "new": ""}`, true},
+		{"replace", `{"old": "a", "new": "aa"}`, false},
+		{"script", `{"expr": "trim(value)"}`, false},
+		{"date", `{}`, true},
+		{"date", `{"format": "yyyy年M月d日"}`, true},
+		{"date", `{"layouts": ["dd/MM/yyyy"]}`, false},
+		{"date", `{"layouts": ["dd/MM/yyyy"], "format": "dd/MM/yyyy"}`, true},
+	}
+	for _, tt := range tests {
+		s, err := newStrategy(ruleSpec(tt.typ, tt.params))
+		if err != nil {
+			t.Fatalf("newStrategy(%s %s) error = %v", tt.typ, tt.params, err)
+		}
+		if got := isIdempotent(s); got != tt.want {
+			t.Errorf("isIdempotent(%s %s) = %v, want %v", tt.typ, tt.params, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"etl-tool/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 规则集库：命名、带版本、可共享的清洗规则。每次修改规则生成一个不可变的新版本，
+// 批次记录导入时使用的规则集 ID 与版本，规则集更新后可据此找出使用旧版本导入的批次。
+
+var (
+	ErrRuleSetForbidden = errors.New("only the owner can modify this rule set")
+	ErrRuleSetNameTaken = errors.New("a rule set with this name already exists")
+)
+
+// RuleSetRequest 创建或更新规则集的请求；更新时未提供的字段保持不变，rules 变化时生成新版本
+type RuleSetRequest struct {
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+	Shared      *bool   `json:"shared"`
+	Rules       string  `json:"rules"`
+	Comment     string  `json:"comment"` // 版本说明
+}
+
+// RuleSetDetail 规则集及其某个版本
+type RuleSetDetail struct {
+	model.RuleSet
+	Version *model.RuleSetVersion `json:"version"`
+}
+
+// RuleSource 批次使用的规则：直接提交的规则 JSON，或解析自规则集的某个版本
+type RuleSource struct {
+	Rules          string `json:"rules,omitempty"`
+	RuleSetID      *uint  `json:"rule_set_id,omitempty"`
+	RuleSetVersion *int   `json:"rule_set_version,omitempty"`
+}
+
+// batchUpdates 写入批次的规则字段
+func (src RuleSource) batchUpdates() map[string]interface{} {
+	return map[string]interface{}{
+		"rules":            src.Rules,
+		"rule_set_id":      src.RuleSetID,
+		"rule_set_version": src.RuleSetVersion,
+	}
+}
+
+// batchRuleSource 读取批次当前使用的规则
+func batchRuleSource(batch *model.ImportBatch) RuleSource {
+	return RuleSource{Rules: batch.Rules, RuleSetID: batch.RuleSetID, RuleSetVersion: batch.RuleSetVersion}
+}
+
+// validateRuleSetRules 规则集必须包含可被 RuleEngine 加载的规则
+func validateRuleSetRules(rules string) error {
+	if strings.TrimSpace(rules) == "" {
+		return fmt.Errorf("rules are required")
+	}
+	if err := NewRuleEngine().LoadConfig([]byte(rules)); err != nil {
+		return fmt.Errorf("invalid rules: %w", err)
+	}
+	return nil
+}
+
+// ResolveRuleSource 解析上传 / 预览 / 重新清洗请求中的规则：指定了规则集时使用其指定版本（version 为 0 时取最新版本），否则使用直接提交的规则
+func (s *CleanerService) ResolveRuleSource(rules string, ruleSetID uint, version int, username string) (RuleSource, error) {
+	if ruleSetID == 0 {
+		return RuleSource{Rules: rules}, nil
+	}
+	rs, err := s.visibleRuleSet(s.DB, ruleSetID, username)
+	if err != nil {
+		return RuleSource{}, err
+	}
+	v, err := s.ruleSetVersion(rs, version)
+	if err != nil {
+		return RuleSource{}, err
+	}
+	return RuleSource{Rules: v.Rules, RuleSetID: &rs.ID, RuleSetVersion: &v.Version}, nil
+}
+
+// CreateRuleSet 创建规则集及其第一个版本
+func (s *CleanerService) CreateRuleSet(req RuleSetRequest, username string) (*RuleSetDetail, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if err := validateRuleSetRules(req.Rules); err != nil {
+		return nil, err
+	}
+
+	rs := model.RuleSet{Name: req.Name, Owner: username, LatestVersion: 1}
+	if req.Description != nil {
+		rs.Description = *req.Description
+	}
+	if req.Shared != nil {
+		rs.Shared = *req.Shared
+	}
+	v := model.RuleSetVersion{Version: 1, Rules: req.Rules, Comment: req.Comment, CreatedBy: username}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkRuleSetName(tx, rs.Name, 0); err != nil {
+			return err
+		}
+		if err := tx.Create(&rs).Error; err != nil {
+			return err
+		}
+		v.RuleSetID = rs.ID
+		return tx.Create(&v).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &RuleSetDetail{RuleSet: rs, Version: &v}, nil
+}
+
+// GetRuleSets 列出用户可见的规则集：自己的与他人共享的
+func (s *CleanerService) GetRuleSets(username string) ([]model.RuleSet, error) {
+	var sets []model.RuleSet
+	err := s.DB.Where("owner = ? OR shared = ?", username, true).Order("name asc").Find(&sets).Error
+	return sets, err
+}
+
+// GetRuleSet 返回规则集及指定版本（version 为 0 时为最新版本）
+func (s *CleanerService) GetRuleSet(id uint, version int, username string) (*RuleSetDetail, error) {
+	rs, err := s.visibleRuleSet(s.DB, id, username)
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.ruleSetVersion(rs, version)
+	if err != nil {
+		return nil, err
+	}
+	return &RuleSetDetail{RuleSet: *rs, Version: v}, nil
+}
+
+// GetRuleSetVersions 列出规则集的全部版本，最新的在前
+func (s *CleanerService) GetRuleSetVersions(id uint, username string) ([]model.RuleSetVersion, error) {
+	if _, err := s.visibleRuleSet(s.DB, id, username); err != nil {
+		return nil, err
+	}
+	var versions []model.RuleSetVersion
+	err := s.DB.Where("rule_set_id = ?", id).Order("version desc").Find(&versions).Error
+	return versions, err
+}
+
+// UpdateRuleSet 更新规则集的名称、描述与共享状态；规则与最新版本不同时生成新版本
+func (s *CleanerService) UpdateRuleSet(id uint, req RuleSetRequest, username string) (*RuleSetDetail, error) {
+	if req.Rules != "" {
+		if err := validateRuleSetRules(req.Rules); err != nil {
+			return nil, err
+		}
+	}
+
+	var detail *RuleSetDetail
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		rs, err := s.ownedRuleSet(tx.Clauses(clause.Locking{Strength: "UPDATE"}), id, username)
+		if err != nil {
+			return err
+		}
+		if name := strings.TrimSpace(req.Name); name != "" && name != rs.Name {
+			if err := checkRuleSetName(tx, name, rs.ID); err != nil {
+				return err
+			}
+			rs.Name = name
+		}
+		if req.Description != nil {
+			rs.Description = *req.Description
+		}
+		if req.Shared != nil {
+			rs.Shared = *req.Shared
+		}
+
+		latest, err := s.ruleSetVersion(rs, 0)
+		if err != nil {
+			return err
+		}
+		if req.Rules != "" && req.Rules != latest.Rules {
+			rs.LatestVersion++
+			latest = &model.RuleSetVersion{
+				RuleSetID: rs.ID,
+				Version:   rs.LatestVersion,
+				Rules:     req.Rules,
+				Comment:   req.Comment,
+				CreatedBy: username,
+			}
+			if err := tx.Create(latest).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(rs).Select("name", "description", "shared", "latest_version").Updates(rs).Error; err != nil {
+			return err
+		}
+		detail = &RuleSetDetail{RuleSet: *rs, Version: latest}
+		return nil
+	})
+	return detail, err
+}
+
+// DeleteRuleSet 软删除规则集；版本保留，引用它的批次仍可查看导入时的规则
+func (s *CleanerService) DeleteRuleSet(id uint, username string) error {
+	rs, err := s.ownedRuleSet(s.DB, id, username)
+	if err != nil {
+		return err
+	}
+	return s.DB.Delete(rs).Error
+}
+
+// GetRuleSetBatches 列出使用该规则集导入的批次，outdatedOnly 时只返回使用旧版本的批次
+func (s *CleanerService) GetRuleSetBatches(id uint, username string, outdatedOnly bool) ([]model.ImportBatch, error) {
+	rs, err := s.visibleRuleSet(s.DB, id, username)
+	if err != nil {
+		return nil, err
+	}
+	query := s.DB.Where("rule_set_id = ?", rs.ID)
+	if outdatedOnly {
+		query = query.Where("rule_set_version < ?", rs.LatestVersion)
+	}
+	var batches []model.ImportBatch
+	err = query.Order("created_at desc").Find(&batches).Error
+	return batches, err
+}
+
+// visibleRuleSet 加载用户可见的规则集，他人未共享的规则集视为不存在
+func (s *CleanerService) visibleRuleSet(db *gorm.DB, id uint, username string) (*model.RuleSet, error) {
+	var rs model.RuleSet
+	if err := db.First(&rs, id).Error; err != nil {
+		return nil, err
+	}
+	if rs.Owner != username && !rs.Shared {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &rs, nil
+}
+
+// ownedRuleSet 加载规则集并要求当前用户是所有者
+func (s *CleanerService) ownedRuleSet(db *gorm.DB, id uint, username string) (*model.RuleSet, error) {
+	rs, err := s.visibleRuleSet(db, id, username)
+	if err != nil {
+		return nil, err
+	}
+	if rs.Owner != username {
+		return nil, ErrRuleSetForbidden
+	}
+	return rs, nil
+}
+
+// ruleSetVersion 加载规则集的指定版本，version 为 0 时为最新版本
+func (s *CleanerService) ruleSetVersion(rs *model.RuleSet, version int) (*model.RuleSetVersion, error) {
+	if version == 0 {
+		version = rs.LatestVersion
+	}
+	var v model.RuleSetVersion
+	if err := s.DB.Where("rule_set_id = ? AND version = ?", rs.ID, version).First(&v).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("rule set %d has no version %d: %w", rs.ID, version, err)
+		}
+		return nil, err
+	}
+	return &v, nil
+}
+
+func checkRuleSetName(tx *gorm.DB, name string, excludeID uint) error {
+	var count int64
+	tx.Model(&model.RuleSet{}).Where("name = ? AND id <> ?", name, excludeID).Count(&count)
+	if count > 0 {
+		return ErrRuleSetNameTaken
+	}
+	return nil
+}
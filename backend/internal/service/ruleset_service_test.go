@@ -0,0 +1,49 @@
+package service
+
+import (
+	"testing"
+
+	"etl-tool/internal/model"
+)
+
+func TestValidateRuleSetRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr bool
+	}{
+		{"valid", `[{"column": "phone", "rules": [{"type": "regex", "pattern": "^1\\d{10}$"}]}]`, false},
+		{"empty", "  ", true},
+		{"malformed json", `[{"column": "phone"`, true},
+		{"bad regex", `[{"column": "phone", "rules": [{"type": "regex", "pattern": "("}]}]`, true},
+		{"bad row rule", `[{"column": "date", "rules": [{"type": "row", "name": "r", "expr": "date <="}]}]`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRuleSetRules(tt.rules); (err != nil) != tt.wantErr {
+				t.Errorf("validateRuleSetRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRuleSource_BatchRoundTrip(t *testing.T) {
+	id, version := uint(3), 2
+	batch := &model.ImportBatch{Rules: "[]", RuleSetID: &id, RuleSetVersion: &version}
+
+	src := batchRuleSource(batch)
+	updates := src.batchUpdates()
+	if updates["rules"] != "[]" || *updates["rule_set_id"].(*uint) != 3 || *updates["rule_set_version"].(*int) != 2 {
+		t.Errorf("batchUpdates() = %v", updates)
+	}
+
+	// 直接提交的规则会清除规则集引用
+	direct, err := (&CleanerService{}).ResolveRuleSource("[]", 0, 0, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates = direct.batchUpdates()
+	if updates["rule_set_id"].(*uint) != nil || updates["rule_set_version"].(*int) != nil {
+		t.Errorf("direct rules should clear the rule set reference, got %v", updates)
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"etl-tool/internal/model"
+	"etl-tool/internal/utils"
+)
+
+// saverRetry 批量写入失败时的重试策略（退避时间每次翻倍）
+var saverRetry = struct {
+	attempts int
+	backoff  time.Duration
+}{attempts: 3, backoff: 200 * time.Millisecond}
+
+// saveChunk 写入一组记录：失败时按退避重试，仍失败则二分定位出错的行，并将其替换为带数据库错误信息的 Error 记录。
+// 返回实际入库的记录（含隔离记录）；只有隔离记录也无法写入（如数据库不可用）时才返回错误。
+// ctx 取消时立即返回 ctx.Err()，不再重试或隔离。
+func saveChunk(ctx context.Context, store batchStore, recs []model.Record) ([]model.Record, error) {
+	var err error
+	backoff := saverRetry.backoff
+	for attempt := 1; attempt <= saverRetry.attempts; attempt++ {
+		if err = store.SaveRecords(ctx, recs); err == nil {
+			return recs, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt < saverRetry.attempts {
+			log.Printf("[Saver] Bulk insert of %d rows failed (attempt %d/%d): %v", len(recs), attempt, saverRetry.attempts, err)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+	}
+
+	log.Printf("[Saver] Bulk insert of %d rows failed after %d attempts, isolating bad rows: %v", len(recs), saverRetry.attempts, err)
+	return bisectChunk(ctx, store, recs, err)
+}
+
+// bisectChunk 二分拆分写入失败的记录，cause 为该组记录整体写入时的错误
+func bisectChunk(ctx context.Context, store batchStore, recs []model.Record, cause error) ([]model.Record, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if len(recs) == 1 {
+		q := quarantineRecord(recs[0], cause)
+		if err := store.SaveRecords(ctx, []model.Record{q}); err != nil {
+			return nil, fmt.Errorf("row %d could not be stored: %v (quarantine failed: %w)", recs[0].RowIndex, cause, err)
+		}
+		log.Printf("[Saver] Row %d quarantined: %v", q.RowIndex, cause)
+		return []model.Record{q}, nil
+	}
+
+	saved := make([]model.Record, 0, len(recs))
+	mid := len(recs) / 2
+	for _, half := range [][]model.Record{recs[:mid], recs[mid:]} {
+		err := store.SaveRecords(ctx, half)
+		if err == nil {
+			saved = append(saved, half...)
+			continue
+		}
+		part, err := bisectChunk(ctx, store, half, err)
+		saved = append(saved, part...)
+		if err != nil {
+			return saved, err
+		}
+	}
+	return saved, nil
+}
+
+// quarantineRecord 生成只保留行号与错误信息的 Error 记录，替代无法入库的原始行
+func quarantineRecord(rec model.Record, cause error) model.Record {
+	return model.Record{
+		BatchID:      rec.BatchID,
+		RowIndex:     rec.RowIndex,
+		Status:       "Error",
+		ErrorMessage: utils.Truncate(fmt.Sprintf("[db: %v]", cause), 1000),
+		Errors: model.FieldErrors{{
+			Rule:    "db",
+			Code:    ErrCodeDBRejected,
+			Message: utils.Truncate(cause.Error(), 1000),
+		}},
+	}
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"etl-tool/internal/model"
+	"etl-tool/internal/repository"
+	"etl-tool/internal/utils"
+
+	gormPostgres "gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 基准测试需要已迁移的数据库与生成器产出的数据集：
+//
+//	go run ./cmd/generator -n 200000 -o uploads/large_data.csv
+//	ETL_BENCH_DSN="host=localhost user=postgres password=123456 dbname=csv_cleaner port=5436 sslmode=disable" \
+//	ETL_BENCH_CSV=../../uploads/large_data.csv go test ./internal/service -run '^$' -bench Saver -benchmem
+const benchBatchID = 900000001
+
+func loadBenchRecords(b *testing.B) []model.Record {
+	b.Helper()
+	path := os.Getenv("ETL_BENCH_CSV")
+	if path == "" {
+		path = "../../uploads/large_data.csv"
+	}
+	iter, err := utils.NewRowIterator(path)
+	if err != nil {
+		b.Skipf("dataset not available (%v); generate it with cmd/generator", err)
+	}
+	defer iter.Close()
+
+	s := &CleanerService{}
+	header, err := s.readHeader(iter)
+	if err != nil {
+		b.Fatalf("readHeader() error = %v", err)
+	}
+	engine := NewRuleEngine()
+	schema := newBatchSchema(header, utils.DetectHeaders(header), nil, engine)
+
+	var recs []model.Record
+	for idx := 1; iter.Next(); idx++ {
+		recs = append(recs, s.createRecordFromRow(iter.Row(), benchBatchID, idx, schema, engine))
+	}
+	return recs
+}
+
+func openBenchDB(b *testing.B) *gorm.DB {
+	b.Helper()
+	dsn := os.Getenv("ETL_BENCH_DSN")
+	if dsn == "" {
+		b.Skip("ETL_BENCH_DSN not set")
+	}
+	db, err := gorm.Open(gormPostgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		b.Fatalf("Failed to connect: %v", err)
+	}
+	repository.DB = db
+	return db
+}
+
+func BenchmarkSaver(b *testing.B) {
+	db := openBenchDB(b)
+	recs := loadBenchRecords(b)
+	_, _, _, chunk := getAdaptiveConfig()
+
+	backends := []struct {
+		name  string
+		store batchStore
+	}{
+		{SaverGorm, gormBatchStore{db: db}},
+		{SaverCopy, copyBatchStore{gormBatchStore{db: db}}},
+	}
+
+	for _, backend := range backends {
+		b.Run(backend.name, func(b *testing.B) {
+			ctx := context.Background()
+			b.ReportAllocs()
+
+			var peakHeap uint64
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				repository.DropBatchPartition(db, benchBatchID)
+				if err := repository.EnsureBatchPartition(benchBatchID); err != nil {
+					b.Fatalf("EnsureBatchPartition() error = %v", err)
+				}
+				runtime.GC()
+				stopSampling := sampleHeapPeak(10 * time.Millisecond)
+				b.StartTimer()
+
+				for start := 0; start < len(recs); start += chunk {
+					end := min(start+chunk, len(recs))
+					if err := backend.store.SaveRecords(ctx, recs[start:end]); err != nil {
+						b.Fatalf("SaveRecords() error = %v", err)
+					}
+				}
+
+				b.StopTimer()
+				peakHeap = max(peakHeap, stopSampling())
+				b.StartTimer()
+			}
+
+			b.ReportMetric(float64(len(recs))*float64(b.N)/b.Elapsed().Seconds(), "rows/s")
+			b.ReportMetric(float64(peakHeap)/1024/1024, "peak-heap-MB")
+		})
+	}
+
+	repository.DropBatchPartition(db, benchBatchID)
+}
+
+// sampleHeapPeak 按间隔采样 HeapInuse，调用返回的函数停止采样并得到期间的最大值
+func sampleHeapPeak(interval time.Duration) func() uint64 {
+	var peak uint64
+	sample := func() {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		peak = max(peak, m.HeapInuse)
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			sample()
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() uint64 {
+		close(done)
+		<-stopped
+		sample() // 采样间隔内的峰值可能恰好在结束时
+		return peak
+	}
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"etl-tool/internal/model"
+	"etl-tool/internal/utils"
+
+	"gorm.io/gorm/schema"
+)
+
+// rejectingStore 在 memBatchStore 基础上模拟写入失败：transient 次数内整体失败，之后拒绝包含坏行的批次
+type rejectingStore struct {
+	*memBatchStore
+	transient int
+	calls     int
+	bad       func(rec model.Record) bool
+}
+
+func (r *rejectingStore) SaveRecords(ctx context.Context, recs []model.Record) error {
+	r.mu.Lock()
+	r.calls++
+	transient := r.calls <= r.transient
+	r.mu.Unlock()
+	if transient {
+		return errors.New("connection reset by peer")
+	}
+	for _, rec := range recs {
+		if r.bad(rec) {
+			return errors.New("invalid byte sequence for encoding \"UTF8\": 0x00")
+		}
+	}
+	return r.memBatchStore.SaveRecords(ctx, recs)
+}
+
+func withFastRetry(t *testing.T) {
+	t.Helper()
+	old := saverRetry
+	saverRetry.backoff = time.Millisecond
+	t.Cleanup(func() { saverRetry = old })
+}
+
+func TestSaveChunk_RetriesAndQuarantines(t *testing.T) {
+	withFastRetry(t)
+
+	store := &rejectingStore{
+		memBatchStore: newMemBatchStore(1),
+		transient:     2, // 前两次失败后重试成功到达数据校验
+		bad:           func(rec model.Record) bool { return strings.Contains(rec.Fields["name"], "\x00") },
+	}
+
+	recs := make([]model.Record, 100)
+	for i := range recs {
+		name := fmt.Sprintf("user-%d", i+1)
+		if i == 17 || i == 63 {
+			name = "bad\x00name"
+		}
+		recs[i] = model.Record{BatchID: 1, RowIndex: i + 1, Status: "Clean", Fields: model.JSONMap{"name": name}}
+	}
+
+	saved, err := saveChunk(context.Background(), store, recs)
+	if err != nil {
+		t.Fatalf("saveChunk() error = %v", err)
+	}
+	if len(saved) != len(recs) || len(store.records) != len(recs) {
+		t.Fatalf("Expected %d rows stored, got saved=%d stored=%d", len(recs), len(saved), len(store.records))
+	}
+
+	for i := 1; i <= len(recs); i++ {
+		rec := store.records[i]
+		quarantined := i == 18 || i == 64
+		if quarantined != (rec.Status == "Error") {
+			t.Errorf("Row %d status = %s, quarantined = %v", i, rec.Status, quarantined)
+		}
+		if quarantined && !strings.Contains(rec.ErrorMessage, "0x00") {
+			t.Errorf("Row %d should carry the db error, got %q", i, rec.ErrorMessage)
+		}
+	}
+}
+
+func TestSaveChunk_CancelDuringBackoff(t *testing.T) {
+	old := saverRetry
+	saverRetry.backoff = time.Minute
+	t.Cleanup(func() { saverRetry = old })
+
+	store := &rejectingStore{memBatchStore: newMemBatchStore(1), transient: 1}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := saveChunk(ctx, store, []model.Record{{BatchID: 1, RowIndex: 1}})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("saveChunk() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Cancel waited out the retry backoff (%v)", elapsed)
+	}
+}
+
+func TestProcessRows_StoreUnavailable(t *testing.T) {
+	withFastRetry(t)
+
+	header := []string{"name", "phone"}
+	rows := make([][]string, 20000)
+	for i := range rows {
+		rows[i] = []string{fmt.Sprintf("user-%d", i+1), "13812345678"}
+	}
+
+	store := &rejectingStore{
+		memBatchStore: newMemBatchStore(1),
+		transient:     1 << 30, // 数据库始终不可用
+	}
+	s := &CleanerService{store: store}
+	engine := NewRuleEngine()
+	schema := newBatchSchema(header, utils.DetectHeaders(header), nil, engine)
+
+	done := make(chan struct{})
+	var stats *processStats
+	var err error
+	go func() {
+		stats, err = s.processRows(context.Background(), &sliceIterator{rows: rows}, 1, schema, batchCheckpoint{}, engine)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("processRows deadlocked after saver failure")
+	}
+
+	if err == nil || !strings.Contains(err.Error(), "failed to store records") {
+		t.Fatalf("Expected saver error to stop processing, got %v", err)
+	}
+	if stats.rowIdx != 0 || stats.successRows != 0 || len(store.records) != 0 {
+		t.Errorf("Nothing was stored, stats must not claim progress: %+v", stats)
+	}
+}
+
+func TestCopyRow_MatchesRecordColumns(t *testing.T) {
+	sch, err := schema.Parse(&model.Record{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatalf("schema.Parse() error = %v", err)
+	}
+
+	if n := len(copyRow(&model.Record{})); n != len(copyColumns) {
+		t.Fatalf("copyRow() returns %d values for %d columns", n, len(copyColumns))
+	}
+	// 除 id 外的所有列都必须通过 COPY 写入，否则新增字段会在 copy 模式下被静默丢弃
+	covered := make(map[string]bool, len(copyColumns))
+	for _, col := range copyColumns {
+		covered[col] = true
+		if sch.LookUpField(col) == nil {
+			t.Errorf("copy column %s does not exist on Record", col)
+		}
+	}
+	for _, f := range sch.Fields {
+		if f.DBName != "" && f.DBName != "id" && !covered[f.DBName] {
+			t.Errorf("Record column %s is not written by the copy saver", f.DBName)
+		}
+	}
+}
@@ -0,0 +1,453 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"etl-tool/internal/model"
+	"etl-tool/internal/utils"
+)
+
+// 逻辑字段：由表头识别得到，同时写入 Record 上的固定列以支持索引搜索
+const (
+	FieldName    = "name"
+	FieldPhone   = "phone"
+	FieldDate    = "date"
+	FieldAddress = "address"
+)
+
+// 位置字段：由地址解析得到，可在编辑时被手动覆盖
+var locationFields = []string{"province", "city", "district"}
+
+// batchSchema 描述一个批次的列结构：源表头、逻辑字段映射以及每列使用的规则键
+type batchSchema struct {
+	Columns  model.BatchColumns
+	ruleKeys []string // 与 Columns 一一对应
+}
+
+// newBatchSchema 根据上传文件的表头与识别出的逻辑列构建批次列目录，ignored 中的列不会被导入
+func newBatchSchema(header []string, indices utils.ColIndices, ignored map[int]bool, engine *RuleEngine) *batchSchema {
+	logical := make(map[int]string, 4)
+	for _, m := range []struct {
+		field string
+		idx   int
+	}{
+		{FieldName, indices.Name},
+		{FieldPhone, indices.Phone},
+		{FieldDate, indices.Date},
+		{FieldAddress, indices.Address},
+	} {
+		// 同一列只映射到第一个匹配的逻辑字段
+		if _, taken := logical[m.idx]; m.idx >= 0 && !taken {
+			logical[m.idx] = m.field
+		}
+	}
+
+	seen := make(map[string]int, len(header))
+	columns := make(model.BatchColumns, 0, len(header))
+	for i, h := range header {
+		if ignored[i] {
+			continue
+		}
+		name := strings.TrimSpace(h)
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		// 重名列追加序号，保证 Fields 的 key 唯一
+		lower := strings.ToLower(name)
+		if n := seen[lower]; n > 0 {
+			name = fmt.Sprintf("%s_%d", name, n+1)
+		}
+		seen[lower]++
+
+		columns = append(columns, model.BatchColumn{Name: name, Index: i, Field: logical[i]})
+	}
+
+	return buildSchema(columns, engine)
+}
+
+// schemaFromBatch 从已保存的批次恢复列结构；旧批次没有列目录时退化为四个逻辑字段
+func schemaFromBatch(batch *model.ImportBatch, engine *RuleEngine) *batchSchema {
+	columns := batch.Columns
+	if len(columns) == 0 {
+		columns = model.BatchColumns{
+			{Name: FieldName, Index: 0, Field: FieldName},
+			{Name: FieldPhone, Index: 1, Field: FieldPhone},
+			{Name: FieldDate, Index: 2, Field: FieldDate},
+			{Name: FieldAddress, Index: 3, Field: FieldAddress},
+		}
+	}
+	return buildSchema(columns, engine)
+}
+
+func buildSchema(columns model.BatchColumns, engine *RuleEngine) *batchSchema {
+	sc := &batchSchema{
+		Columns:  make(model.BatchColumns, len(columns)),
+		ruleKeys: make([]string, len(columns)),
+	}
+	for i, col := range columns {
+		// 优先使用以源表头命名的规则，没有时回退到逻辑字段名（如 join_date -> date）
+		key := col.Name
+		if col.Field != "" && !engine.HasRules(col.Name) {
+			key = col.Field
+		}
+		col.Type = inferColumnType(col, engine.TypesFor(key))
+		sc.Columns[i] = col
+		sc.ruleKeys[i] = key
+	}
+	// 派生列：由行作用域策略计算、源文件中没有的列
+	for _, rs := range engine.RowStrategies {
+		ds, ok := rs.Strategy.(DerivedStrategy)
+		if !ok {
+			continue
+		}
+		if _, exists := sc.ruleColumn(rs.Column); exists {
+			continue
+		}
+		sc.Columns = append(sc.Columns, model.BatchColumn{Name: rs.Column, Index: -1, Type: ds.DerivedType()})
+		sc.ruleKeys = append(sc.ruleKeys, rs.Column)
+	}
+	return sc
+}
+
+// inferColumnType 根据逻辑字段与配置的策略推断列类型
+func inferColumnType(col model.BatchColumn, strategyTypes []string) string {
+	switch col.Field {
+	case FieldPhone:
+		return "phone"
+	case FieldDate:
+		return "date"
+	case FieldAddress:
+		return "address"
+	}
+	for _, t := range strategyTypes {
+		switch t {
+		case "date", "number", "email", "idcard":
+			return t
+		}
+	}
+	return "text"
+}
+
+// buildRecord 对每一列执行规则并生成 Record（BatchID/RowIndex 由调用方填充）
+func (sc *batchSchema) buildRecord(get func(col model.BatchColumn) string, engine *RuleEngine) model.Record {
+	rec, errs := sc.cleanColumns(get, nil, engine)
+	sc.finishRecord(&rec, errs, engine, nil)
+	return rec
+}
+
+// cleanColumns 执行列规则并解析地址，返回记录与列级错误；isClean 为 true 的列已经清洗过，只重新校验
+func (sc *batchSchema) cleanColumns(get func(col model.BatchColumn) string, isClean func(col model.BatchColumn) bool, engine *RuleEngine) (model.Record, model.FieldErrors) {
+	rec := model.Record{Fields: make(model.JSONMap, len(sc.Columns))}
+
+	var errs model.FieldErrors
+	var rawAddress string
+	for i, col := range sc.Columns {
+		raw := get(col)
+		execute := engine.Execute
+		if isClean != nil && isClean(col) {
+			execute = engine.Revalidate
+		}
+		cleaned, err := execute(sc.ruleKeys[i], raw)
+		if err != nil {
+			errs = append(errs, columnError(col.Name, cleaned, err))
+		}
+		rec.Fields[col.Name] = cleaned
+
+		switch col.Field {
+		case FieldName:
+			rec.Name = utils.Truncate(cleaned, 255)
+		case FieldPhone:
+			rec.Phone = utils.Truncate(cleaned, 50)
+		case FieldDate:
+			rec.Date = utils.Truncate(cleaned, 50)
+		case FieldAddress:
+			rawAddress = raw
+			rec.Address = raw
+		}
+	}
+
+	// 地址解析 (动态)：省市区不一致时记为地址列的错误（三个部分的错误相同，只记录一次）
+	if rawAddress != "" {
+		p, errP := engine.Execute("address_province", rawAddress)
+		c, errC := engine.Execute("address_city", rawAddress)
+		d, errD := engine.Execute("address_district", rawAddress)
+		rec.Province = utils.Truncate(p, 100)
+		rec.City = utils.Truncate(c, 100)
+		rec.District = utils.Truncate(d, 100)
+		for _, err := range []error{errP, errC, errD} {
+			if err == nil {
+				continue
+			}
+			if col, ok := sc.resolveColumn(FieldAddress); ok {
+				errs = append(errs, columnError(col.Name, rawAddress, err))
+			}
+			break
+		}
+	}
+	return rec, errs
+}
+
+// finishRecord 在列值与省市区确定后执行行作用域策略与行级规则，并据此判定状态；
+// skip 不为 nil 时跳过其返回 true 的行作用域策略
+func (sc *batchSchema) finishRecord(rec *model.Record, errs model.FieldErrors, engine *RuleEngine, skip func(i int) bool) {
+	if len(engine.RowStrategies) > 0 {
+		errs = append(errs, sc.applyRowStrategies(rec, engine, skip)...)
+	}
+	if len(engine.RowRules) > 0 {
+		errs = append(errs, engine.ExecuteRowRules(sc.rowEnv(rec))...)
+	}
+
+	// 状态判断
+	if len(errs) > 0 {
+		rec.Status = "Error"
+		rec.Errors = errs
+		rec.ErrorMessage = errorSummary(errs)
+	} else {
+		rec.Status = "Clean"
+		rec.Errors = nil
+		rec.ErrorMessage = ""
+	}
+}
+
+// applyRowStrategies 依次执行行作用域策略并将结果写回所在列，后面的策略可以看到前面的结果；
+// 所在列不在本批次中时跳过
+func (sc *batchSchema) applyRowStrategies(rec *model.Record, engine *RuleEngine, skip func(i int) bool) model.FieldErrors {
+	var errs model.FieldErrors
+	for i, rs := range engine.RowStrategies {
+		col, ok := sc.ruleColumn(rs.Column)
+		if !ok || (skip != nil && skip(i)) {
+			continue
+		}
+		out, err := rs.Strategy.CleanRow(rec.Fields[col.Name], sc.rowEnv(rec))
+		if err != nil {
+			errs = append(errs, columnError(col.Name, out, asRuleError(rs.Strategy.GetType(), err)))
+			continue
+		}
+		sc.setValue(rec, col, out)
+	}
+	return errs
+}
+
+// ruleColumn 返回规则配置中的列名对应的列：先匹配源表头（忽略大小写），再匹配逻辑字段
+func (sc *batchSchema) ruleColumn(column string) (model.BatchColumn, bool) {
+	for _, col := range sc.Columns {
+		if strings.EqualFold(col.Name, column) {
+			return col, true
+		}
+	}
+	for _, col := range sc.Columns {
+		if col.Field != "" && col.Field == strings.ToLower(column) {
+			return col, true
+		}
+	}
+	return model.BatchColumn{}, false
+}
+
+// setValue 写入列的新值并同步逻辑字段对应的固定列（地址不会重新解析省市区）
+func (sc *batchSchema) setValue(rec *model.Record, col model.BatchColumn, v string) {
+	rec.Fields[col.Name] = v
+	switch col.Field {
+	case FieldName:
+		rec.Name = utils.Truncate(v, 255)
+	case FieldPhone:
+		rec.Phone = utils.Truncate(v, 50)
+	case FieldDate:
+		rec.Date = utils.Truncate(v, 50)
+	case FieldAddress:
+		rec.Address = v
+	}
+}
+
+// columnError 将列规则的错误转换为结构化错误
+func columnError(column, value string, err error) model.FieldError {
+	fe := model.FieldError{Column: column, Code: ErrCodeInvalid, Message: err.Error(), Value: utils.Truncate(value, 255)}
+	var re *RuleError
+	if errors.As(err, &re) {
+		fe.Rule, fe.Code = re.Rule, re.Code
+	}
+	return fe
+}
+
+// errorSummary 生成 ErrorMessage 中的可读摘要，格式与结构化错误引入前保持一致：[列: 描述 规则名: 描述]
+func errorSummary(errs model.FieldErrors) string {
+	parts := make([]string, len(errs))
+	for i, e := range errs {
+		switch {
+		case e.Rule != "row":
+			parts[i] = e.Column + ": " + e.Message
+		case e.Code == ErrCodeRowRuleError:
+			parts[i] = e.Message
+		default:
+			parts[i] = e.Code + ": " + e.Message
+		}
+	}
+	return fmt.Sprintf("%v", parts)
+}
+
+// rowEnv 构建行级规则的求值环境：源列名、逻辑字段与省市区，row 中包含全部值
+func (sc *batchSchema) rowEnv(rec *model.Record) map[string]any {
+	row := make(map[string]any, len(sc.Columns)+len(locationFields)+4)
+	for _, col := range sc.Columns {
+		row[col.Name] = rec.Fields[col.Name]
+	}
+	for _, col := range sc.Columns {
+		if col.Field != "" {
+			row[col.Field] = rec.Fields[col.Name]
+		}
+	}
+	row["province"], row["city"], row["district"] = rec.Province, rec.City, rec.District
+
+	env := make(map[string]any, len(row)+1)
+	for k, v := range row {
+		env[k] = v
+	}
+	env["row"] = row
+	return env
+}
+
+// valueOf 读取记录中某列的当前值；旧记录没有 Fields 时回退到固定列
+func (sc *batchSchema) valueOf(rec *model.Record, col model.BatchColumn) string {
+	if v, ok := rec.Fields[col.Name]; ok {
+		return v
+	}
+	switch col.Field {
+	case FieldName:
+		return rec.Name
+	case FieldPhone:
+		return rec.Phone
+	case FieldDate:
+		return rec.Date
+	case FieldAddress:
+		return rec.Address
+	}
+	return ""
+}
+
+// resolveColumn 将更新请求中的 key 解析为列：先匹配逻辑字段，再匹配源表头（忽略大小写）
+func (sc *batchSchema) resolveColumn(key string) (model.BatchColumn, bool) {
+	for _, col := range sc.Columns {
+		if col.Field != "" && col.Field == key {
+			return col, true
+		}
+	}
+	for _, col := range sc.Columns {
+		if strings.EqualFold(col.Name, key) {
+			return col, true
+		}
+	}
+	return model.BatchColumn{}, false
+}
+
+// applyUpdates 将用户输入合并进记录并重新执行规则，返回新的记录状态。
+// 用户输入的列执行全部规则；其余列的值已经清洗过，只重新校验（见 RuleEngine.Revalidate）
+func (sc *batchSchema) applyUpdates(rec *model.Record, updates map[string]interface{}, engine *RuleEngine) (model.Record, error) {
+	return sc.update(rec, updates, false, engine)
+}
+
+// applyCleanedUpdates 与 applyUpdates 相同，但 updates 中是已清洗的值（如合并时取自其他记录），同样只重新校验
+func (sc *batchSchema) applyCleanedUpdates(rec *model.Record, updates map[string]interface{}, engine *RuleEngine) (model.Record, error) {
+	return sc.update(rec, updates, true, engine)
+}
+
+func (sc *batchSchema) update(rec *model.Record, updates map[string]interface{}, cleaned bool, engine *RuleEngine) (model.Record, error) {
+	values := make(map[string]string, len(sc.Columns))
+	for _, col := range sc.Columns {
+		values[col.Name] = sc.valueOf(rec, col)
+	}
+
+	locations := make(map[string]string)
+	edited := make(map[string]bool)
+	for key, v := range updates {
+		if isLocationField(key) {
+			locations[key] = fmt.Sprintf("%v", v)
+			continue
+		}
+		col, ok := sc.resolveColumn(key)
+		if !ok {
+			return model.Record{}, fmt.Errorf("unknown column: %s", key)
+		}
+		values[col.Name] = fmt.Sprintf("%v", v)
+		edited[col.Name] = true
+	}
+
+	isClean := func(col model.BatchColumn) bool { return cleaned || !edited[col.Name] }
+	next, errs := sc.cleanColumns(func(col model.BatchColumn) string { return values[col.Name] }, isClean, engine)
+	next.ID = rec.ID
+	next.BatchID = rec.BatchID
+	next.RowIndex = rec.RowIndex
+	next.RawData = rec.RawData
+
+	// 地址未变化时保留原有的解析结果，手动指定的省市区优先
+	if _, hasAddr := sc.resolveColumn(FieldAddress); !hasAddr || next.Address == rec.Address {
+		next.Province, next.City, next.District = rec.Province, rec.City, rec.District
+	}
+	for key, v := range locations {
+		switch key {
+		case "province":
+			next.Province = utils.Truncate(v, 100)
+		case "city":
+			next.City = utils.Truncate(v, 100)
+		case "district":
+			next.District = utils.Truncate(v, 100)
+		}
+	}
+
+	// 跳过的非幂等策略没有重新执行，保留它们上次留下的错误
+	skipped := make(map[[2]string]bool)
+	for i, col := range sc.Columns {
+		if !isClean(col) {
+			continue
+		}
+		for _, st := range engine.ColumnRules[strings.ToLower(sc.ruleKeys[i])] {
+			if !isIdempotent(st) {
+				skipped[[2]string{col.Name, st.GetType()}] = true
+			}
+		}
+	}
+	skipRow := make([]bool, len(engine.RowStrategies))
+	for i, rs := range engine.RowStrategies {
+		col, ok := sc.ruleColumn(rs.Column)
+		if !ok || isIdempotent(rs.Strategy) || !isClean(col) || sc.rowInputEdited(rs.Strategy, edited, locations) {
+			continue
+		}
+		skipRow[i] = true
+		skipped[[2]string{col.Name, rs.Strategy.GetType()}] = true
+	}
+	for _, e := range rec.Errors {
+		if skipped[[2]string{e.Column, e.Rule}] {
+			errs = append(errs, e)
+		}
+	}
+	sc.finishRecord(&next, errs, engine, func(i int) bool { return skipRow[i] })
+	return next, nil
+}
+
+// rowInputEdited 报告行作用域策略读取的列中是否有被修改的列；无法得知读取哪些列的策略视为没有
+func (sc *batchSchema) rowInputEdited(st RowStrategy, edited map[string]bool, locations map[string]string) bool {
+	r, ok := st.(interface{ reads(name string) bool })
+	if !ok {
+		return false
+	}
+	for _, col := range sc.Columns {
+		if edited[col.Name] && (r.reads(col.Name) || (col.Field != "" && r.reads(col.Field))) {
+			return true
+		}
+	}
+	for key := range locations {
+		if r.reads(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLocationField(key string) bool {
+	for _, f := range locationFields {
+		if f == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"testing"
+
+	"etl-tool/internal/model"
+	"etl-tool/internal/utils"
+)
+
+const testSchemaRules = `[
+	{"column": "phone", "rules": [{"type": "regex", "pattern": "^1\\d{10}$"}]},
+	{"column": "date", "rules": [{"type": "date"}]},
+	{"column": "department", "rules": [{"type": "required"}]},
+	{"column": "address_province", "rules": [{"type": "address", "comp": "province"}]}
+]`
+
+func newTestSchema(t *testing.T, header []string) (*batchSchema, *RuleEngine) {
+	t.Helper()
+	engine := NewRuleEngine()
+	if err := engine.LoadConfig([]byte(testSchemaRules)); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	return newBatchSchema(header, utils.DetectHeaders(header), nil, engine), engine
+}
+
+func TestNewBatchSchema_Catalogue(t *testing.T) {
+	header := []string{"id", "name", "phone", "join_date", "address", "department", "", "id"}
+	schema, _ := newTestSchema(t, header)
+
+	if len(schema.Columns) != len(header) {
+		t.Fatalf("Expected %d columns, got %d", len(header), len(schema.Columns))
+	}
+
+	tests := []struct {
+		idx   int
+		name  string
+		field string
+		typ   string
+	}{
+		{0, "id", "", "text"},
+		{1, "name", FieldName, "text"},
+		{2, "phone", FieldPhone, "phone"},
+		{3, "join_date", FieldDate, "date"},
+		{4, "address", FieldAddress, "address"},
+		{5, "department", "", "text"},
+		{6, "column_7", "", "text"}, // 空表头自动命名
+		{7, "id_2", "", "text"},     // 重名表头追加序号
+	}
+	for _, tt := range tests {
+		col := schema.Columns[tt.idx]
+		if col.Name != tt.name || col.Field != tt.field || col.Type != tt.typ || col.Index != tt.idx {
+			t.Errorf("Column %d = %+v, want name=%s field=%s type=%s", tt.idx, col, tt.name, tt.field, tt.typ)
+		}
+	}
+
+	// join_date 没有同名规则，应回退到逻辑字段 date 的规则
+	if schema.ruleKeys[3] != FieldDate {
+		t.Errorf("Expected join_date to use 'date' rules, got %s", schema.ruleKeys[3])
+	}
+}
+
+func TestCreateRecordFromRow_PersistsEveryColumn(t *testing.T) {
+	header := []string{"id", "name", "phone", "join_date", "address", "department"}
+	schema, engine := newTestSchema(t, header)
+	s := &CleanerService{}
+
+	row := []string{"42", "张三", "13812345678", "2023/01/05", "四川省成都市武侯区", "研发部"}
+	rec := s.createRecordFromRow(row, 7, 3, schema, engine)
+
+	if rec.BatchID != 7 || rec.RowIndex != 3 {
+		t.Errorf("Unexpected identity: batch=%d row=%d", rec.BatchID, rec.RowIndex)
+	}
+	if rec.Status != "Clean" {
+		t.Fatalf("Expected Clean, got %s (%s)", rec.Status, rec.ErrorMessage)
+	}
+	want := map[string]string{
+		"id":         "42",
+		"name":       "张三",
+		"phone":      "13812345678",
+		"join_date":  "2023-01-05",
+		"address":    "四川省成都市武侯区",
+		"department": "研发部",
+	}
+	for k, v := range want {
+		if rec.Fields[k] != v {
+			t.Errorf("Fields[%s] = %q, want %q", k, rec.Fields[k], v)
+		}
+	}
+	if rec.Date != "2023-01-05" || rec.Phone != "13812345678" || rec.Province != "四川省" {
+		t.Errorf("Logical columns not populated: %+v", rec)
+	}
+}
+
+func TestCreateRecordFromRow_RulesOnAnyColumn(t *testing.T) {
+	header := []string{"name", "phone", "department"}
+	schema, engine := newTestSchema(t, header)
+	s := &CleanerService{}
+
+	rec := s.createRecordFromRow([]string{"李四", "13812345678", ""}, 1, 1, schema, engine)
+	if rec.Status != "Error" {
+		t.Fatalf("Expected Error for empty department, got %s", rec.Status)
+	}
+	if rec.ErrorMessage != "[department: is required]" {
+		t.Errorf("Unexpected error message: %s", rec.ErrorMessage)
+	}
+	want := model.FieldError{Column: "department", Rule: "required", Code: ErrCodeRequired, Message: "is required"}
+	if len(rec.Errors) != 1 || rec.Errors[0] != want {
+		t.Errorf("Errors = %+v, want [%+v]", rec.Errors, want)
+	}
+
+	// 短行：缺失的单元格按空字符串处理
+	rec = s.createRecordFromRow([]string{"李四"}, 1, 2, schema, engine)
+	if rec.Fields["department"] != "" || rec.Status != "Error" {
+		t.Errorf("Short row not handled: %+v", rec)
+	}
+}
+
+func TestApplyUpdates_DynamicColumn(t *testing.T) {
+	header := []string{"name", "phone", "department"}
+	schema, engine := newTestSchema(t, header)
+	s := &CleanerService{}
+
+	rec := s.createRecordFromRow([]string{"李四", "13812345678", ""}, 1, 1, schema, engine)
+	rec.ID = 99
+	rec.Province = "手动省份"
+
+	next, err := schema.applyUpdates(&rec, map[string]interface{}{"department": "财务部"}, engine)
+	if err != nil {
+		t.Fatalf("applyUpdates() error = %v", err)
+	}
+	if next.Status != "Clean" || next.Fields["department"] != "财务部" {
+		t.Errorf("Expected department fix to clean record, got %+v", next)
+	}
+	if next.ID != 99 || next.Province != "手动省份" {
+		t.Errorf("Identity or location lost: %+v", next)
+	}
+
+	if _, err := schema.applyUpdates(&rec, map[string]interface{}{"salary": "1"}, engine); err == nil {
+		t.Error("Expected error for unknown column")
+	}
+}
+
+func TestApplyUpdates_NonIdempotentRules(t *testing.T) {
+	engine := NewRuleEngine()
+	config := `[
+		{"column": "code", "rules": [{"type": "script", "expr": "value + \"-x\""}]},
+		{"column": "qty", "rules": [{"type": "script", "expr": "string(int(value) * 2)"}]},
+		{"column": "note", "rules": [{"type": "script", "scope": "row", "expr": "value + \"!\""}]},
+		{"column": "全名", "rules": [{"type": "script", "scope": "row", "expr": "row[\"姓\"] + row[\"名\"]"}]}
+	]`
+	if err := engine.LoadConfig([]byte(config)); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	header := []string{"code", "qty", "note", "姓", "名", "全名"}
+	schema := newBatchSchema(header, utils.DetectHeaders(header), nil, engine)
+	s := &CleanerService{}
+
+	rec := s.createRecordFromRow([]string{"a", "abc", "n", "张", "三", ""}, 1, 1, schema, engine)
+	if rec.Fields["code"] != "a-x" || rec.Fields["note"] != "n!" || rec.Fields["全名"] != "张三" || rec.Status != "Error" {
+		t.Fatalf("createRecordFromRow() = %+v", rec)
+	}
+
+	tests := []struct {
+		name    string
+		updates map[string]interface{}
+		cleaned bool
+		want    map[string]string
+	}{
+		{"修改其他列", map[string]interface{}{"名": "四"}, false, map[string]string{"code": "a-x", "note": "n!", "全名": "张四"}},
+		{"重新校验", nil, false, map[string]string{"code": "a-x", "note": "n!", "全名": "张三"}},
+		{"用户输入执行全部规则", map[string]interface{}{"code": "b", "note": "m"}, false, map[string]string{"code": "b-x", "note": "m!"}},
+		{"合并已清洗的值", map[string]interface{}{"code": "c-x", "note": "k!"}, true, map[string]string{"code": "c-x", "note": "k!"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apply := schema.applyUpdates
+			if tt.cleaned {
+				apply = schema.applyCleanedUpdates
+			}
+			next, err := apply(&rec, tt.updates, engine)
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			for col, want := range tt.want {
+				if next.Fields[col] != want {
+					t.Errorf("%s = %q, want %q", col, next.Fields[col], want)
+				}
+			}
+			// 未重新执行的脚本保留上次的错误
+			if next.Status != "Error" || len(next.Errors) != 1 || next.Errors[0].Column != "qty" || next.Errors[0].Rule != "script" {
+				t.Errorf("Errors = %+v, want the qty script error", next.Errors)
+			}
+		})
+	}
+}
+
+func TestSchemaFromBatch_Legacy(t *testing.T) {
+	engine := NewRuleEngine()
+	schema := schemaFromBatch(&model.ImportBatch{}, engine)
+	if len(schema.Columns) != 4 {
+		t.Fatalf("Expected 4 legacy columns, got %d", len(schema.Columns))
+	}
+
+	rec := model.Record{Name: "王五", Phone: "13900000000"}
+	if v := schema.valueOf(&rec, schema.Columns[0]); v != "王五" {
+		t.Errorf("Legacy value fallback failed: %s", v)
+	}
+}
+
+func TestNewExportLayout(t *testing.T) {
+	legacy := newExportLayout(nil)
+	if len(legacy.headers) != 14 {
+		t.Errorf("Legacy layout should have 14 headers, got %d", len(legacy.headers))
+	}
+
+	columns := model.BatchColumns{{Name: "id", Index: 0}, {Name: "department", Index: 1}}
+	layout := newExportLayout(columns)
+	wantHeaders := []string{"行号", "id", "department", "省份", "城市", "区县", "状态", "错误列", "错误规则", "错误代码", "错误信息", "错误值"}
+	if len(layout.headers) != len(wantHeaders) {
+		t.Fatalf("headers = %v, want %v", layout.headers, wantHeaders)
+	}
+	for i := range wantHeaders {
+		if layout.headers[i] != wantHeaders[i] {
+			t.Errorf("header[%d] = %s, want %s", i, layout.headers[i], wantHeaders[i])
+		}
+	}
+
+	row := layout.row(&model.Record{RowIndex: 5, Fields: model.JSONMap{"id": "9", "department": "IT部"}, Status: "Clean"})
+	if row[0] != "5" || row[1] != "9" || row[2] != "IT部" || row[6] != "Clean" {
+		t.Errorf("Unexpected export row: %v", row)
+	}
+
+	row = layout.row(&model.Record{Status: "Error", Errors: model.FieldErrors{
+		{Column: "phone", Rule: "regex", Code: ErrCodePattern, Message: "does not match", Value: "123"},
+		{Column: "department", Rule: "required", Code: ErrCodeRequired, Message: "is required"},
+	}})
+	if got := row[7:]; got[0] != "phone; department" || got[2] != "pattern_mismatch; required" || got[4] != "123; " {
+		t.Errorf("Unexpected error columns: %v", got)
+	}
+
+	// 旧记录没有结构化错误时回退到 ErrorMessage
+	row = layout.row(&model.Record{Status: "Error", ErrorMessage: "[name: is required]"})
+	if row[10] != "[name: is required]" {
+		t.Errorf("Expected legacy error message, got %v", row)
+	}
+}
+
+func TestExportLayout_WithRawColumns(t *testing.T) {
+	columns := model.BatchColumns{{Name: "phone", Index: 0, Field: FieldPhone}}
+	layout := newExportLayout(columns).withRawColumns([]string{"phone", "secret"})
+
+	if got := layout.headers[len(layout.headers)-2:]; got[0] != "原始_phone" || got[1] != "原始_secret" {
+		t.Errorf("raw headers = %v", got)
+	}
+	row := layout.row(&model.Record{Fields: model.JSONMap{"phone": "13800138000"}, RawData: encodeRawRow([]string{" 138-0013-8000 "})})
+	if len(row) != len(layout.headers) {
+		t.Fatalf("row has %d values, want %d", len(row), len(layout.headers))
+	}
+	if row[1] != "13800138000" || row[len(row)-2] != " 138-0013-8000 " || row[len(row)-1] != "" {
+		t.Errorf("Unexpected export row: %v", row)
+	}
+}
+
+func TestResolveColumns_MappingOverridesDetection(t *testing.T) {
+	header := []string{"name", "company_name", "phone", "secret"}
+	mapping := `{"company_name": "name", "secret": "ignore"}`
+
+	indices, ignored, err := resolveColumns(header, mapping)
+	if err != nil {
+		t.Fatalf("resolveColumns() error = %v", err)
+	}
+	schema := newBatchSchema(header, indices, ignored, NewRuleEngine())
+	if len(schema.Columns) != 3 {
+		t.Fatalf("Ignored column should be dropped, got %+v", schema.Columns)
+	}
+	if schema.Columns[1].Name != "company_name" || schema.Columns[1].Field != FieldName {
+		t.Errorf("company_name should be the logical name column, got %+v", schema.Columns[1])
+	}
+	if schema.Columns[0].Field != "" {
+		t.Errorf("name column should stay unmapped when a mapping is given, got %+v", schema.Columns[0])
+	}
+
+	// 只有在未提供映射时才回退到自动识别，并保留缺少 Name/Phone 时的拒绝逻辑
+	if _, _, err := resolveColumns([]string{"foo", "bar"}, ""); err == nil {
+		t.Error("Detection fallback should reject files without Name/Phone")
+	}
+	if _, _, err := resolveColumns([]string{"foo", "bar"}, `{"foo": "ignore"}`); err != nil {
+		t.Errorf("Explicit mapping should accept files without Name/Phone, got %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/file"
+	"github.com/expr-lang/expr/vm"
+)
+
+// 脚本策略（type: script）：用 expr 表达式（与行级规则相同的沙箱语言）计算列的新值，适合一次性的转换。
+//   - scope 为 cell（默认）时只能访问当前值 value，与其他列策略一样按配置顺序执行
+//   - scope 为 row 时在所有列规则之后执行，可像行级规则一样访问同一行的其他列，结果写回所在列；
+//     所在列必须存在于上传文件中，结果不再经过该列的其他策略
+//
+// 表达式在 LoadConfig 时编译；每次求值在调用方的 goroutine 中执行，受内存预算、步数与时间上限约束，
+// 失败时该列记为 script_error。expr 没有循环语句，重复执行只来自 map / filter / all 等的谓词，
+// 编译时在每个谓词体外包一层计步调用，超出步数或时间时在 VM 内部中止求值。示例：
+//
+//	{"type": "script", "expr": "upper(trim(value))"}
+//	{"type": "script", "expr": "{\"D01\": \"人事部\", \"D02\": \"研发部\"}[value] ?? value"}
+//	{"type": "script", "scope": "row", "expr": "row[\"姓\"] + row[\"名\"]"}
+//	{"type": "script", "scope": "row", "expr": "string(age(date))"}
+
+const (
+	ErrCodeScript = "script_error"
+
+	scriptDefaultTimeout = 50 * time.Millisecond
+	scriptMaxTimeout     = time.Second
+	scriptMemoryBudget   = 100000  // 单次求值的内存预算（expr 的分配计数），限制 range / map 等操作的规模
+	scriptMaxSteps       = 1000000 // 单次求值最多执行的谓词次数
+	scriptClockEvery     = 1024    // 每执行这么多步检查一次是否超时
+
+	// 计步函数与预算在求值环境中的名字，用户表达式无法写出以 $ 开头的标识符
+	scriptStepFunc   = "$step"
+	scriptBudgetName = "$budget"
+)
+
+var (
+	errScriptSteps   = errors.New("script exceeded the step limit")
+	errScriptTimeout = errors.New("script timed out")
+)
+
+// scriptBudget 单次求值的步数与时间预算，由 $step 在每次执行谓词时扣减
+type scriptBudget struct {
+	steps    int
+	maxSteps int
+	deadline time.Time
+}
+
+func (b *scriptBudget) step() error {
+	b.steps++
+	if b.steps > b.maxSteps {
+		return errScriptSteps
+	}
+	if b.steps%scriptClockEvery == 0 && time.Now().After(b.deadline) {
+		return errScriptTimeout
+	}
+	return nil
+}
+
+// scriptStepPatch 将每个谓词体 body 改写为 $step($budget, body)
+type scriptStepPatch struct{}
+
+func (scriptStepPatch) Visit(node *ast.Node) {
+	p, ok := (*node).(*ast.PredicateNode)
+	if !ok {
+		return
+	}
+	if call, ok := p.Node.(*ast.CallNode); ok {
+		if id, ok := call.Callee.(*ast.IdentifierNode); ok && id.Value == scriptStepFunc {
+			return // 已改写（checker 会对补丁后的树再次遍历）
+		}
+	}
+	p.Node = &ast.CallNode{
+		Callee:    &ast.IdentifierNode{Value: scriptStepFunc},
+		Arguments: []ast.Node{&ast.IdentifierNode{Value: scriptBudgetName}, p.Node},
+	}
+}
+
+var scriptStepOption = expr.Function(scriptStepFunc, func(params ...any) (any, error) {
+	if b, ok := params[0].(*scriptBudget); ok {
+		if err := b.step(); err != nil {
+			return nil, err
+		}
+	}
+	return params[1], nil
+})
+
+// RowStrategy 行作用域的列策略：在所有列规则之后执行，可读取同一行的其他列，结果写回所在列。
+// 注册的策略实现该接口时，LoadConfig 将其放入 RuleEngine.RowStrategies 而不是列策略
+type RowStrategy interface {
+	CleaningStrategy
+	CleanRow(input string, env map[string]any) (string, error)
+}
+
+// DerivedStrategy 派生列策略：所在列不在上传文件中时，buildSchema 将其作为派生列（Index 为 -1）加入列目录，
+// DerivedType 为派生列的列类型
+type DerivedStrategy interface {
+	RowStrategy
+	DerivedType() string
+}
+
+// rowValue 读取行环境中某列的值，列名先精确匹配再忽略大小写匹配
+func rowValue(env map[string]any, column string) string {
+	row, _ := env["row"].(map[string]any)
+	if v, ok := row[column]; ok {
+		return strings.TrimSpace(fmt.Sprint(v))
+	}
+	for k, v := range row {
+		if strings.EqualFold(k, column) {
+			return strings.TrimSpace(fmt.Sprint(v))
+		}
+	}
+	return ""
+}
+
+// ColumnRowStrategy 绑定到某列的行作用域策略
+type ColumnRowStrategy struct {
+	Column   string
+	Strategy RowStrategy
+}
+
+type scriptParams struct {
+	Expr      string `json:"expr" desc:"expr 表达式，结果写回当前列" required:"true"`
+	Scope     string `json:"scope" desc:"cell：只能访问 value；row：在列规则之后执行，可访问同一行的其他列" enum:"cell,row"`
+	TimeoutMs int    `json:"timeout_ms" desc:"单次求值的时间上限（毫秒），默认 50，最大 1000"`
+}
+
+func init() {
+	RegisterStrategy("script", "脚本转换（expr 表达式）", newScriptStrategy)
+}
+
+func newScriptStrategy(p scriptParams) (CleaningStrategy, error) {
+	timeout := scriptDefaultTimeout
+	if p.TimeoutMs < 0 || time.Duration(p.TimeoutMs)*time.Millisecond > scriptMaxTimeout {
+		return nil, NewParamError("timeout_ms", "timeout_ms must be between 0 and %d", scriptMaxTimeout.Milliseconds())
+	}
+	if p.TimeoutMs > 0 {
+		timeout = time.Duration(p.TimeoutMs) * time.Millisecond
+	}
+
+	opts := append([]expr.Option{
+		expr.MaxNodes(rowRuleMaxNodes),
+		expr.DisableBuiltin("date"), // 与行级规则一致，date 指向日期列
+		expr.Patch(scriptStepPatch{}),
+		scriptStepOption,
+	}, rowRuleFunctions...)
+	if p.Scope == "row" {
+		opts = append(opts, expr.AllowUndefinedVariables())
+	} else {
+		opts = append(opts, expr.Env(map[string]any{"value": "", scriptBudgetName: (*scriptBudget)(nil)}))
+	}
+	program, err := expr.Compile(p.Expr, opts...)
+	if err != nil {
+		return nil, NewParamError("expr", "%s", scriptErrorMessage(err))
+	}
+
+	s := &ScriptStrategy{Expr: p.Expr, program: program, timeout: timeout, maxSteps: scriptMaxSteps}
+	if p.Scope == "row" {
+		var idents []string
+		for _, id := range exprIdents(program) {
+			if !strings.HasPrefix(id, "$") {
+				idents = append(idents, id)
+			}
+		}
+		return &RowScriptStrategy{ScriptStrategy: s, idents: idents}, nil
+	}
+	return s, nil
+}
+
+// ScriptStrategy 单元格作用域的脚本，环境中只有当前值 value
+type ScriptStrategy struct {
+	Expr     string
+	program  *vm.Program
+	timeout  time.Duration
+	maxSteps int
+}
+
+func (s *ScriptStrategy) Clean(input string) (string, error) {
+	return s.eval(input, map[string]any{"value": input})
+}
+
+func (s *ScriptStrategy) GetType() string { return "script" }
+
+// Idempotent 脚本的结果无法预知，一律视为非幂等
+func (s *ScriptStrategy) Idempotent() bool { return false }
+
+// eval 在当前 goroutine 中求值，env 中的 $budget 由本函数设置
+func (s *ScriptStrategy) eval(input string, env map[string]any) (string, error) {
+	env[scriptBudgetName] = &scriptBudget{maxSteps: s.maxSteps, deadline: time.Now().Add(s.timeout)}
+	machine := vm.VM{MemoryBudget: scriptMemoryBudget}
+	out, err := machine.Run(s.program, env)
+	switch {
+	case errors.Is(err, errScriptTimeout):
+		return input, ruleError(ErrCodeScript, "script timed out after %v", s.timeout)
+	case errors.Is(err, errScriptSteps):
+		return input, ruleError(ErrCodeScript, "script exceeded %d steps", s.maxSteps)
+	case err != nil:
+		return input, ruleError(ErrCodeScript, "script failed: %s", scriptErrorMessage(err))
+	}
+	return scriptString(out), nil
+}
+
+// RowScriptStrategy 行作用域的脚本，环境与行级规则相同，另有所在列的当前值 value
+type RowScriptStrategy struct {
+	*ScriptStrategy
+	idents []string
+}
+
+func (s *RowScriptStrategy) CleanRow(input string, env map[string]any) (string, error) {
+	env = maps.Clone(env)
+	for _, id := range s.idents {
+		if _, ok := env[id]; !ok {
+			env[id] = ""
+		}
+	}
+	env["value"] = input
+	return s.eval(input, env)
+}
+
+// reads 报告脚本是否读取了指定列；通过 row 访问时视为读取全部列
+func (s *RowScriptStrategy) reads(name string) bool {
+	for _, id := range s.idents {
+		if id == "row" || strings.EqualFold(id, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// scriptString 将表达式结果转换为列值：nil 为空字符串，浮点数不使用科学计数法
+func scriptString(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'f', -1, 32)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// scriptErrorMessage 将 expr 的错误压缩为一行（去掉源码片段，保留行列位置）
+func scriptErrorMessage(err error) string {
+	var fe *file.Error
+	if errors.As(err, &fe) {
+		if fe.Snippet == "" {
+			return fe.Message
+		}
+		return fmt.Sprintf("%s (%d:%d)", fe.Message, fe.Line, fe.Column)
+	}
+	return strings.TrimSpace(err.Error())
+}
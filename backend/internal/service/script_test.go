@@ -0,0 +1,182 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"etl-tool/internal/utils"
+)
+
+func TestScriptStrategy_Cell(t *testing.T) {
+	config := `[
+		{"column": "code", "rules": [{"type": "script", "expr": "upper(trim(value))"}]},
+		{"column": "dept", "rules": [{"type": "script", "expr": "{\"D01\": \"人事部\", \"D02\": \"研发部\"}[value] ?? value"}]},
+		{"column": "score", "rules": [{"type": "script", "expr": "float(value) * 1.5"}]},
+		{"column": "blank", "rules": [{"type": "script", "expr": "value == \"\" ? nil : value"}]}
+	]`
+	engine := NewRuleEngine()
+	if err := engine.LoadConfig([]byte(config)); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	tests := []struct {
+		column   string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"code", " ab01 ", "AB01", false},
+		{"dept", "D02", "研发部", false},
+		{"dept", "X99", "X99", false},
+		{"score", "3", "4.5", false},
+		{"score", "abc", "abc", true},
+		{"blank", "", "", false},
+	}
+	for _, tt := range tests {
+		got, err := engine.Execute(tt.column, tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Execute(%s, %q) error = %v, wantErr %v", tt.column, tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("Execute(%s, %q) = %q, want %q", tt.column, tt.input, got, tt.expected)
+		}
+		var re *RuleError
+		if tt.wantErr && (!errors.As(err, &re) || re.Rule != "script" || re.Code != ErrCodeScript) {
+			t.Errorf("Execute(%s, %q) error = %#v, want script_error", tt.column, tt.input, err)
+		}
+	}
+}
+
+func TestScriptStrategy_Limits(t *testing.T) {
+	engine := NewRuleEngine()
+	if err := engine.LoadConfig([]byte(`[{"column": "n", "rules": [{"type": "script", "expr": "len(map(1..1000000, #))"}]}]`)); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if _, err := engine.Execute("n", "x"); err == nil || !strings.Contains(err.Error(), "memory budget") {
+		t.Errorf("Execute() error = %v, want memory budget exceeded", err)
+	}
+
+	s, err := newScriptStrategy(scriptParams{Expr: "reduce(1..90000, #acc + #, 0)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.(*ScriptStrategy).timeout = time.Nanosecond
+	if _, err := s.Clean("x"); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Clean() error = %v, want timeout", err)
+	}
+
+	// 嵌套谓词不分配内存，只能靠步数与时间限制中止；求值在当前 goroutine 中结束，不遗留后台计算。
+	// 步数用例的时间上限足够大，超时用例不限步数，两种限制互不干扰（-race 下求值明显变慢）
+	tests := []struct {
+		expr     string
+		timeout  time.Duration
+		maxSteps int
+		want     string
+	}{
+		{"let a = 1..20000; len(filter(a, {any(a, {# < 0})}))", time.Minute, 10000, "exceeded 10000 steps"},
+		{"let a = 1..20000; len(filter(a, {any(a, {# < 0})}))", 20 * time.Millisecond, math.MaxInt, "timed out"},
+		{"let a = 1..20000; reduce(a, #acc + count(a, {# > 0}), 0)", 20 * time.Millisecond, math.MaxInt, "timed out"},
+	}
+	if s.(*ScriptStrategy).maxSteps != scriptMaxSteps {
+		t.Errorf("default maxSteps = %d, want %d", s.(*ScriptStrategy).maxSteps, scriptMaxSteps)
+	}
+	before := runtime.NumGoroutine()
+	for _, tt := range tests {
+		s, err := newScriptStrategy(scriptParams{Expr: tt.expr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.(*ScriptStrategy).timeout = tt.timeout
+		s.(*ScriptStrategy).maxSteps = tt.maxSteps
+		start := time.Now()
+		_, err = s.Clean("x")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Clean(%s) error = %v, want %q", tt.expr, err, tt.want)
+		}
+		if elapsed := time.Since(start); elapsed > tt.timeout+500*time.Millisecond {
+			t.Errorf("Clean(%s) took %v", tt.expr, elapsed)
+		}
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines: %d before, %d after", before, after)
+	}
+
+	// 计步不改变谓词的结果，行作用域同样生效
+	row, err := newScriptStrategy(scriptParams{Expr: "join(map(filter(split(value, \",\"), {# != \"\"}), upper(#)), \"/\")", Scope: "row"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := row.(RowStrategy).CleanRow("a,,b", map[string]any{}); err != nil || got != "A/B" {
+		t.Errorf("CleanRow() = %q, %v", got, err)
+	}
+}
+
+func TestScriptStrategy_ConfigErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		rule      string
+		wantField string
+	}{
+		{"missing expr", `{"type": "script"}`, "expr"},
+		{"syntax error", `{"type": "script", "expr": "upper(value"}`, "expr"},
+		{"other column in cell scope", `{"type": "script", "expr": "value + dept"}`, "expr"},
+		{"unknown scope", `{"type": "script", "scope": "batch", "expr": "value"}`, "scope"},
+		{"timeout too long", `{"type": "script", "expr": "value", "timeout_ms": 5000}`, "timeout_ms"},
+	}
+	for _, tt := range tests {
+		err := ValidateRules(`[{"column": "code", "rules": [` + tt.rule + `]}]`)
+		var errs RuleConfigErrors
+		if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Field != tt.wantField {
+			t.Errorf("%s: ValidateRules() = %v, want error on %s", tt.name, err, tt.wantField)
+		}
+	}
+}
+
+func TestScriptStrategy_Row(t *testing.T) {
+	config := `[
+		{"column": "全名", "rules": [{"type": "script", "scope": "row", "expr": "row[\"姓\"] + row[\"名\"]"}]},
+		{"column": "年龄", "rules": [{"type": "script", "scope": "row", "expr": "empty(date) ? value : string(age(date))"}]},
+		{"column": "name", "rules": [{"type": "required"}]},
+		{"column": "备注", "rules": [{"type": "script", "scope": "row", "expr": "age(备注)"}]},
+		{"column": "全名", "rules": [{"type": "row", "name": "has_name", "expr": "!empty(row[\"全名\"])"}]}
+	]`
+	engine := NewRuleEngine()
+	if err := engine.LoadConfig([]byte(config)); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(engine.RowStrategies) != 3 || engine.HasRules("全名") {
+		t.Fatalf("RowStrategies = %d, HasRules(全名) = %v", len(engine.RowStrategies), engine.HasRules("全名"))
+	}
+
+	header := []string{"name", "姓", "名", "全名", "birth_date", "年龄", "备注"}
+	schema := newBatchSchema(header, utils.DetectHeaders(header), nil, engine)
+	s := &CleanerService{}
+	birth := time.Now().AddDate(-30, 0, -1).Format("2006/01/02")
+
+	rec := s.createRecordFromRow([]string{"张三", "张", "三", "", birth, "", "2000-01-01"}, 1, 1, schema, engine)
+	if rec.Fields["全名"] != "张三" || rec.Fields["年龄"] != "30" {
+		t.Errorf("Fields = %v", rec.Fields)
+	}
+	if rec.Status != "Clean" {
+		t.Errorf("Status = %s, ErrorMessage = %s", rec.Status, rec.ErrorMessage)
+	}
+
+	rec = s.createRecordFromRow([]string{"张三", "", "", "", "", "28", "未知"}, 1, 2, schema, engine)
+	if rec.Fields["年龄"] != "28" {
+		t.Errorf("年龄 = %q, want value kept when date is empty", rec.Fields["年龄"])
+	}
+	if rec.Status != "Error" || len(rec.Errors) != 2 {
+		t.Fatalf("Errors = %+v, want script error and row rule failure", rec.Errors)
+	}
+	if e := rec.Errors[0]; e.Column != "备注" || e.Rule != "script" || e.Code != ErrCodeScript || !strings.Contains(e.Message, "age:") {
+		t.Errorf("script error = %+v", e)
+	}
+	if rec.Errors[1].Code != "has_name" {
+		t.Errorf("row rule error = %+v, want has_name (row rules see script results)", rec.Errors[1])
+	}
+}
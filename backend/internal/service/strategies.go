@@ -0,0 +1,316 @@
+package service
+
+import (
+	"math"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// 文本规范化与常见人事数据的校验策略。
+// enum / number / email / idcard 不校验空值，需要非空时与 required 组合使用。
+// idcard 的 extract 是派生列规则：配置在目标列上，从 source 列读取身份证号，源列保持不变。
+
+// 错误代码（见 rule_engine.go 中的说明）
+const (
+	ErrCodeNotInEnum     = "not_in_enum"
+	ErrCodeNotNumber     = "not_a_number"
+	ErrCodeTooSmall      = "too_small"
+	ErrCodeTooLarge      = "too_large"
+	ErrCodeInvalidEmail  = "invalid_email"
+	ErrCodeInvalidIDCard = "invalid_id_card"
+	ErrCodeIDChecksum    = "id_card_checksum"
+)
+
+// HalfWidthStrategy 全角转半角（全角字母、数字、标点与全角空格），不改变汉字
+type HalfWidthStrategy struct{}
+
+func (s *HalfWidthStrategy) Clean(input string) (string, error) {
+	return width.Fold.String(input), nil
+}
+
+func (s *HalfWidthStrategy) GetType() string { return "halfwidth" }
+
+// NFKCStrategy Unicode NFKC 规范化：在全角转半角之外，兼容字符也会被展开（如 ① → 1、㎏ → kg）
+type NFKCStrategy struct{}
+
+func (s *NFKCStrategy) Clean(input string) (string, error) {
+	return norm.NFKC.String(input), nil
+}
+
+func (s *NFKCStrategy) GetType() string { return "nfkc" }
+
+// TrimStrategy 去除首尾空白（含全角空格与零宽字符）
+type TrimStrategy struct{}
+
+func (s *TrimStrategy) Clean(input string) (string, error) {
+	return strings.TrimFunc(input, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '\u200b' || r == '\ufeff'
+	}), nil
+}
+
+func (s *TrimStrategy) GetType() string { return "trim" }
+
+// CaseStrategy 大小写转换，Case 为 lower 或 upper
+type CaseStrategy struct {
+	Case string
+}
+
+func (s *CaseStrategy) Clean(input string) (string, error) {
+	if s.Case == "upper" {
+		return strings.ToUpper(input), nil
+	}
+	return strings.ToLower(input), nil
+}
+
+func (s *CaseStrategy) GetType() string { return "case" }
+
+// EnumStrategy 枚举校验：值必须属于 values，或是 map 中的别名（输出映射后的标准值）
+type EnumStrategy struct {
+	IgnoreCase bool
+	lookup     map[string]string // 规范化后的输入 -> 标准值
+}
+
+// NewEnumStrategy 合并 values 与别名表；ignoreCase 时按小写匹配
+func NewEnumStrategy(values []string, aliases map[string]string, ignoreCase bool) *EnumStrategy {
+	s := &EnumStrategy{IgnoreCase: ignoreCase, lookup: make(map[string]string, len(values)+2*len(aliases))}
+	for _, v := range values {
+		s.lookup[s.key(v)] = v
+	}
+	for alias, v := range aliases {
+		s.lookup[s.key(alias)] = v
+		s.lookup[s.key(v)] = v
+	}
+	return s
+}
+
+func (s *EnumStrategy) key(v string) string {
+	if s.IgnoreCase {
+		return strings.ToLower(v)
+	}
+	return v
+}
+
+func (s *EnumStrategy) Clean(input string) (string, error) {
+	if input == "" {
+		return input, nil
+	}
+	if v, ok := s.lookup[s.key(input)]; ok {
+		return v, nil
+	}
+	return input, ruleError(ErrCodeNotInEnum, "not an allowed value")
+}
+
+func (s *EnumStrategy) GetType() string { return "enum" }
+
+// NumberStrategy 数值解析与范围校验，允许千分位逗号，输出去除格式后的数值
+type NumberStrategy struct {
+	Min *float64
+	Max *float64
+}
+
+func (s *NumberStrategy) Clean(input string) (string, error) {
+	if input == "" {
+		return input, nil
+	}
+	v, err := strconv.ParseFloat(strings.ReplaceAll(input, ",", ""), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return input, ruleError(ErrCodeNotNumber, "not a number")
+	}
+	out := strconv.FormatFloat(v, 'f', -1, 64)
+	if s.Min != nil && v < *s.Min {
+		return out, ruleError(ErrCodeTooSmall, "too small: min %s", formatNumber(*s.Min))
+	}
+	if s.Max != nil && v > *s.Max {
+		return out, ruleError(ErrCodeTooLarge, "too large: max %s", formatNumber(*s.Max))
+	}
+	return out, nil
+}
+
+func (s *NumberStrategy) GetType() string { return "number" }
+
+func formatNumber(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+
+// EmailStrategy 邮箱格式校验，域名统一为小写
+type EmailStrategy struct{}
+
+func (s *EmailStrategy) Clean(input string) (string, error) {
+	if input == "" {
+		return input, nil
+	}
+	addr, err := mail.ParseAddress(input)
+	// 只接受裸地址，拒绝 "Name <a@b.com>" 等形式
+	if err != nil || addr.Name != "" || addr.Address != input {
+		return input, ruleError(ErrCodeInvalidEmail, "invalid email address")
+	}
+	at := strings.LastIndex(input, "@")
+	domain := strings.ToLower(input[at+1:])
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return input, ruleError(ErrCodeInvalidEmail, "invalid email domain")
+	}
+	return input[:at+1] + domain, nil
+}
+
+func (s *EmailStrategy) GetType() string { return "email" }
+
+// IDCardStrategy 18 位居民身份证号校验（GB 11643 校验码与出生日期），输出规范化的号码（末位 x 转为大写）
+type IDCardStrategy struct{}
+
+func (s *IDCardStrategy) Clean(input string) (string, error) {
+	if input == "" {
+		return input, nil
+	}
+	info, err := ParseIDCard(input)
+	if err != nil {
+		return input, err
+	}
+	return info.Number, nil
+}
+
+func (s *IDCardStrategy) GetType() string { return "idcard" }
+
+// IDCardExtractStrategy 从同一行的身份证号列（Source）提取出生日期（YYYY-MM-DD）或性别（男/女），
+// 写入规则所在的列而不修改身份证号本身。所在列不在上传文件中时作为派生列加入批次
+type IDCardExtractStrategy struct {
+	Source  string
+	Extract string // "birthdate" or "gender"
+}
+
+func (s *IDCardExtractStrategy) Clean(input string) (string, error) { return input, nil }
+
+func (s *IDCardExtractStrategy) GetType() string { return "idcard" }
+
+func (s *IDCardExtractStrategy) CleanRow(input string, env map[string]any) (string, error) {
+	id := rowValue(env, s.Source)
+	if id == "" {
+		return "", nil
+	}
+	info, err := ParseIDCard(id)
+	if err != nil {
+		return "", err
+	}
+	if s.Extract == "gender" {
+		return info.Gender, nil
+	}
+	return info.Birthdate, nil
+}
+
+func (s *IDCardExtractStrategy) DerivedType() string {
+	if s.Extract == "birthdate" {
+		return "date"
+	}
+	return "text"
+}
+
+// IDCardInfo 身份证号解析结果
+type IDCardInfo struct {
+	Number    string // 规范化后的号码
+	Birthdate string // YYYY-MM-DD
+	Gender    string // 男 / 女
+}
+
+var (
+	idCardWeights = [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	idCardChecks  = "10X98765432"
+)
+
+// ParseIDCard 校验 18 位身份证号并提取出生日期与性别
+func ParseIDCard(input string) (IDCardInfo, error) {
+	id := strings.ToUpper(input)
+	if len(id) != 18 {
+		return IDCardInfo{}, ruleError(ErrCodeInvalidIDCard, "ID card number must have 18 characters")
+	}
+	sum := 0
+	for i := 0; i < 17; i++ {
+		if id[i] < '0' || id[i] > '9' {
+			return IDCardInfo{}, ruleError(ErrCodeInvalidIDCard, "ID card number must start with 17 digits")
+		}
+		sum += int(id[i]-'0') * idCardWeights[i]
+	}
+	if last := id[17]; last != 'X' && (last < '0' || last > '9') {
+		return IDCardInfo{}, ruleError(ErrCodeInvalidIDCard, "invalid check character: %c", last)
+	}
+
+	birth, err := time.Parse("20060102", id[6:14])
+	if err != nil || birth.Year() < 1900 || birth.After(time.Now()) {
+		return IDCardInfo{}, ruleError(ErrCodeInvalidIDCard, "invalid birthdate in ID card number: %s", id[6:14])
+	}
+	if want := idCardChecks[sum%11]; id[17] != want {
+		return IDCardInfo{}, ruleError(ErrCodeIDChecksum, "checksum mismatch: expected %c", want)
+	}
+
+	info := IDCardInfo{Number: id, Birthdate: birth.Format("2006-01-02"), Gender: "女"}
+	if (id[16]-'0')%2 == 1 {
+		info.Gender = "男"
+	}
+	return info, nil
+}
+
+// 策略参数
+type (
+	caseParams struct {
+		Case string `json:"case" desc:"转换为小写或大写，默认 lower" enum:"lower,upper"`
+	}
+	enumParams struct {
+		Values     []string          `json:"values" desc:"允许的值"`
+		Map        map[string]string `json:"map" desc:"别名到标准值的映射，匹配别名时输出标准值"`
+		IgnoreCase bool              `json:"ignore_case" desc:"匹配时忽略大小写"`
+	}
+	numberParams struct {
+		Min *float64 `json:"min" desc:"最小值（含）"`
+		Max *float64 `json:"max" desc:"最大值（含）"`
+	}
+	idCardParams struct {
+		Extract string `json:"extract" desc:"为空时校验并输出规范化的号码；否则从 source 列提取出生日期或性别，写入规则所在列" enum:"birthdate,gender"`
+		Source  string `json:"source" desc:"extract 时读取身份证号的列，规则所在列可以是上传文件中没有的派生列"`
+	}
+)
+
+func init() {
+	RegisterStrategy("halfwidth", "全角转半角", func(noParams) (CleaningStrategy, error) {
+		return &HalfWidthStrategy{}, nil
+	})
+	RegisterStrategy("nfkc", "Unicode NFKC 规范化", func(noParams) (CleaningStrategy, error) {
+		return &NFKCStrategy{}, nil
+	})
+	RegisterStrategy("trim", "去除首尾空白", func(noParams) (CleaningStrategy, error) {
+		return &TrimStrategy{}, nil
+	})
+	RegisterStrategy("case", "大小写转换", func(p caseParams) (CleaningStrategy, error) {
+		if p.Case == "" {
+			p.Case = "lower"
+		}
+		return &CaseStrategy{Case: p.Case}, nil
+	})
+	RegisterStrategy("enum", "枚举 / 对照表校验", func(p enumParams) (CleaningStrategy, error) {
+		if len(p.Values) == 0 && len(p.Map) == 0 {
+			return nil, NewParamError("values", "values or map is required")
+		}
+		return NewEnumStrategy(p.Values, p.Map, p.IgnoreCase), nil
+	})
+	RegisterStrategy("number", "数值解析与范围校验", func(p numberParams) (CleaningStrategy, error) {
+		if p.Min != nil && p.Max != nil && *p.Min > *p.Max {
+			return nil, NewParamError("min", "min (%s) must not be greater than max (%s)", formatNumber(*p.Min), formatNumber(*p.Max))
+		}
+		return &NumberStrategy{Min: p.Min, Max: p.Max}, nil
+	})
+	RegisterStrategy("email", "邮箱格式校验", func(noParams) (CleaningStrategy, error) {
+		return &EmailStrategy{}, nil
+	})
+	RegisterStrategy("idcard", "18 位居民身份证号校验", func(p idCardParams) (CleaningStrategy, error) {
+		switch {
+		case p.Extract != "" && p.Source == "":
+			return nil, NewParamError("source", "source is required with extract: configure the rule on the target column and point source at the ID card column")
+		case p.Extract == "" && p.Source != "":
+			return nil, NewParamError("extract", "extract is required with source")
+		case p.Extract != "":
+			return &IDCardExtractStrategy{Source: p.Source, Extract: p.Extract}, nil
+		}
+		return &IDCardStrategy{}, nil
+	})
+}
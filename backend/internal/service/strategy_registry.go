@@ -0,0 +1,245 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 策略注册表：按 type 注册列策略，每个策略从规则对象的原始 JSON 中解码自己的参数结构体。
+// 自定义策略在 init 中调用 RegisterStrategy 注册，并由 internal/plugins 匿名导入，
+// 保证 API 服务（校验规则）与 worker（执行规则）注册的策略一致。
+//
+// 参数结构体通过字段标签描述参数，用于生成 /api/rules/strategies 的参数说明与通用校验：
+//
+//	type myParams struct {
+//		Prefix string `json:"prefix" desc:"必须包含的前缀" required:"true"`
+//		Mode   string `json:"mode" desc:"匹配方式" enum:"strict,loose"`
+//	}
+//
+// 未知参数会被忽略（前端切换类型时会保留上一类型的参数）。
+
+// ParamError 策略参数错误，Field 为出错的参数名，LoadConfig 据此补全错误路径
+type ParamError struct {
+	Field   string
+	Message string
+}
+
+func (e *ParamError) Error() string { return e.Message }
+
+// NewParamError 创建参数错误，供策略的构造函数使用
+func NewParamError(field, format string, args ...interface{}) error {
+	return &ParamError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// StrategyInfo 策略说明，由 /api/rules/strategies 返回
+type StrategyInfo struct {
+	Type        string      `json:"type"`
+	Description string      `json:"description"`
+	Scope       string      `json:"scope"` // column：列策略；row：行级规则
+	Params      ParamSchema `json:"params"`
+}
+
+// ParamSchema 参数说明，格式参照 JSON Schema
+type ParamSchema struct {
+	Type                 string                 `json:"type"`
+	Description          string                 `json:"description,omitempty"`
+	Properties           map[string]ParamSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Items                *ParamSchema           `json:"items,omitempty"`
+	AdditionalProperties *ParamSchema           `json:"additionalProperties,omitempty"`
+}
+
+type strategyDef struct {
+	info  StrategyInfo
+	build func(raw json.RawMessage) (CleaningStrategy, error)
+}
+
+var strategyRegistry = struct {
+	sync.RWMutex
+	defs map[string]*strategyDef
+}{defs: make(map[string]*strategyDef)}
+
+// RegisterStrategy 注册列策略：规则对象解码为 P（P 须为结构体），通过标签校验后交给 build 创建策略。
+// 类型名重复或为保留名（row）时 panic，应在 init 中调用
+func RegisterStrategy[P any](typ, description string, build func(params P) (CleaningStrategy, error)) {
+	t := reflect.TypeOf((*P)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("strategy %q: params must be a struct, got %s", typ, t))
+	}
+	def := &strategyDef{
+		info: StrategyInfo{Type: typ, Description: description, Scope: "column", Params: paramSchema(t)},
+		build: func(raw json.RawMessage) (CleaningStrategy, error) {
+			var p P
+			if err := decodeParams(raw, &p); err != nil {
+				return nil, err
+			}
+			return build(p)
+		},
+	}
+
+	strategyRegistry.Lock()
+	defer strategyRegistry.Unlock()
+	if typ == "" || typ == "row" {
+		panic(fmt.Sprintf("strategy type %q is reserved", typ))
+	}
+	if _, dup := strategyRegistry.defs[typ]; dup {
+		panic(fmt.Sprintf("strategy %q already registered", typ))
+	}
+	strategyRegistry.defs[typ] = def
+}
+
+// ListStrategies 返回全部已注册的列策略（按类型名排序）与行级规则的说明
+func ListStrategies() []StrategyInfo {
+	strategyRegistry.RLock()
+	list := make([]StrategyInfo, 0, len(strategyRegistry.defs)+1)
+	for _, def := range strategyRegistry.defs {
+		list = append(list, def.info)
+	}
+	strategyRegistry.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Type < list[j].Type })
+	return append(list, StrategyInfo{
+		Type:        "row",
+		Description: "行级规则：expr 表达式可引用同一行的其他列，结果为 false 时该行标记为错误",
+		Scope:       "row",
+		Params:      paramSchema(reflect.TypeOf(rowRuleParams{})),
+	})
+}
+
+// newStrategy 根据配置从注册表创建列策略
+func newStrategy(r RuleSpec) (CleaningStrategy, error) {
+	if r.Type == "" {
+		return nil, NewParamError("type", "type is required")
+	}
+	strategyRegistry.RLock()
+	def, ok := strategyRegistry.defs[r.Type]
+	strategyRegistry.RUnlock()
+	if !ok {
+		return nil, NewParamError("type", "unknown strategy type: %s", r.Type)
+	}
+	return def.build(r.Params)
+}
+
+// decodeParams 解码参数并按 required / enum 标签校验
+func decodeParams(raw json.RawMessage, dst interface{}) error {
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, dst); err != nil {
+			var te *json.UnmarshalTypeError
+			if errors.As(err, &te) && te.Field != "" {
+				return NewParamError(te.Field, "%s must be %s, got %s", te.Field, schemaType(te.Type), te.Value)
+			}
+			return err
+		}
+	}
+
+	v := reflect.ValueOf(dst).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := paramName(f)
+		if name == "" {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Tag.Get("required") == "true" && fv.IsZero() {
+			return NewParamError(name, "%s is required", name)
+		}
+		if enum := f.Tag.Get("enum"); enum != "" && fv.Kind() == reflect.String && fv.String() != "" {
+			values := strings.Split(enum, ",")
+			if !oneOf(fv.String(), values) {
+				return NewParamError(name, "unknown %s %q, expected one of %s", name, fv.String(), strings.Join(values, "/"))
+			}
+		}
+	}
+	return nil
+}
+
+// paramName 返回字段的 JSON 参数名，未导出或忽略的字段返回空
+func paramName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		name = f.Name
+	}
+	return name
+}
+
+// paramSchema 根据参数结构体的字段与标签生成参数说明
+func paramSchema(t reflect.Type) ParamSchema {
+	schema := ParamSchema{Type: "object", Properties: map[string]ParamSchema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := paramName(f)
+		if name == "" {
+			continue
+		}
+		prop := fieldSchema(f.Type)
+		prop.Description = f.Tag.Get("desc")
+		if enum := f.Tag.Get("enum"); enum != "" {
+			prop.Enum = strings.Split(enum, ",")
+		}
+		if f.Tag.Get("required") == "true" {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = prop
+	}
+	return schema
+}
+
+func fieldSchema(t reflect.Type) ParamSchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	s := ParamSchema{Type: schemaType(t)}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		items := fieldSchema(t.Elem())
+		s.Items = &items
+	case reflect.Map:
+		values := fieldSchema(t.Elem())
+		s.AdditionalProperties = &values
+	}
+	return s
+}
+
+// schemaType 返回 Go 类型对应的 JSON Schema 类型名；interface{} 参数按字符串处理
+func schemaType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return "string"
+	}
+}
+
+func oneOf(v string, values []string) bool {
+	for _, x := range values {
+		if v == x {
+			return true
+		}
+	}
+	return false
+}
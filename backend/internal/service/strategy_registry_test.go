@@ -0,0 +1,126 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type prefixParams struct {
+	Prefix string `json:"prefix" desc:"必须包含的前缀" required:"true"`
+	Mode   string `json:"mode" enum:"strict,loose"`
+	Limit  int    `json:"limit"`
+}
+
+type prefixStrategy struct{ prefixParams }
+
+func (s *prefixStrategy) Clean(input string) (string, error) {
+	if s.Mode == "loose" {
+		input = strings.ToUpper(input)
+	}
+	if !strings.HasPrefix(input, s.Prefix) {
+		return input, ruleError("missing_prefix", "must start with %s", s.Prefix)
+	}
+	return input, nil
+}
+
+func (s *prefixStrategy) GetType() string { return "test_prefix" }
+
+func init() {
+	RegisterStrategy("test_prefix", "测试用前缀校验", func(p prefixParams) (CleaningStrategy, error) {
+		return &prefixStrategy{p}, nil
+	})
+}
+
+func TestRegisterStrategy_Custom(t *testing.T) {
+	engine := NewRuleEngine()
+	if err := engine.LoadConfig([]byte(`[{"column": "emp_no", "rules": [{"type": "test_prefix", "prefix": "EMP", "mode": "loose"}]}]`)); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if got, err := engine.Execute("emp_no", "emp001"); err != nil || got != "EMP001" {
+		t.Errorf("Execute() = %q, %v", got, err)
+	}
+	_, err := engine.Execute("emp_no", "x001")
+	var re *RuleError
+	if !errors.As(err, &re) || re.Rule != "test_prefix" || re.Code != "missing_prefix" {
+		t.Errorf("Execute() error = %#v", err)
+	}
+
+	tests := []struct {
+		name      string
+		rule      string
+		wantField string
+	}{
+		{"missing required", `{"type": "test_prefix"}`, "prefix"},
+		{"bad enum", `{"type": "test_prefix", "prefix": "EMP", "mode": "fuzzy"}`, "mode"},
+		{"wrong type", `{"type": "test_prefix", "prefix": "EMP", "limit": "ten"}`, "limit"},
+	}
+	for _, tt := range tests {
+		err := ValidateRules(`[{"column": "emp_no", "rules": [` + tt.rule + `]}]`)
+		var errs RuleConfigErrors
+		if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Field != tt.wantField {
+			t.Errorf("%s: ValidateRules() = %v, want error on %s", tt.name, err, tt.wantField)
+		}
+	}
+}
+
+func TestRegisterStrategy_Duplicate(t *testing.T) {
+	for _, typ := range []string{"regex", "row", ""} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterStrategy(%q) did not panic", typ)
+				}
+			}()
+			RegisterStrategy(typ, "", func(noParams) (CleaningStrategy, error) { return &RequiredStrategy{}, nil })
+		}()
+	}
+}
+
+func TestListStrategies(t *testing.T) {
+	infos := map[string]StrategyInfo{}
+	for _, info := range ListStrategies() {
+		infos[info.Type] = info
+	}
+	for _, typ := range []string{"required", "regex", "length", "replace", "date", "address", "enum", "idcard", "row"} {
+		if _, ok := infos[typ]; !ok {
+			t.Errorf("ListStrategies() missing %s", typ)
+		}
+	}
+
+	addr := infos["address"].Params
+	if !reflect.DeepEqual(addr.Required, []string{"comp"}) || !reflect.DeepEqual(addr.Properties["comp"].Enum, []string{"province", "city", "district", "code"}) {
+		t.Errorf("address params = %+v", addr)
+	}
+	enum := infos["enum"].Params.Properties
+	if enum["values"].Type != "array" || enum["values"].Items.Type != "string" || enum["map"].AdditionalProperties == nil {
+		t.Errorf("enum params = %+v", enum)
+	}
+	if infos["number"].Params.Properties["min"].Type != "number" || infos["length"].Params.Properties["min"].Type != "integer" {
+		t.Errorf("numeric param types not described")
+	}
+	if infos["row"].Scope != "row" || infos["regex"].Scope != "column" {
+		t.Errorf("unexpected scopes: row=%s regex=%s", infos["row"].Scope, infos["regex"].Scope)
+	}
+}
+
+func TestRuleSpec_JSONRoundTrip(t *testing.T) {
+	data, err := json.Marshal(DefaultRuleConfigs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"column":"phone","rules":[{"new":"","old":" ","type":"replace"},{"pattern":"^1[3-9]\\d{9}$","type":"regex"}]}`
+	if string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+
+	engine := NewRuleEngine()
+	if err := engine.LoadConfig([]byte("[" + string(data) + "]")); err != nil {
+		t.Fatalf("LoadConfig() of marshalled defaults: %v", err)
+	}
+	if _, err := engine.Execute("phone", "138 0013 8000"); err != nil {
+		t.Errorf("Execute() = %v", err)
+	}
+}
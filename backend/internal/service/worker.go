@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"etl-tool/internal/config"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// RunWorker 运行任务消费循环，直到 ctx 结束。
+// 每个任务在 ProcessBatch 返回后才会 Ack；Worker 退出时未完成的任务会被交还队列。
+func (s *CleanerService) RunWorker(ctx context.Context, pollTimeout time.Duration) {
+	reclaimInterval := 15 * time.Second
+	if config.AppConfig != nil && config.AppConfig.Queue.ReclaimInterval > 0 {
+		reclaimInterval = time.Duration(config.AppConfig.Queue.ReclaimInterval) * time.Second
+	}
+
+	s.Queue.StartHeartbeat(ctx)
+	s.Queue.StartReclaimer(ctx, reclaimInterval)
+	s.StartReaper(ctx)
+	log.Printf("[Worker] %s waiting for tasks...", s.Queue.WorkerID)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[Worker] Stopped.")
+			return
+		default:
+		}
+
+		// Blocking move with timeout (allows checking context periodically)
+		task, err := s.Queue.DequeueTask(pollTimeout)
+		if err != nil {
+			// Redis nil means timeout (no task)
+			if err == goredis.Nil {
+				continue
+			}
+			// Retry on connection error
+			log.Printf("[Worker] Queue error: %v. Retrying in 5s...", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+
+		log.Printf("[Worker] Received task: ID=%d File=%s Attempts=%d", task.BatchID, task.FilePath, task.Attempts)
+		s.ProcessBatch(ctx, task.BatchID, task.FilePath)
+
+		if ctx.Err() != nil {
+			// Worker 正在退出：交还任务，由其他 Worker 从断点继续
+			if err := s.Queue.RequeueTask(task); err != nil {
+				log.Printf("[Worker] Failed to requeue batch %d: %v", task.BatchID, err)
+			}
+			log.Println("[Worker] Stopped.")
+			return
+		}
+		if err := s.Queue.AckTask(task); err != nil {
+			log.Printf("[Worker] Failed to ack batch %d: %v", task.BatchID, err)
+		}
+		log.Printf("[Worker] Task %d completed/processed", task.BatchID)
+	}
+}
@@ -2,8 +2,10 @@ package utils
 
 import (
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/xuri/excelize/v2"
@@ -52,23 +54,127 @@ func readCSV(path string) ([][]string, error) {
 	return r.ReadAll()
 }
 
-// DetectHeaders finds the indices of required columns
+// MappingIgnore 列映射中表示"不导入该列"的取值
+const MappingIgnore = "ignore"
+
+// logicalFields 列映射允许的逻辑字段
+var logicalFields = []string{"name", "phone", "date", "address"}
+
+// ColumnMapping 上传时提交的列映射文档：源表头 -> 逻辑字段（name/phone/date/address）或 "ignore"。
+// 未出现在映射中的列按普通列导入。
+type ColumnMapping map[string]string
+
+// ParseColumnMapping 解析并校验列映射 JSON，空字符串返回 nil
+func ParseColumnMapping(data string) (ColumnMapping, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+	var m ColumnMapping
+	if err := json.Unmarshal([]byte(data), &m); err != nil {
+		return nil, fmt.Errorf("invalid column mapping: %w", err)
+	}
+
+	// 按表头名排序遍历，保证错误信息稳定
+	sources := make([]string, 0, len(m))
+	for src := range m {
+		sources = append(sources, src)
+	}
+	sort.Strings(sources)
+
+	used := make(map[string]string)
+	for _, src := range sources {
+		target := strings.ToLower(strings.TrimSpace(m[src]))
+		if target == "" {
+			return nil, fmt.Errorf("invalid column mapping: empty target for column %q", src)
+		}
+		if target == MappingIgnore {
+			continue
+		}
+		if !isLogicalField(target) {
+			return nil, fmt.Errorf("invalid column mapping: unknown field %q for column %q (allowed: %s, %s)",
+				target, src, strings.Join(logicalFields, ", "), MappingIgnore)
+		}
+		if prev, ok := used[target]; ok {
+			return nil, fmt.Errorf("invalid column mapping: columns %q and %q both map to %q", prev, src, target)
+		}
+		used[target] = src
+	}
+	return m, nil
+}
+
+// ResolveMapping 按列映射确定逻辑列位置（与表头顺序无关，结果确定），并返回需要忽略的列序号。
+// 映射中引用了文件中不存在的表头时返回错误。
+func ResolveMapping(header []string, mapping ColumnMapping) (ColIndices, map[int]bool, error) {
+	indices := ColIndices{Name: -1, Phone: -1, Address: -1, Date: -1}
+	ignored := make(map[int]bool)
+
+	positions := make(map[string]int, len(header))
+	for i, col := range header {
+		key := strings.ToLower(strings.TrimSpace(col))
+		if _, dup := positions[key]; !dup {
+			positions[key] = i
+		}
+	}
+
+	// 按表头名排序遍历，保证错误信息稳定
+	sources := make([]string, 0, len(mapping))
+	for src := range mapping {
+		sources = append(sources, src)
+	}
+	sort.Strings(sources)
+
+	for _, src := range sources {
+		idx, ok := positions[strings.ToLower(strings.TrimSpace(src))]
+		if !ok {
+			return indices, nil, fmt.Errorf("column mapping refers to missing header %q. Header was: %v", src, header)
+		}
+		switch strings.ToLower(strings.TrimSpace(mapping[src])) {
+		case MappingIgnore:
+			ignored[idx] = true
+		case "name":
+			indices.Name = idx
+		case "phone":
+			indices.Phone = idx
+		case "date":
+			indices.Date = idx
+		case "address":
+			indices.Address = idx
+		}
+	}
+	return indices, ignored, nil
+}
+
+func isLogicalField(f string) bool {
+	for _, lf := range logicalFields {
+		if lf == f {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectHeaders finds the indices of required columns.
+// 匹配按表头顺序进行：先找完全相等的列，再找包含关键字的列，因此结果与运行次数无关。
 func DetectHeaders(header []string) ColIndices {
 	indices := ColIndices{Name: -1, Phone: -1, Address: -1, Date: -1}
 
-	headerMap := make(map[string]int)
+	normalized := make([]string, len(header))
 	for i, col := range header {
-		headerMap[strings.ToLower(strings.TrimSpace(col))] = i
+		normalized[i] = strings.ToLower(strings.TrimSpace(col))
 	}
 
 	findCol := func(keywords ...string) int {
 		for _, k := range keywords {
-			if idx, ok := headerMap[k]; ok {
-				return idx
+			for i, h := range normalized {
+				if h == k {
+					return i
+				}
 			}
-			for h, idx := range headerMap {
+		}
+		for _, k := range keywords {
+			for i, h := range normalized {
 				if strings.Contains(h, k) {
-					return idx
+					return i
 				}
 			}
 		}
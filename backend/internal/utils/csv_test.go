@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestDetectHeaders_Deterministic(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []string
+		want   ColIndices
+	}{
+		{
+			name:   "精确匹配优先于包含匹配",
+			header: []string{"company_name", "name", "phone_ext", "phone"},
+			want:   ColIndices{Name: 1, Phone: 3, Address: -1, Date: -1},
+		},
+		{
+			name:   "包含匹配按表头顺序",
+			header: []string{"user_name", "company_name", "join_date"},
+			want:   ColIndices{Name: 0, Phone: -1, Address: -1, Date: 2},
+		},
+		{
+			name:   "中文表头",
+			header: []string{"姓名", "手机号", "地址", "入职日期"},
+			want:   ColIndices{Name: 0, Phone: 1, Address: 2, Date: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 多次运行结果必须一致
+			for i := 0; i < 50; i++ {
+				got := DetectHeaders(tt.header)
+				if got != tt.want {
+					t.Fatalf("DetectHeaders() = %+v, want %+v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseColumnMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantNil bool
+		wantErr bool
+	}{
+		{"空映射", "", true, false},
+		{"合法映射", `{"员工姓名": "name", "联系电话": "Phone", "备注": "ignore"}`, false, false},
+		{"非法 JSON", `{"a":`, false, true},
+		{"未知逻辑字段", `{"a": "email"}`, false, true},
+		{"重复映射", `{"a": "name", "b": "name"}`, false, true},
+		{"空目标", `{"a": ""}`, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseColumnMapping(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseColumnMapping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (got == nil) != tt.wantNil {
+				t.Errorf("ParseColumnMapping() = %v, wantNil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestParseColumnMapping_DuplicateErrorIsStable(t *testing.T) {
+	const want = `invalid column mapping: columns "a" and "b" both map to "name"`
+	for i := 0; i < 20; i++ {
+		_, err := ParseColumnMapping(`{"b": "name", "a": "name", "c": "phone"}`)
+		if err == nil || err.Error() != want {
+			t.Fatalf("ParseColumnMapping() error = %v, want %s", err, want)
+		}
+	}
+}
+
+func TestResolveMapping(t *testing.T) {
+	header := []string{"id", "name", "company_name", "phone", "phone_ext", "备注"}
+	mapping := ColumnMapping{
+		"company_name": "name",
+		"PHONE_EXT":    "phone",
+		"备注":           "ignore",
+	}
+
+	indices, ignored, err := ResolveMapping(header, mapping)
+	if err != nil {
+		t.Fatalf("ResolveMapping() error = %v", err)
+	}
+	want := ColIndices{Name: 2, Phone: 4, Address: -1, Date: -1}
+	if indices != want {
+		t.Errorf("ResolveMapping() = %+v, want %+v", indices, want)
+	}
+	if !ignored[5] || len(ignored) != 1 {
+		t.Errorf("Expected only column 5 to be ignored, got %v", ignored)
+	}
+
+	if _, _, err := ResolveMapping(header, ColumnMapping{"missing": "name"}); err == nil {
+		t.Error("ResolveMapping() should fail for headers absent from the file")
+	}
+}
@@ -12,6 +12,7 @@ type Response struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	Details interface{} `json:"details,omitempty"` // 可选的结构化错误详情（如规则校验的逐项错误）
 }
 
 // SuccessResponse sends a standard success response
@@ -31,3 +32,13 @@ func ErrorResponse(c *gin.Context, statusCode int, message string) {
 		Error:   message,
 	})
 }
+
+// ErrorResponseWithDetails sends a standard error response with structured details
+func ErrorResponseWithDetails(c *gin.Context, statusCode int, message string, details interface{}) {
+	c.JSON(statusCode, Response{
+		Code:    statusCode,
+		Message: "error",
+		Error:   message,
+		Details: details,
+	})
+}
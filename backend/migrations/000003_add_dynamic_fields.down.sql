@@ -0,0 +1,2 @@
+ALTER TABLE import_batches DROP COLUMN IF EXISTS columns;
+ALTER TABLE records DROP COLUMN IF EXISTS fields;
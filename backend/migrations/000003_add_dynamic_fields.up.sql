@@ -0,0 +1,2 @@
+ALTER TABLE records ADD COLUMN IF NOT EXISTS fields JSONB;
+ALTER TABLE import_batches ADD COLUMN IF NOT EXISTS columns JSONB;
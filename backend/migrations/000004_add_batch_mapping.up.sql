@@ -0,0 +1 @@
+ALTER TABLE import_batches ADD COLUMN IF NOT EXISTS mapping TEXT;
@@ -0,0 +1 @@
+ALTER TABLE import_batches DROP COLUMN IF EXISTS recovery_count;
@@ -0,0 +1 @@
+ALTER TABLE import_batches ADD COLUMN IF NOT EXISTS recovery_count INTEGER DEFAULT 0;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS uniq_records_batch_row;
+CREATE INDEX IF NOT EXISTS idx_records_batch_row ON records (batch_id, row_index);
@@ -0,0 +1,12 @@
+-- 清理中断/恢复产生的重复行，只保留最早写入的一条
+DELETE FROM records a
+USING records b
+WHERE a.batch_id = b.batch_id
+  AND a.row_index = b.row_index
+  AND a.id > b.id;
+
+-- 幂等写入依赖该唯一索引（ON CONFLICT (batch_id, row_index) DO NOTHING），大批量写入时也不会被删除
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_records_batch_row ON records (batch_id, row_index);
+
+-- 与唯一索引重复，不再需要
+DROP INDEX IF EXISTS idx_records_batch_row;
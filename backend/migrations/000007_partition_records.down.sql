@@ -0,0 +1,31 @@
+DO $$
+DECLARE
+    seq TEXT;
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_class WHERE relname = 'records' AND relkind = 'p') THEN
+        RETURN;
+    END IF;
+
+    DROP VIEW IF EXISTS clean_employees;
+    DROP VIEW IF EXISTS error_logs;
+
+    ALTER TABLE records RENAME TO records_partitioned;
+
+    seq := pg_get_serial_sequence('records_partitioned', 'id');
+    IF seq IS NOT NULL THEN
+        EXECUTE format('ALTER SEQUENCE %s OWNED BY NONE', seq);
+    END IF;
+
+    CREATE TABLE records (LIKE records_partitioned INCLUDING DEFAULTS);
+    INSERT INTO records SELECT * FROM records_partitioned;
+    DROP TABLE records_partitioned CASCADE;
+    ALTER TABLE records ADD PRIMARY KEY (id);
+
+    IF seq IS NOT NULL THEN
+        EXECUTE format('ALTER SEQUENCE %s OWNED BY records.id', seq);
+    END IF;
+
+    CREATE UNIQUE INDEX uniq_records_batch_row ON records (batch_id, row_index);
+    CREATE INDEX IF NOT EXISTS idx_records_batch_id ON records (batch_id);
+    CREATE INDEX IF NOT EXISTS idx_records_status ON records (status);
+END $$;
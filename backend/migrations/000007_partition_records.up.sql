@@ -0,0 +1,50 @@
+-- 将 records 改为按 batch_id 的 LIST 分区表，每个批次一个分区（records_b<batch_id>）。
+-- 批量导入只需处理自己的分区，删除批次直接 DROP 分区。
+DO $$
+DECLARE
+    seq TEXT;
+    b BIGINT;
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_class WHERE relname = 'records' AND relkind = 'p') THEN
+        RETURN;
+    END IF;
+
+    -- 视图依赖 records，启动时会重新创建
+    DROP VIEW IF EXISTS clean_employees;
+    DROP VIEW IF EXISTS error_logs;
+
+    ALTER TABLE records RENAME TO records_legacy;
+
+    -- 保留自增序列：先解除与旧表的归属，避免随旧表一起删除
+    seq := pg_get_serial_sequence('records_legacy', 'id');
+    IF seq IS NOT NULL THEN
+        EXECUTE format('ALTER SEQUENCE %s OWNED BY NONE', seq);
+    END IF;
+
+    CREATE TABLE records (LIKE records_legacy INCLUDING DEFAULTS) PARTITION BY LIST (batch_id);
+
+    FOR b IN SELECT DISTINCT batch_id FROM records_legacy LOOP
+        EXECUTE format('CREATE TABLE records_b%s PARTITION OF records FOR VALUES IN (%s)', b, b);
+    END LOOP;
+
+    INSERT INTO records SELECT * FROM records_legacy;
+    DROP TABLE records_legacy;
+
+    IF seq IS NOT NULL THEN
+        EXECUTE format('ALTER SEQUENCE %s OWNED BY records.id', seq);
+    END IF;
+
+    -- 旧表删除后再建约束与索引，避免与旧表上的同名对象冲突。
+    -- 分区表的主键必须包含分区键；id 在前以支持按 id 查询
+    ALTER TABLE records ADD PRIMARY KEY (id, batch_id);
+
+    -- 幂等写入依赖的唯一索引，在父表上创建并自动应用到所有分区
+    CREATE UNIQUE INDEX uniq_records_batch_row ON records (batch_id, row_index);
+    CREATE INDEX idx_records_status ON records (batch_id, status);
+
+    -- 搜索索引按分区单独创建
+    FOR b IN SELECT DISTINCT batch_id FROM records LOOP
+        EXECUTE format('CREATE INDEX IF NOT EXISTS records_b%s_phone ON records_b%s (phone varchar_pattern_ops, row_index)', b, b);
+        EXECUTE format('CREATE INDEX IF NOT EXISTS records_b%s_name ON records_b%s (name varchar_pattern_ops, row_index)', b, b);
+    END LOOP;
+END $$;
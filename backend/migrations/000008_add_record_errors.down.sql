@@ -0,0 +1,13 @@
+DO $$
+DECLARE
+    p TEXT;
+BEGIN
+    FOR p IN SELECT c.relname FROM pg_inherits i
+             JOIN pg_class c ON c.oid = i.inhrelid
+             JOIN pg_class t ON t.oid = i.inhparent
+             WHERE t.relname = 'records' LOOP
+        EXECUTE format('DROP INDEX IF EXISTS %I', p || '_errors');
+    END LOOP;
+END $$;
+
+ALTER TABLE records DROP COLUMN IF EXISTS errors;
@@ -0,0 +1,15 @@
+-- 结构化校验错误：[{"column", "rule", "code", "message", "value"}]，旧记录保持 NULL，仅有 error_message
+ALTER TABLE records ADD COLUMN IF NOT EXISTS errors JSONB;
+
+DO $$
+DECLARE
+    p TEXT;
+BEGIN
+    -- 按错误代码/列过滤使用的 GIN 索引，与搜索索引一样按分区创建
+    FOR p IN SELECT c.relname FROM pg_inherits i
+             JOIN pg_class c ON c.oid = i.inhrelid
+             JOIN pg_class t ON t.oid = i.inhparent
+             WHERE t.relname = 'records' LOOP
+        EXECUTE format('CREATE INDEX IF NOT EXISTS %I ON %I USING GIN (errors jsonb_path_ops)', p || '_errors', p);
+    END LOOP;
+END $$;
@@ -0,0 +1,2 @@
+-- 批次分析结果缓存（导入时增量统计，或首次查询时聚合一次）
+ALTER TABLE import_batches ADD COLUMN IF NOT EXISTS analytics JSONB;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_record_versions_operation_id;
+ALTER TABLE record_versions DROP COLUMN IF EXISTS operation_id;
+DROP TABLE IF EXISTS bulk_operations;
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS bulk_operations (
+    id BIGSERIAL PRIMARY KEY,
+    batch_id BIGINT NOT NULL,
+    type VARCHAR(50),
+    "column" VARCHAR(255),
+    params TEXT,
+    filter TEXT,
+    reason VARCHAR(255),
+    undo_of BIGINT,
+    status VARCHAR(50),
+    total BIGINT DEFAULT 0,
+    processed BIGINT DEFAULT 0,
+    changed BIGINT DEFAULT 0,
+    skipped BIGINT DEFAULT 0,
+    error TEXT,
+    created_by VARCHAR(100),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_bulk_operations_batch_id ON bulk_operations(batch_id);
+CREATE INDEX IF NOT EXISTS idx_bulk_operations_undo_of ON bulk_operations(undo_of);
+CREATE INDEX IF NOT EXISTS idx_bulk_operations_status ON bulk_operations(status);
+
+-- 批量操作写入的版本共享操作 ID，撤销时按操作 ID 查找
+ALTER TABLE record_versions ADD COLUMN IF NOT EXISTS operation_id BIGINT;
+CREATE INDEX IF NOT EXISTS idx_record_versions_operation_id ON record_versions(operation_id);
@@ -0,0 +1,3 @@
+ALTER TABLE bulk_operations DROP COLUMN IF EXISTS preserved;
+ALTER TABLE bulk_operations DROP COLUMN IF EXISTS to_error;
+ALTER TABLE bulk_operations DROP COLUMN IF EXISTS to_clean;
@@ -0,0 +1,4 @@
+-- 记录批量操作 / 重新清洗引起的状态变化方向
+ALTER TABLE bulk_operations ADD COLUMN IF NOT EXISTS to_clean BIGINT DEFAULT 0;
+ALTER TABLE bulk_operations ADD COLUMN IF NOT EXISTS to_error BIGINT DEFAULT 0;
+ALTER TABLE bulk_operations ADD COLUMN IF NOT EXISTS preserved BIGINT DEFAULT 0;
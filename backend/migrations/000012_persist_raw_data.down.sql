@@ -0,0 +1,2 @@
+ALTER TABLE import_batches DROP COLUMN IF EXISTS source_header;
+ALTER TABLE records ALTER COLUMN address TYPE VARCHAR(255) USING left(address, 255);
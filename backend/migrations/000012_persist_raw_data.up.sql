@@ -0,0 +1,5 @@
+-- 地址保留完整原文，不再截断为 255 字符（VARCHAR -> TEXT 不需要重写数据）
+ALTER TABLE records ALTER COLUMN address TYPE TEXT;
+
+-- 源文件原始表头，与 records.raw_data 中的单元格一一对应
+ALTER TABLE import_batches ADD COLUMN IF NOT EXISTS source_header JSONB;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_import_batches_rule_set_id;
+ALTER TABLE import_batches DROP COLUMN IF EXISTS rule_set_version;
+ALTER TABLE import_batches DROP COLUMN IF EXISTS rule_set_id;
+DROP TABLE IF EXISTS rule_set_versions;
+DROP TABLE IF EXISTS rule_sets;
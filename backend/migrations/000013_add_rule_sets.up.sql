@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS rule_sets (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    owner VARCHAR(100),
+    shared BOOLEAN DEFAULT FALSE,
+    latest_version BIGINT DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_rule_sets_owner ON rule_sets(owner);
+CREATE INDEX IF NOT EXISTS idx_rule_sets_deleted_at ON rule_sets(deleted_at);
+-- 名称在未删除的规则集中唯一
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_rule_sets_name ON rule_sets(name) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS rule_set_versions (
+    id BIGSERIAL PRIMARY KEY,
+    rule_set_id BIGINT NOT NULL,
+    version BIGINT NOT NULL,
+    rules TEXT,
+    comment VARCHAR(255),
+    created_by VARCHAR(100),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_rule_set_versions_rule_set_id ON rule_set_versions(rule_set_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_rule_set_versions_version ON rule_set_versions(rule_set_id, version);
+
+-- 批次记录导入时使用的规则集版本
+ALTER TABLE import_batches ADD COLUMN IF NOT EXISTS rule_set_id BIGINT;
+ALTER TABLE import_batches ADD COLUMN IF NOT EXISTS rule_set_version BIGINT;
+CREATE INDEX IF NOT EXISTS idx_import_batches_rule_set_id ON import_batches(rule_set_id);
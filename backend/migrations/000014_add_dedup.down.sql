@@ -0,0 +1,6 @@
+ALTER TABLE bulk_operations DROP COLUMN IF EXISTS dup_groups;
+ALTER TABLE bulk_operations DROP COLUMN IF EXISTS duplicates;
+ALTER TABLE records DROP COLUMN IF EXISTS dup_match;
+ALTER TABLE records DROP COLUMN IF EXISTS dup_of;
+ALTER TABLE records DROP COLUMN IF EXISTS dup_group;
+ALTER TABLE import_batches DROP COLUMN IF EXISTS dedup;
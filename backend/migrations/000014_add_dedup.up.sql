@@ -0,0 +1,9 @@
+-- 去重配置与结果：批次上传时的去重配置，记录所属的重复组与保留记录
+ALTER TABLE import_batches ADD COLUMN IF NOT EXISTS dedup TEXT;
+
+ALTER TABLE records ADD COLUMN IF NOT EXISTS dup_group BIGINT;
+ALTER TABLE records ADD COLUMN IF NOT EXISTS dup_of BIGINT;
+ALTER TABLE records ADD COLUMN IF NOT EXISTS dup_match VARCHAR(100);
+
+ALTER TABLE bulk_operations ADD COLUMN IF NOT EXISTS duplicates BIGINT DEFAULT 0;
+ALTER TABLE bulk_operations ADD COLUMN IF NOT EXISTS dup_groups BIGINT DEFAULT 0;